@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+)
+
+const (
+	defaultAcres99APIURL = "https://www.99acres.com/99api/v1/getmy99Response/OeAuXClO43hwseaXEQ/uid/"
+
+	// 99acres serves responses for a short range per call
+	acres99MaxWindow = 24 * time.Hour
+)
+
+type acres99Response struct {
+	ActionStatus string         `xml:"ActionStatus,attr"`
+	ErrorMsg     string         `xml:"ErrorDetail>Message"`
+	Responses    []acres99Query `xml:"Resp"`
+}
+
+type acres99Query struct {
+	Detail  acres99QueryDetail   `xml:"QryDtl"`
+	Contact acres99ContactDetail `xml:"CntctDtl"`
+}
+
+type acres99QueryDetail struct {
+	QueryID     string `xml:"QueryId,attr"`
+	ResType     string `xml:"ResType,attr"`
+	Label       string `xml:"CmpctLabl"`
+	Info        string `xml:"QryInfo"`
+	ReceivedOn  string `xml:"RcvdOn"`
+	ProjectName string `xml:"ProjName"`
+	City        string `xml:"City"`
+}
+
+type acres99ContactDetail struct {
+	Name  string `xml:"Name"`
+	Email string `xml:"Email"`
+	Phone string `xml:"Phone"`
+}
+
+type acres99Connector struct {
+	client   *leadPlatformClient
+	apiURL   string
+	username string
+	password string
+}
+
+// newAcres99Connector reads username and password as saved from the Integrations page
+func newAcres99Connector(integration models.Integration, client *leadPlatformClient) (LeadConnector, error) {
+	c := &acres99Connector{
+		client:   client,
+		apiURL:   integrationConfigString(integration.Config, "api_url"),
+		username: integrationConfigString(integration.Config, "username"),
+		password: integrationConfigString(integration.Config, "password"),
+	}
+	if c.username == "" || c.password == "" {
+		return nil, errors.New("99acres username and password are required")
+	}
+	if c.apiURL == "" {
+		c.apiURL = defaultAcres99APIURL
+	}
+	return c, nil
+}
+
+// FetchSince requests the responses received in one window starting at the cursor
+func (c *acres99Connector) FetchSince(cursor string) ([]ExternalLeadRecord, string, error) {
+	now := time.Now().In(istLocation)
+	from := leadSyncWindowStart(cursor, indiaMartQueryTimeLayout, now)
+	to := now
+	if to.Sub(from) > acres99MaxWindow {
+		to = from.Add(acres99MaxWindow)
+	}
+
+	var query strings.Builder
+	query.WriteString("<?xml version='1.0'?><query>")
+	query.WriteString("<user_name>" + xmlEscape(c.username) + "</user_name>")
+	query.WriteString("<pswd>" + xmlEscape(c.password) + "</pswd>")
+	query.WriteString("<start_date>" + from.Format(indiaMartQueryTimeLayout) + "</start_date>")
+	query.WriteString("<end_date>" + to.Format(indiaMartQueryTimeLayout) + "</end_date>")
+	query.WriteString("</query>")
+
+	form := url.Values{}
+	form.Set("xml", query.String())
+
+	status, body, err := c.client.Do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, c.apiURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return nil, cursor, err
+	}
+	if status != http.StatusOK {
+		return nil, cursor, fmt.Errorf("99acres API returned status %d: %s", status, string(body))
+	}
+
+	var resp acres99Response
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return nil, cursor, fmt.Errorf("failed to parse 99acres response: %w", err)
+	}
+	if strings.EqualFold(resp.ActionStatus, "false") {
+		return nil, cursor, fmt.Errorf("99acres API error: %s", resp.ErrorMsg)
+	}
+
+	next := cursor
+	records := make([]ExternalLeadRecord, 0, len(resp.Responses))
+	for _, q := range resp.Responses {
+		rec := ExternalLeadRecord{ExternalID: strings.TrimSpace(q.Detail.QueryID), Data: q}
+		if t, err := time.ParseInLocation(indiaMartQueryTimeLayout, strings.TrimSpace(q.Detail.ReceivedOn), istLocation); err == nil {
+			rec.ReceivedAt = t
+			if stamp := t.Format(indiaMartQueryTimeLayout); stamp > next {
+				next = stamp
+			}
+		}
+		records = append(records, rec)
+	}
+
+	if next == cursor && to.Before(now) {
+		next = to.Format(indiaMartQueryTimeLayout)
+	}
+
+	return records, next, nil
+}
+
+// MapLead maps a 99acres response to a CRM lead
+func (c *acres99Connector) MapLead(rec ExternalLeadRecord) models.Lead {
+	q := rec.Data.(acres99Query)
+
+	lead := models.Lead{
+		Business:     strings.TrimSpace(q.Contact.Name),
+		Name:         strings.TrimSpace(q.Contact.Name),
+		Mobile:       strings.TrimSpace(q.Contact.Phone),
+		Email:        strings.TrimSpace(q.Contact.Email),
+		City:         strings.TrimSpace(q.Detail.City),
+		Source:       "99acres",
+		Requirements: strings.TrimSpace(q.Detail.Label + "\n" + q.Detail.Info),
+		ProductName:  strings.TrimSpace(q.Detail.ProjectName),
+		Since:        rec.ReceivedAt,
+	}
+	return lead
+}
+
+// Ack is a no-op: 99acres has no acknowledgement
+func (c *acres99Connector) Ack(records []ExternalLeadRecord) error {
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var auditLogDB *gorm.DB
+
+func SetAuditLogDB(db *gorm.DB) {
+	auditLogDB = db
+}
+
+// recordAudit writes an audit entry within db (which may be a transaction); details is stored as JSON
+func recordAudit(db *gorm.DB, userID *uint, action, entityType string, entityID *uint, details interface{}) error {
+	raw, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	entry := models.AuditLog{
+		UserID:     userID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Details:    raw,
+	}
+	return db.Create(&entry).Error
+}
+
+/* ========== HANDLERS ========== */
+
+// GetAuditLogs lists audit entries, newest first. Query: entity_type, entity_id, action, user_id, limit
+func GetAuditLogs(c *fiber.Ctx) error {
+	query := auditLogDB.Order("created_at desc")
+
+	if entityType := c.Query("entity_type"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+	if entityID := c.QueryInt("entity_id", 0); entityID > 0 {
+		query = query.Where("entity_id = ?", entityID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if userID := c.QueryInt("user_id", 0); userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var logs []models.AuditLog
+	if err := query.Limit(c.QueryInt("limit", 100)).Find(&logs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(logs)
+}
@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// Calendar length of events that only have a start
+	calendarFollowUpLength    = 30 * time.Minute
+	calendarInteractionLength = time.Hour
+	// How far back past meetings and site visits stay in the feed
+	calendarInteractionHistory = 90 * 24 * time.Hour
+	// Event UID domain when APP_BASE_URL is not set
+	calendarUIDDomain = "erp.local"
+)
+
+// Interaction types published to the calendar, compared lowercase with spaces as dashes
+var calendarInteractionTypes = []string{"meeting", "site-visit"}
+
+var calendarFeedDB *gorm.DB
+
+func SetCalendarFeedDB(db *gorm.DB) {
+	calendarFeedDB = db
+}
+
+/* ========== HELPERS ========== */
+
+func newCalendarToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// appBaseURL is where links in feeds point: APP_BASE_URL, else the URL the request came in on
+func appBaseURL(c *fiber.Ctx) string {
+	if u := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/"); u != "" {
+		return u
+	}
+	return c.BaseURL()
+}
+
+// calendarEventDomain ends event UIDs. It must not follow the request's Host header, or the
+// same event would get a new UID, and show twice, when the feed is fetched by another name.
+func calendarEventDomain() string {
+	if u, err := url.Parse(strings.TrimSpace(os.Getenv("APP_BASE_URL"))); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return calendarUIDDomain
+}
+
+func calendarFeedURL(c *fiber.Ctx, token string) string {
+	return appBaseURL(c) + "/api/calendar/" + token + ".ics"
+}
+
+// icsEscape escapes a TEXT value (RFC 5545 3.3.11)
+func icsEscape(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "").Replace(s)
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsWriter builds an iCalendar document with CRLF line endings and lines folded at 75 octets
+type icsWriter struct {
+	b strings.Builder
+}
+
+func (w *icsWriter) line(name, value string) {
+	content := name + ":" + value
+	for len(content) > 75 {
+		cut := 75
+		// Never split a UTF-8 sequence
+		for cut > 0 && content[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(content[:cut] + "\r\n")
+		content = " " + content[cut:]
+	}
+	w.b.WriteString(content + "\r\n")
+}
+
+type calendarEvent struct {
+	UID         string
+	Start, End  time.Time
+	Stamp       time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Categories  string
+}
+
+func (w *icsWriter) event(e calendarEvent) {
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", e.UID)
+	w.line("DTSTAMP", icsTime(e.Stamp))
+	w.line("LAST-MODIFIED", icsTime(e.Stamp))
+	w.line("DTSTART", icsTime(e.Start))
+	w.line("DTEND", icsTime(e.End))
+	w.line("SUMMARY", icsEscape(e.Summary))
+	if e.Description != "" {
+		w.line("DESCRIPTION", icsEscape(e.Description))
+	}
+	if e.Location != "" {
+		w.line("LOCATION", icsEscape(e.Location))
+	}
+	if e.URL != "" {
+		w.line("URL;VALUE=URI", e.URL)
+	}
+	w.line("CATEGORIES", icsEscape(e.Categories))
+	w.line("STATUS", "CONFIRMED")
+	w.line("TRANSP", "OPAQUE")
+	w.line("END", "VEVENT")
+}
+
+// calendarLeadText describes the lead an event belongs to
+func calendarLeadText(lead *models.Lead) (title, details, location string) {
+	title = lead.Business
+	if title == "" {
+		title = lead.Name
+	}
+	var lines []string
+	if lead.Business != "" && lead.Name != "" {
+		lines = append(lines, "Contact: "+lead.Name)
+	}
+	if lead.Mobile != "" {
+		lines = append(lines, "Mobile: "+lead.Mobile)
+	}
+	if lead.Email != "" {
+		lines = append(lines, "Email: "+lead.Email)
+	}
+	if lead.Stage != "" {
+		lines = append(lines, "Stage: "+lead.Stage)
+	}
+	var address []string
+	for _, part := range []string{lead.AddressLine1, lead.AddressLine2, lead.City, lead.State} {
+		if strings.TrimSpace(part) != "" {
+			address = append(address, strings.TrimSpace(part))
+		}
+	}
+	return title, strings.Join(lines, "\n"), strings.Join(address, ", ")
+}
+
+/* ========== HANDLERS ========== */
+
+// GetCalendarFeedToken returns a user's feed URL, if one has been issued
+func GetCalendarFeedToken(c *fiber.Ctx) error {
+	userID := c.Params("user_id")
+
+	var feed models.CalendarFeedToken
+	if err := calendarFeedDB.Where("user_id = ?", userID).First(&feed).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "No calendar feed for this user"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id":          feed.UserID,
+		"url":              calendarFeedURL(c, feed.Token),
+		"last_accessed_at": feed.LastAccessedAt,
+		"created_at":       feed.UpdatedAt,
+	})
+}
+
+// RotateCalendarFeedToken issues a new secret feed URL for a user; any previous URL stops working
+func RotateCalendarFeedToken(c *fiber.Ctx) error {
+	userID := c.Params("user_id")
+
+	var user models.User
+	if err := calendarFeedDB.First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	token, err := newCalendarToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var feed models.CalendarFeedToken
+	err = calendarFeedDB.Where("user_id = ?", user.ID).First(&feed).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	feed.UserID = user.ID
+	feed.Token = token
+	feed.LastAccessedAt = nil
+	if err := calendarFeedDB.Save(&feed).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"user_id": user.ID,
+		"url":     calendarFeedURL(c, token),
+	})
+}
+
+// RevokeCalendarFeedToken removes a user's feed URL
+func RevokeCalendarFeedToken(c *fiber.Ctx) error {
+	userID := c.Params("user_id")
+
+	if err := calendarFeedDB.Where("user_id = ?", userID).Delete(&models.CalendarFeedToken{}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Calendar feed revoked successfully"})
+}
+
+// GetCalendarFeed serves a user's pending follow-ups and their meetings and site visits as an
+// RFC 5545 calendar. The token in the URL identifies the user; calendar apps poll it, so
+// rescheduled follow-ups move and completed ones drop out on the next refresh.
+func GetCalendarFeed(c *fiber.Ctx) error {
+	token := strings.TrimSuffix(c.Params("token"), ".ics")
+
+	var feed models.CalendarFeedToken
+	if token == "" || calendarFeedDB.Where("token = ?", token).First(&feed).Error != nil {
+		return c.Status(404).SendString("Calendar not found")
+	}
+	var user models.User
+	if err := calendarFeedDB.First(&user, feed.UserID).Error; err != nil {
+		return c.Status(404).SendString("Calendar not found")
+	}
+	calendarFeedDB.Model(&feed).UpdateColumn("last_accessed_at", time.Now())
+
+	// Follow-ups assigned to the user, or unassigned ones on leads the user owns
+	var followUps []models.LeadFollowUp
+	if err := calendarFeedDB.Model(&models.LeadFollowUp{}).
+		Joins("JOIN leads ON leads.id = lead_follow_ups.lead_id").
+		Where("(lead_follow_ups.assigned_to_id = ? OR (lead_follow_ups.assigned_to_id IS NULL AND leads.assigned_to_id = ?))", user.ID, user.ID).
+		Where("lead_follow_ups.status = ?", "pending").
+		Select("lead_follow_ups.*").Preload("Lead").
+		Order("lead_follow_ups.follow_up_on asc").Find(&followUps).Error; err != nil {
+		return c.Status(500).SendString(err.Error())
+	}
+
+	var interactions []models.LeadInteraction
+	if err := calendarFeedDB.Model(&models.LeadInteraction{}).
+		Joins("JOIN leads ON leads.id = lead_interactions.lead_id").
+		Where("(lead_interactions.assigned_to_id = ? OR (lead_interactions.assigned_to_id IS NULL AND leads.assigned_to_id = ?))", user.ID, user.ID).
+		Where("REPLACE(LOWER(TRIM(lead_interactions.type)), ' ', '-') IN ?", calendarInteractionTypes).
+		Where(`lead_interactions."timestamp" >= ?`, time.Now().Add(-calendarInteractionHistory)).
+		Select("lead_interactions.*").Preload("Lead").
+		Order(`lead_interactions."timestamp" asc`).Find(&interactions).Error; err != nil {
+		return c.Status(500).SendString(err.Error())
+	}
+
+	base := appBaseURL(c)
+	host := calendarEventDomain()
+	leadURL := func(id uint) string {
+		return fmt.Sprintf("%s/leads-dashboard?lead=%d", base, id)
+	}
+
+	w := &icsWriter{}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//ERP//CRM Follow-ups//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.line("X-WR-CALNAME", icsEscape(strings.TrimSpace("CRM · "+user.Firstname+" "+user.Lastname)))
+	w.line("X-WR-TIMEZONE", "Asia/Kolkata")
+	w.line("REFRESH-INTERVAL;VALUE=DURATION", "PT15M")
+	w.line("X-PUBLISHED-TTL", "PT15M")
+
+	for _, f := range followUps {
+		title, details, location := calendarLeadText(&f.Lead)
+		summary := strings.TrimSpace(f.Title)
+		if summary == "" {
+			summary = "Follow-up"
+		}
+		description := details
+		if f.Notes != "" {
+			description = f.Notes + "\n\n" + details
+		}
+		w.event(calendarEvent{
+			UID:         fmt.Sprintf("followup-%d@%s", f.ID, host),
+			Start:       f.FollowUpOn,
+			End:         f.FollowUpOn.Add(calendarFollowUpLength),
+			Stamp:       f.UpdatedAt,
+			Summary:     summary + " – " + title,
+			Description: strings.TrimSpace(description + "\n" + leadURL(f.LeadID)),
+			Location:    location,
+			URL:         leadURL(f.LeadID),
+			Categories:  "Follow-up",
+		})
+	}
+
+	for _, i := range interactions {
+		title, details, location := calendarLeadText(&i.Lead)
+		description := details
+		if i.Summary != "" {
+			description = i.Summary + "\n\n" + details
+		}
+		if i.Details != "" {
+			description += "\n" + i.Details
+		}
+		w.event(calendarEvent{
+			UID:         fmt.Sprintf("interaction-%d@%s", i.ID, host),
+			Start:       i.Timestamp,
+			End:         i.Timestamp.Add(calendarInteractionLength),
+			Stamp:       i.UpdatedAt,
+			Summary:     i.Type + " – " + title,
+			Description: strings.TrimSpace(description + "\n" + leadURL(i.LeadID)),
+			Location:    location,
+			URL:         leadURL(i.LeadID),
+			Categories:  i.Type,
+		})
+	}
+	w.line("END", "VCALENDAR")
+
+	c.Set("Content-Type", "text/calendar; charset=utf-8")
+	c.Set("Content-Disposition", "inline; filename=\"crm.ics\"")
+	c.Set("Cache-Control", "no-cache")
+	return c.SendString(w.b.String())
+}
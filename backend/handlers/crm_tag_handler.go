@@ -101,6 +101,7 @@ func UpdateCRMTag(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "CRM Tag not found"})
 	}
 
+	oldTitle := tag.Title
 	if body.Code != nil {
 		tag.Code = *body.Code
 	}
@@ -114,17 +115,51 @@ func UpdateCRMTag(c *fiber.Ctx) error {
 		tag.Active = *body.Active
 	}
 
-	if err := crmTagDB.Save(&tag).Error; err != nil {
+	tx := crmTagDB.Begin()
+	if err := tx.Save(&tag).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	// Leads show tags by title, so a rename is carried into their tag text
+	if tag.Title != oldTitle {
+		if err := rewriteTaggedLeadsText(tx, tag.ID, oldTitle, tag.Title); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(tag)
 }
 
+// DeleteCRMTag removes a tag from every lead carrying it, then deletes the tag
 func DeleteCRMTag(c *fiber.Ctx) error {
 	id := c.Params("id")
 
-	if err := crmTagDB.Delete(&models.CRMTag{}, id).Error; err != nil {
+	var tag models.CRMTag
+	if err := crmTagDB.First(&tag, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "CRM Tag not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx := crmTagDB.Begin()
+	if err := rewriteTaggedLeadsText(tx, tag.ID, tag.Title, ""); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Exec("DELETE FROM lead_crm_tags WHERE crm_tag_id = ?", tag.ID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Delete(&tag).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit().Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
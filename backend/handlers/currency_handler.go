@@ -0,0 +1,487 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var currencyDB *gorm.DB
+
+func SetCurrencyDB(db *gorm.DB) {
+	currencyDB = db
+}
+
+/* ========== DTOs ========== */
+
+type CreateCurrencyRequest struct {
+	Code          string `json:"code"`
+	Name          string `json:"name"`
+	Symbol        string `json:"symbol"`
+	DecimalPlaces *int   `json:"decimal_places"`
+	Active        *bool  `json:"active"`
+}
+
+type UpdateCurrencyRequest struct {
+	Name          *string `json:"name"`
+	Symbol        *string `json:"symbol"`
+	DecimalPlaces *int    `json:"decimal_places"`
+	Active        *bool   `json:"active"`
+}
+
+type ExchangeRateRequest struct {
+	CurrencyCode string  `json:"currency_code"`
+	RateDate     string  `json:"rate_date"` // YYYY-MM-DD
+	Rate         float64 `json:"rate"`
+}
+
+/* ========== HELPERS ========== */
+
+var exchangeRateDateLayouts = []string{"2006-01-02", "02-01-2006", "02/01/2006", "2006/01/02", "02-Jan-2006"}
+
+func parseRateDate(val string) (time.Time, error) {
+	val = strings.TrimSpace(val)
+	for _, l := range exchangeRateDateLayouts {
+		if t, err := time.Parse(l, val); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", val)
+}
+
+// exchangeRateFor returns the INR value of one unit of a currency on a date,
+// using the latest rate entered on or before that date.
+func exchangeRateFor(db *gorm.DB, code string, date time.Time) (float64, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" || code == models.BaseCurrency {
+		return 1, nil
+	}
+
+	var rate models.ExchangeRate
+	if err := db.Where("currency_code = ? AND rate_date <= ?", code, date.Format("2006-01-02")).
+		Order("rate_date desc").
+		First(&rate).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, fmt.Errorf("no exchange rate for %s on or before %s", code, date.Format("2006-01-02"))
+		}
+		return 0, err
+	}
+	return rate.Rate, nil
+}
+
+// resolveQuotationExchangeRate normalises the quotation currency and fills in the
+// exchange rate for the quotation date when the client did not fix one.
+func resolveQuotationExchangeRate(db *gorm.DB, q *models.QuotationTable) error {
+	code := models.BaseCurrency
+	if q.Currency != nil && strings.TrimSpace(*q.Currency) != "" {
+		code = strings.ToUpper(strings.TrimSpace(*q.Currency))
+	}
+	q.Currency = &code
+
+	if code == models.BaseCurrency {
+		one := 1.0
+		q.ExchangeRate = &one
+		return nil
+	}
+
+	var currency models.Currency
+	if err := db.Where("code = ? AND active = true", code).First(&currency).Error; err != nil {
+		return fmt.Errorf("currency %s is not configured", code)
+	}
+
+	if q.ExchangeRate != nil && *q.ExchangeRate > 0 {
+		return nil
+	}
+	date := q.QuotationDate
+	if date.IsZero() {
+		date = time.Now()
+	}
+	rate, err := exchangeRateFor(db, code, date)
+	if err != nil {
+		return err
+	}
+	q.ExchangeRate = &rate
+	return nil
+}
+
+// applyBaseCurrencyTotals stores the quotation totals converted to INR
+func applyBaseCurrencyTotals(q *models.QuotationTable) {
+	rate := 1.0
+	if q.ExchangeRate != nil && *q.ExchangeRate > 0 {
+		rate = *q.ExchangeRate
+	}
+	q.BaseTotalAmount = round2(q.TotalAmount * rate)
+	q.BaseTaxAmount = round2(q.TaxAmount * rate)
+	q.BaseGrandTotal = round2(q.GrandTotal * rate)
+}
+
+/* ========== CURRENCY HANDLERS ========== */
+
+func CreateCurrency(c *fiber.Ctx) error {
+	var body CreateCurrencyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	body.Code = strings.ToUpper(strings.TrimSpace(body.Code))
+	if len(body.Code) != 3 || body.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "3 letter Code and Name are required"})
+	}
+
+	currency := models.Currency{
+		Code:          body.Code,
+		Name:          body.Name,
+		Symbol:        body.Symbol,
+		DecimalPlaces: 2,
+		IsBase:        body.Code == models.BaseCurrency,
+		Active:        true,
+	}
+	if body.DecimalPlaces != nil {
+		currency.DecimalPlaces = *body.DecimalPlaces
+	}
+	if body.Active != nil {
+		currency.Active = *body.Active
+	}
+
+	if err := currencyDB.Create(&currency).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(currency)
+}
+
+func GetCurrencies(c *fiber.Ctx) error {
+	var currencies []models.Currency
+
+	query := currencyDB.Order("code asc")
+	if c.Query("active") == "true" {
+		query = query.Where("active = true")
+	}
+
+	if err := query.Find(&currencies).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(currencies)
+}
+
+func GetCurrency(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var currency models.Currency
+
+	if err := currencyDB.First(&currency, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Currency not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(currency)
+}
+
+func UpdateCurrency(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body UpdateCurrencyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var currency models.Currency
+	if err := currencyDB.First(&currency, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Currency not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if body.Name != nil {
+		currency.Name = *body.Name
+	}
+	if body.Symbol != nil {
+		currency.Symbol = *body.Symbol
+	}
+	if body.DecimalPlaces != nil {
+		currency.DecimalPlaces = *body.DecimalPlaces
+	}
+	if body.Active != nil {
+		if currency.IsBase && !*body.Active {
+			return c.Status(400).JSON(fiber.Map{"error": "The base currency cannot be deactivated"})
+		}
+		currency.Active = *body.Active
+	}
+
+	if err := currencyDB.Save(&currency).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(currency)
+}
+
+func DeleteCurrency(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var currency models.Currency
+	if err := currencyDB.First(&currency, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Currency not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if currency.IsBase {
+		return c.Status(400).JSON(fiber.Map{"error": "The base currency cannot be deleted"})
+	}
+
+	var refCount int64
+	currencyDB.Model(&models.QuotationTable{}).Where("currency = ?", currency.Code).Count(&refCount)
+	if refCount > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot delete currency: referenced by existing quotations", "references": refCount})
+	}
+
+	if err := currencyDB.Delete(&currency).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Currency deleted successfully"})
+}
+
+/* ========== EXCHANGE RATE HANDLERS ========== */
+
+func CreateExchangeRate(c *fiber.Ctx) error {
+	var body ExchangeRateRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	rate, err := buildExchangeRate(body.CurrencyCode, body.RateDate, body.Rate)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	rate.Source = "manual"
+
+	// One rate per currency per day: entering it again replaces the old value
+	if err := currencyDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency_code"}, {Name: "rate_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+	}).Create(&rate).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(rate)
+}
+
+// GetExchangeRates lists rates. Query: currency, from, to (YYYY-MM-DD)
+func GetExchangeRates(c *fiber.Ctx) error {
+	var rates []models.ExchangeRate
+
+	query := currencyDB.Order("rate_date desc, currency_code asc")
+	if code := c.Query("currency"); code != "" {
+		query = query.Where("currency_code = ?", strings.ToUpper(code))
+	}
+	if from := c.Query("from"); from != "" {
+		query = query.Where("rate_date >= ?", from)
+	}
+	if to := c.Query("to"); to != "" {
+		query = query.Where("rate_date <= ?", to)
+	}
+
+	if err := query.Limit(c.QueryInt("limit", 500)).Find(&rates).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rates)
+}
+
+// GetLatestExchangeRate returns the rate used for a currency on a date. Query: currency, date
+func GetLatestExchangeRate(c *fiber.Ctx) error {
+	code := strings.ToUpper(c.Query("currency"))
+	if code == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "currency is required"})
+	}
+
+	date := time.Now()
+	if d := c.Query("date"); d != "" {
+		parsed, err := parseRateDate(d)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		date = parsed
+	}
+
+	rate, err := exchangeRateFor(currencyDB, code, date)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"currency": code,
+		"date":     date.Format("2006-01-02"),
+		"rate":     rate,
+	})
+}
+
+func UpdateExchangeRate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body ExchangeRateRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var rate models.ExchangeRate
+	if err := currencyDB.First(&rate, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Exchange rate not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if body.Rate <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "rate must be greater than 0"})
+	}
+	rate.Rate = body.Rate
+	rate.Source = "manual"
+
+	if err := currencyDB.Save(&rate).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rate)
+}
+
+func DeleteExchangeRate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	if err := currencyDB.Delete(&models.ExchangeRate{}, id).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Exchange rate deleted successfully"})
+}
+
+// ImportExchangeRates imports a CSV file (form field "file") with the columns
+// currency, date, rate. Existing rates for the same currency and date are replaced.
+func ImportExchangeRates(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "CSV file is required"})
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+
+	headers, err := r.Read()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid CSV: " + err.Error()})
+	}
+	idx := make(map[string]int)
+	for i, h := range headers {
+		idx[strings.ToLower(strings.Trim(strings.TrimSpace(h), "\ufeff"))] = i
+	}
+	col := func(rec []string, names ...string) string {
+		for _, n := range names {
+			if i, ok := idx[n]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+		}
+		return ""
+	}
+
+	var rates []models.ExchangeRate
+	var rateRows []int
+	var errors []map[string]interface{}
+	// One upsert cannot touch the same (currency, date) twice: the last row for a date wins
+	seen := make(map[string]int)
+	row := 1
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			errors = append(errors, map[string]interface{}{"row": row, "error": err.Error()})
+			continue
+		}
+
+		rateVal, perr := strconv.ParseFloat(col(rec, "rate", "exchange_rate", "inr"), 64)
+		if perr != nil {
+			errors = append(errors, map[string]interface{}{"row": row, "error": "invalid rate"})
+			continue
+		}
+		rate, berr := buildExchangeRate(col(rec, "currency", "currency_code", "code"), col(rec, "date", "rate_date"), rateVal)
+		if berr != nil {
+			errors = append(errors, map[string]interface{}{"row": row, "error": berr.Error()})
+			continue
+		}
+		rate.Source = "csv"
+
+		key := rate.CurrencyCode + "|" + rate.RateDate.Format("2006-01-02")
+		if i, ok := seen[key]; ok {
+			errors = append(errors, map[string]interface{}{"row": rateRows[i], "error": fmt.Sprintf("replaced by row %d for the same currency and date", row)})
+			rates[i] = rate
+			rateRows[i] = row
+			continue
+		}
+		seen[key] = len(rates)
+		rates = append(rates, rate)
+		rateRows = append(rateRows, row)
+	}
+
+	if len(rates) > 0 {
+		tx := currencyDB.Begin()
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "currency_code"}, {Name: "rate_date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+		}).CreateInBatches(&rates, 200).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := tx.Commit().Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"imported": len(rates),
+		"failed":   len(errors),
+		"errors":   errors,
+	})
+}
+
+// buildExchangeRate validates an exchange rate entry against the currency master
+func buildExchangeRate(code, date string, value float64) (models.ExchangeRate, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" || code == models.BaseCurrency {
+		return models.ExchangeRate{}, fmt.Errorf("a foreign currency code is required")
+	}
+	if value <= 0 {
+		return models.ExchangeRate{}, fmt.Errorf("rate must be greater than 0")
+	}
+	rateDate, err := parseRateDate(date)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	var count int64
+	currencyDB.Model(&models.Currency{}).Where("code = ?", code).Count(&count)
+	if count == 0 {
+		return models.ExchangeRate{}, fmt.Errorf("currency %s is not configured", code)
+	}
+
+	return models.ExchangeRate{CurrencyCode: code, RateDate: rateDate, Rate: value}, nil
+}
@@ -0,0 +1,995 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var emailInboxDB *gorm.DB
+
+func SetEmailInboxDB(db *gorm.DB) {
+	emailInboxDB = db
+}
+
+const (
+	// Messages read per pass; the rest follow on the next one
+	emailInboxBatch = 50
+	// First read of a mailbox goes this far back
+	emailInboxLookback = 7 * 24 * time.Hour
+	// Runes of a message body kept on the interaction
+	emailInboxBodyLimit = 20000
+	// Attachments stay outside the public /uploads root and are served by GetInboundEmailAttachment
+	emailInboxUploadDir = "storage/emails"
+)
+
+// Subject given to mail kept in triage because it could not be read or stored
+const unreadableEmailSubject = "(unreadable message)"
+
+// Only one read per integration at a time (schedule and manual trigger share this)
+var emailInboxRunning sync.Map
+
+/* ========== DTOs ========== */
+
+type emailInboxConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	Security string // tls | starttls | none
+	Mailbox  string
+	MarkSeen bool
+	Interval time.Duration
+}
+
+type emailInboxRun struct {
+	IntegrationID uint   `json:"integration_id"`
+	Fetched       int    `json:"fetched"`
+	Matched       int    `json:"matched"`
+	Unmatched     int    `json:"unmatched"`
+	Skipped       int    `json:"skipped"`
+	LastUID       uint32 `json:"last_uid"`
+}
+
+type inboundAttachment struct {
+	FileName    string `json:"file_name"`
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+}
+
+type parsedEmail struct {
+	MessageID   string
+	FromAddress string
+	FromName    string
+	To          string
+	Subject     string
+	Body        string
+	Date        time.Time
+	Attachments []parsedAttachment
+}
+
+type parsedAttachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+type inboundEmailMatch struct {
+	LeadID      *uint
+	CustomerID  *uint
+	QuotationID *uint
+	By          string
+}
+
+type AssignInboundEmailRequest struct {
+	LeadID uint  `json:"lead_id"`
+	UserID *uint `json:"user_id"`
+}
+
+/* ========== SCHEDULER ========== */
+
+// emailInboxSettings reads the IMAP settings of an email integration (config: imap_host,
+// imap_port, imap_username, imap_password, imap_security, mailbox, mark_seen, poll_minutes).
+// Username and password fall back to the SMTP ones; ok is false when no IMAP host is set.
+func emailInboxSettings(integration models.Integration) (emailInboxConfig, bool) {
+	raw := integration.Config
+	cfg := emailInboxConfig{
+		Host:     integrationConfigString(raw, "imap_host"),
+		Port:     integrationConfigString(raw, "imap_port"),
+		Username: integrationConfigString(raw, "imap_username", "username", "user"),
+		Password: integrationConfigString(raw, "imap_password", "password", "app_password"),
+		Security: strings.ToLower(integrationConfigString(raw, "imap_security")),
+		Mailbox:  integrationConfigString(raw, "mailbox", "imap_mailbox"),
+		MarkSeen: integrationConfigString(raw, "mark_seen") == "true",
+		Interval: 5 * time.Minute,
+	}
+	if cfg.Host == "" {
+		return cfg, false
+	}
+	if cfg.Port == "" {
+		cfg.Port = "993"
+	}
+	if cfg.Security == "" {
+		cfg.Security = "starttls"
+		if cfg.Port == "993" {
+			cfg.Security = "tls"
+		}
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if m, err := strconv.Atoi(integrationConfigString(raw, "poll_minutes")); err == nil && m > 0 {
+		cfg.Interval = time.Duration(m) * time.Minute
+	}
+	return cfg, true
+}
+
+// StartEmailInboxScheduler reads new mail for every active email integration that has IMAP
+// settings, each on its own interval (poll_minutes, default 5)
+func StartEmailInboxScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			pollEmailInboxes()
+			<-ticker.C
+		}
+	}()
+}
+
+func pollEmailInboxes() {
+	var integrations []models.Integration
+	if err := emailInboxDB.Where("type = ? AND is_active = true", "email").Find(&integrations).Error; err != nil {
+		log.Printf("email inbox: failed to load integrations: %v", err)
+		return
+	}
+
+	for _, integration := range integrations {
+		cfg, ok := emailInboxSettings(integration)
+		if !ok {
+			continue
+		}
+
+		var state models.EmailSyncState
+		if err := emailInboxDB.Where("integration_id = ?", integration.ID).First(&state).Error; err == nil &&
+			state.LastRunAt != nil && time.Since(*state.LastRunAt) < cfg.Interval {
+			continue
+		}
+
+		go func(integration models.Integration) {
+			run, err := runEmailInboxSync(integration)
+			if err != nil {
+				log.Printf("email inbox: integration %d failed: %v", integration.ID, err)
+				return
+			}
+			if run.Fetched > 0 {
+				log.Printf("email inbox: integration %d fetched %d, matched %d, unmatched %d", integration.ID, run.Fetched, run.Matched, run.Unmatched)
+			}
+		}(integration)
+	}
+}
+
+/* ========== SYNC ========== */
+
+// runEmailInboxSync reads messages newer than the stored UID, files each one on its lead or in
+// the triage queue, and advances the UID past every message it stored
+func runEmailInboxSync(integration models.Integration) (emailInboxRun, error) {
+	run := emailInboxRun{IntegrationID: integration.ID}
+
+	cfg, ok := emailInboxSettings(integration)
+	if !ok {
+		return run, fmt.Errorf("email integration %d has no imap_host", integration.ID)
+	}
+	if _, busy := emailInboxRunning.LoadOrStore(integration.ID, true); busy {
+		return run, fmt.Errorf("a mailbox read for integration %d is already running", integration.ID)
+	}
+	defer emailInboxRunning.Delete(integration.ID)
+
+	state := models.EmailSyncState{IntegrationID: integration.ID}
+	if err := emailInboxDB.Where("integration_id = ?", integration.ID).FirstOrCreate(&state).Error; err != nil {
+		return run, err
+	}
+
+	err := readEmailInbox(integration, cfg, &state, &run)
+
+	now := time.Now()
+	state.LastRunAt = &now
+	state.LastStatus = "success"
+	state.LastError = ""
+	if err != nil {
+		state.LastStatus = "failed"
+		state.LastError = err.Error()
+	}
+	if saveErr := emailInboxDB.Save(&state).Error; saveErr != nil {
+		log.Printf("email inbox: failed to save state for integration %d: %v", integration.ID, saveErr)
+	}
+	run.LastUID = state.LastUID
+	return run, err
+}
+
+func readEmailInbox(integration models.Integration, cfg emailInboxConfig, state *models.EmailSyncState, run *emailInboxRun) error {
+	client, err := dialIMAP(cfg.Host, cfg.Port, cfg.Security)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Login(cfg.Username, cfg.Password); err != nil {
+		return err
+	}
+	defer client.Logout()
+
+	uidValidity, err := client.Select(cfg.Mailbox)
+	if err != nil {
+		return err
+	}
+	// A new UIDVALIDITY means old UIDs are meaningless; start over from the lookback window
+	// (Message-ID dedupe keeps already stored mail out)
+	if state.Mailbox != cfg.Mailbox || state.UIDValidity != uidValidity {
+		state.Mailbox = cfg.Mailbox
+		state.UIDValidity = uidValidity
+		state.LastUID = 0
+	}
+
+	criteria := "SINCE " + time.Now().Add(-emailInboxLookback).Format("02-Jan-2006")
+	if state.LastUID > 0 {
+		criteria = fmt.Sprintf("UID %d:*", state.LastUID+1)
+	}
+	found, err := client.SearchUIDs(criteria)
+	if err != nil {
+		return err
+	}
+
+	// "n:*" always includes the newest message, even when it is older than n
+	var uids []uint32
+	for _, uid := range found {
+		if uid > state.LastUID {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	if len(uids) > emailInboxBatch {
+		uids = uids[:emailInboxBatch]
+	}
+
+	for _, uid := range uids {
+		raw, internalDate, err := client.FetchMessage(uid)
+		if err != nil {
+			return err
+		}
+		run.Fetched++
+
+		status, err := ingestInboundEmail(emailInboxDB, integration.ID, uidValidity, uid, raw, internalDate)
+		if err != nil {
+			// One message the database refuses must not hold back the rest of the mailbox
+			log.Printf("email inbox: integration %d message %d could not be stored: %v", integration.ID, uid, err)
+			if ferr := fileUnreadableInboundEmail(emailInboxDB, integration.ID, uidValidity, uid, internalDate, err); ferr != nil {
+				return fmt.Errorf("message %d: %w", uid, err)
+			}
+			status = "unmatched"
+		}
+		switch status {
+		case "matched":
+			run.Matched++
+		case "unmatched":
+			run.Unmatched++
+		default:
+			run.Skipped++
+		}
+		state.LastUID = uid
+
+		if cfg.MarkSeen {
+			if err := client.MarkSeen(uid); err != nil {
+				log.Printf("email inbox: failed to mark message %d seen: %v", uid, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fileUnreadableInboundEmail puts a message that could not be stored into triage with just
+// the reason, so the mailbox read can move past it
+func fileUnreadableInboundEmail(db *gorm.DB, integrationID uint, uidValidity, uid uint32, internalDate time.Time, cause error) error {
+	received := internalDate
+	if received.IsZero() {
+		received = time.Now()
+	}
+	email := models.InboundEmail{
+		IntegrationID: integrationID,
+		UIDValidity:   uidValidity,
+		UID:           uid,
+		Subject:       unreadableEmailSubject,
+		Body:          cleanEmailText(cause.Error()),
+		ReceivedAt:    received,
+		Status:        "unmatched",
+	}
+	return db.Create(&email).Error
+}
+
+// ingestInboundEmail stores one message and, when it can be matched, logs it on the lead.
+// Returns matched, unmatched or skipped (already stored).
+func ingestInboundEmail(db *gorm.DB, integrationID uint, uidValidity, uid uint32, raw []byte, internalDate time.Time) (string, error) {
+	var count int64
+	if err := db.Model(&models.InboundEmail{}).
+		Where("integration_id = ? AND uid_validity = ? AND uid = ?", integrationID, uidValidity, uid).
+		Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "skipped", nil
+	}
+
+	msg, parseErr := parseInboundEmail(raw)
+	if parseErr != nil {
+		// Keep unreadable mail visible in triage rather than losing it
+		msg.Subject = unreadableEmailSubject
+		msg.Body = parseErr.Error()
+	}
+	if msg.MessageID != "" {
+		if err := db.Model(&models.InboundEmail{}).
+			Where("integration_id = ? AND message_id = ?", integrationID, msg.MessageID).
+			Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return "skipped", nil
+		}
+	}
+
+	received := msg.Date
+	if received.IsZero() {
+		received = internalDate
+	}
+	if received.IsZero() {
+		received = time.Now()
+	}
+
+	match, err := matchInboundEmail(db, msg.Subject, msg.FromAddress)
+	if err != nil {
+		return "", err
+	}
+
+	email := models.InboundEmail{
+		IntegrationID: integrationID,
+		UIDValidity:   uidValidity,
+		UID:           uid,
+		MessageID:     truncateRunes(msg.MessageID, 255),
+		FromAddress:   truncateRunes(msg.FromAddress, 255),
+		FromName:      truncateRunes(msg.FromName, 255),
+		To:            msg.To,
+		Subject:       msg.Subject,
+		Body:          truncateRunes(msg.Body, emailInboxBodyLimit),
+		ReceivedAt:    received,
+		Status:        "unmatched",
+		LeadID:        match.LeadID,
+		CustomerID:    match.CustomerID,
+		QuotationID:   match.QuotationID,
+	}
+
+	tx := db.Begin()
+	if err := tx.Create(&email).Error; err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	dir := filepath.Join(emailInboxUploadDir, strconv.FormatUint(uint64(email.ID), 10))
+	if len(msg.Attachments) > 0 {
+		saved, err := saveInboundAttachments(dir, msg.Attachments)
+		if err != nil {
+			tx.Rollback()
+			os.RemoveAll(dir)
+			return "", err
+		}
+		email.Attachments, _ = json.Marshal(saved)
+	}
+
+	var lead models.Lead
+	if match.LeadID != nil {
+		if err := tx.First(&lead, *match.LeadID).Error; err != nil {
+			tx.Rollback()
+			os.RemoveAll(dir)
+			return "", err
+		}
+		if err := logInboundEmailInteraction(tx, &email, &lead); err != nil {
+			tx.Rollback()
+			os.RemoveAll(dir)
+			return "", err
+		}
+		email.Status = "matched"
+		email.MatchedBy = match.By
+	}
+
+	if err := tx.Save(&email).Error; err != nil {
+		tx.Rollback()
+		os.RemoveAll(dir)
+		return "", err
+	}
+	if err := tx.Commit().Error; err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	if email.Status == "matched" {
+		touchLeadScore(lead.ID)
+		notifyInboundEmail(db, &email, &lead)
+	}
+	return email.Status, nil
+}
+
+// logInboundEmailInteraction records a message as an email interaction on the lead, owned by
+// the lead's assignee
+func logInboundEmailInteraction(db *gorm.DB, email *models.InboundEmail, lead *models.Lead) error {
+	summary := "Email from " + email.FromAddress
+	if email.Subject != "" {
+		summary += ": " + email.Subject
+	}
+
+	details := email.Body
+	var attachments []inboundAttachment
+	if len(email.Attachments) > 0 && json.Unmarshal(email.Attachments, &attachments) == nil && len(attachments) > 0 {
+		details += "\n\nAttachments:"
+		for i, a := range attachments {
+			details += fmt.Sprintf("\n%s: /api/inbound-emails/%d/attachments/%d", a.FileName, email.ID, i+1)
+		}
+	}
+
+	interaction := models.LeadInteraction{
+		LeadID:       lead.ID,
+		AssignedToID: lead.AssignedToID,
+		Type:         "email",
+		Summary:      truncateRunes(summary, 250),
+		Details:      details,
+		Timestamp:    email.ReceivedAt,
+	}
+	if err := db.Create(&interaction).Error; err != nil {
+		return err
+	}
+
+	email.LeadID = &lead.ID
+	email.InteractionID = &interaction.ID
+	if email.CustomerID == nil {
+		email.CustomerID = lead.CustomerID
+	}
+	return nil
+}
+
+func notifyInboundEmail(db *gorm.DB, email *models.InboundEmail, lead *models.Lead) {
+	if lead.AssignedToID == nil {
+		return
+	}
+	name := lead.Business
+	if name == "" {
+		name = lead.Name
+	}
+	text := fmt.Sprintf("%s wrote about lead #%d %s", email.FromAddress, lead.ID, name)
+	if email.Subject != "" {
+		text += ": " + email.Subject
+	}
+	if err := notifyUser(db, *lead.AssignedToID, "lead_email", "New email", text, "lead", &lead.ID); err != nil {
+		log.Printf("email inbox: failed to notify user %d: %v", *lead.AssignedToID, err)
+	}
+}
+
+/* ========== MATCHING ========== */
+
+// Tokens in a subject that could be a quotation number: letters, digits and / - _ . with at least one digit
+var quotationNumberToken = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9/_.\-]*[0-9][A-Za-z0-9/_.\-]*`)
+
+func quotationNumberCandidates(subject string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range quotationNumberToken.FindAllString(subject, 20) {
+		t = strings.ToUpper(strings.TrimRight(t, "./-_"))
+		if len(t) >= 3 && !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// matchInboundEmail finds the lead a message belongs to. A quotation number in the subject wins;
+// otherwise the sender address is looked up on leads, then on customers with a converted lead.
+func matchInboundEmail(db *gorm.DB, subject, from string) (inboundEmailMatch, error) {
+	var match inboundEmailMatch
+
+	// Latest lead converted into a customer
+	customerLead := func(customerID uint) (*uint, error) {
+		var lead models.Lead
+		err := db.Select("id").Where("customer_id = ?", customerID).Order("updated_at desc").First(&lead).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &lead.ID, nil
+	}
+
+	if candidates := quotationNumberCandidates(subject); len(candidates) > 0 {
+		var quotation models.QuotationTable
+		err := db.Select("quotation_id", "customer_id", "lead_id").
+			Where("UPPER(quotation_number) IN ?", candidates).
+			Order("quotation_id desc").First(&quotation).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return match, err
+		}
+		if err == nil {
+			match.By = "quotation"
+			match.QuotationID = &quotation.QuotationID
+			match.CustomerID = &quotation.CustomerID
+			match.LeadID = quotation.LeadID
+			if match.LeadID == nil {
+				if match.LeadID, err = customerLead(quotation.CustomerID); err != nil {
+					return match, err
+				}
+			}
+			if match.LeadID != nil {
+				return match, nil
+			}
+		}
+	}
+
+	if from == "" {
+		return match, nil
+	}
+
+	var lead models.Lead
+	err := db.Select("id", "customer_id").Where("LOWER(TRIM(email)) = ?", from).
+		Order("updated_at desc").First(&lead).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return match, err
+	}
+	if err == nil {
+		match.By = "sender"
+		match.LeadID = &lead.ID
+		if match.CustomerID == nil {
+			match.CustomerID = lead.CustomerID
+		}
+		return match, nil
+	}
+
+	var customer models.User
+	err = db.Select("id").Where("LOWER(email) = ?", from).First(&customer).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return match, err
+	}
+	if err == nil {
+		leadID, err := customerLead(customer.ID)
+		if err != nil {
+			return match, err
+		}
+		if leadID != nil {
+			match.By = "sender"
+			match.LeadID = leadID
+			match.CustomerID = &customer.ID
+		}
+	}
+	return match, nil
+}
+
+/* ========== PARSING ========== */
+
+var emailWordDecoder = &mime.WordDecoder{CharsetReader: emailCharsetReader}
+
+// emailCharsetReader converts the single byte charsets mail clients still use; UTF-8 and
+// US-ASCII are handled by the decoder itself
+func emailCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(emailText(data, charset)), nil
+}
+
+// emailText decodes body text in the given charset; anything unknown is read as UTF-8
+func emailText(data []byte, charset string) string {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return cleanEmailText(string(runes))
+	}
+	return cleanEmailText(string(data))
+}
+
+// cleanEmailText drops NUL bytes and replaces invalid UTF-8; Postgres text columns take neither
+func cleanEmailText(s string) string {
+	return strings.ToValidUTF8(strings.ReplaceAll(s, "\x00", ""), "\uFFFD")
+}
+
+func emailHeader(h mail.Header, key string) string {
+	v := h.Get(key)
+	if d, err := emailWordDecoder.DecodeHeader(v); err == nil {
+		v = d
+	}
+	return strings.TrimSpace(cleanEmailText(v))
+}
+
+// parseInboundEmail reads the headers, the text body (plain preferred over HTML) and the
+// attachments of a raw message
+func parseInboundEmail(raw []byte) (parsedEmail, error) {
+	var p parsedEmail
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return p, err
+	}
+
+	p.MessageID = strings.Trim(cleanEmailText(msg.Header.Get("Message-Id")), "<> ")
+	p.Subject = emailHeader(msg.Header, "Subject")
+	p.To = emailHeader(msg.Header, "To")
+	parser := mail.AddressParser{WordDecoder: emailWordDecoder}
+	if from, err := parser.Parse(msg.Header.Get("From")); err == nil {
+		p.FromAddress = strings.ToLower(cleanEmailText(from.Address))
+		p.FromName = cleanEmailText(from.Name)
+	} else {
+		p.FromAddress = strings.ToLower(strings.Trim(emailHeader(msg.Header, "From"), "<> "))
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		p.Date = date
+	}
+
+	var plain, htmlBody string
+	if err := walkEmailPart(textproto.MIMEHeader(msg.Header), msg.Body, &plain, &htmlBody, &p.Attachments, 0); err != nil {
+		return p, err
+	}
+	p.Body = strings.TrimSpace(cleanEmailText(plain))
+	if p.Body == "" {
+		p.Body = htmlToText(cleanEmailText(htmlBody))
+	}
+	for i := range p.Attachments {
+		p.Attachments[i].FileName = cleanEmailText(p.Attachments[i].FileName)
+		p.Attachments[i].ContentType = cleanEmailText(p.Attachments[i].ContentType)
+	}
+	return p, nil
+}
+
+func walkEmailPart(header textproto.MIMEHeader, body io.Reader, plain, htmlBody *string, attachments *[]parsedAttachment, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType == "" {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" && depth < 10 {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkEmailPart(part.Header, part, plain, htmlBody, attachments, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	fileName := dparams["filename"]
+	if fileName == "" {
+		fileName = params["name"]
+	}
+	if d, err := emailWordDecoder.DecodeHeader(fileName); err == nil {
+		fileName = d
+	}
+
+	isText := mediaType == "text/plain" || mediaType == "text/html"
+	if disposition != "attachment" && fileName == "" && isText {
+		text := emailText(data, params["charset"])
+		if mediaType == "text/plain" && *plain == "" {
+			*plain = text
+		} else if mediaType == "text/html" && *htmlBody == "" {
+			*htmlBody = text
+		}
+		return nil
+	}
+
+	if fileName == "" {
+		ext := ".bin"
+		if mediaType == "message/rfc822" {
+			ext = ".eml"
+		} else if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			ext = exts[0]
+		}
+		fileName = fmt.Sprintf("attachment-%d%s", len(*attachments)+1, ext)
+	}
+	*attachments = append(*attachments, parsedAttachment{FileName: fileName, ContentType: mediaType, Data: data})
+	return nil
+}
+
+var (
+	htmlDropBlocks = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	htmlLineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|tr|li|h[1-6])>`)
+	htmlTags       = regexp.MustCompile(`<[^>]*>`)
+	blankLines     = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+)
+
+// htmlToText flattens an HTML body into readable text
+func htmlToText(s string) string {
+	s = htmlDropBlocks.ReplaceAllString(s, "")
+	s = htmlLineBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	s = html.UnescapeString(strings.ReplaceAll(s, "\r", ""))
+	return strings.TrimSpace(blankLines.ReplaceAllString(s, "\n\n"))
+}
+
+// saveInboundAttachments writes attachments under dir, numbered so names cannot collide
+func saveInboundAttachments(dir string, parts []parsedAttachment) ([]inboundAttachment, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	saved := make([]inboundAttachment, 0, len(parts))
+	for i, part := range parts {
+		name := strings.Map(func(r rune) rune {
+			if r < 32 || strings.ContainsRune(`/\:*?"<>|`, r) {
+				return '_'
+			}
+			return r
+		}, filepath.Base(part.FileName))
+		name = truncateRunes(strings.TrimLeft(name, "."), 150)
+		if name == "" {
+			name = "attachment"
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%d_%s", i+1, name))
+		if err := os.WriteFile(path, part.Data, 0640); err != nil {
+			return nil, err
+		}
+		saved = append(saved, inboundAttachment{
+			FileName:    part.FileName,
+			Path:        filepath.ToSlash(path),
+			ContentType: part.ContentType,
+			Size:        len(part.Data),
+		})
+	}
+	return saved, nil
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
+
+/* ========== HANDLERS ========== */
+
+// SyncEmailInbox reads new mail for one email integration immediately. Point imap_host at a
+// local server (imap_security "none") to try it without a real mailbox.
+func SyncEmailInbox(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var integration models.Integration
+	if err := emailInboxDB.First(&integration, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Integration not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if integration.Type != "email" {
+		return c.Status(400).JSON(fiber.Map{"error": "Integration is not an email integration"})
+	}
+	if _, ok := emailInboxSettings(integration); !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Integration has no imap_host configured"})
+	}
+
+	run, err := runEmailInboxSync(integration)
+	if err != nil {
+		return c.Status(502).JSON(fiber.Map{"error": err.Error(), "run": run})
+	}
+
+	return c.JSON(run)
+}
+
+// GetEmailSyncState returns how far an integration's mailbox has been read
+func GetEmailSyncState(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var state models.EmailSyncState
+	if err := emailInboxDB.Where("integration_id = ?", id).First(&state).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Mailbox has not been read yet"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(state)
+}
+
+// GetInboundEmails lists pulled mail, newest first. The triage queue is the default
+// (status=unmatched). Query: status (or "all"), integration_id, lead_id, limit
+func GetInboundEmails(c *fiber.Ctx) error {
+	query := emailInboxDB.Order("received_at desc")
+
+	status := c.Query("status", "unmatched")
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if integrationID := c.QueryInt("integration_id", 0); integrationID > 0 {
+		query = query.Where("integration_id = ?", integrationID)
+	}
+	if leadID := c.QueryInt("lead_id", 0); leadID > 0 {
+		query = query.Where("lead_id = ?", leadID)
+	}
+
+	var emails []models.InboundEmail
+	if err := query.Limit(c.QueryInt("limit", 100)).Find(&emails).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(emails)
+}
+
+func GetInboundEmail(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var email models.InboundEmail
+	if err := emailInboxDB.First(&email, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Email not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(email)
+}
+
+// GetInboundEmailAttachment downloads attachment n (1-based) of an inbound email
+func GetInboundEmailAttachment(c *fiber.Ctx) error {
+	id := c.Params("id")
+	n, err := strconv.Atoi(c.Params("n"))
+	if err != nil || n < 1 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid attachment number"})
+	}
+
+	var email models.InboundEmail
+	if err := emailInboxDB.First(&email, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Email not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var attachments []inboundAttachment
+	if len(email.Attachments) > 0 {
+		if err := json.Unmarshal(email.Attachments, &attachments); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if n > len(attachments) {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+	a := attachments[n-1]
+
+	// Only files this email wrote under its own directory are served
+	dir := filepath.Join(emailInboxUploadDir, strconv.FormatUint(uint64(email.ID), 10))
+	path := filepath.Clean(filepath.FromSlash(a.Path))
+	if filepath.Dir(path) != dir {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+
+	// Always a download, never rendered inline by the browser
+	c.Set("X-Content-Type-Options", "nosniff")
+	c.Attachment(a.FileName)
+	if err := c.SendFile(path); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+	return nil
+}
+
+// AssignInboundEmail files a triaged message on a lead as an email interaction
+func AssignInboundEmail(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body AssignInboundEmailRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if body.LeadID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "lead_id is required"})
+	}
+
+	var email models.InboundEmail
+	if err := emailInboxDB.First(&email, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Email not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if email.InteractionID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Email is already logged on a lead", "lead_id": email.LeadID})
+	}
+
+	var lead models.Lead
+	if err := emailInboxDB.First(&lead, body.LeadID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx := emailInboxDB.Begin()
+	if err := logInboundEmailInteraction(tx, &email, &lead); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	email.Status = "assigned"
+	email.MatchedBy = "manual"
+	if err := tx.Save(&email).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := recordAudit(tx, body.UserID, "inbound_email.assign", "lead", &lead.ID, fiber.Map{"inbound_email_id": email.ID}); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	touchLeadScore(lead.ID)
+
+	return c.JSON(email)
+}
+
+// IgnoreInboundEmail drops a message from the triage queue
+func IgnoreInboundEmail(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var email models.InboundEmail
+	if err := emailInboxDB.First(&email, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Email not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if email.InteractionID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Email is already logged on a lead", "lead_id": email.LeadID})
+	}
+
+	if err := emailInboxDB.Model(&email).Update("status", "ignored").Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(email)
+}
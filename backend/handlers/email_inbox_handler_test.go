@@ -0,0 +1,547 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"erp.local/backend/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/* ========== FAKE DATABASE ========== */
+
+// fakeSQL answers every statement without a server: counts are zero, inserts return the next
+// id, updates touch one row and selects find rows only where rowsFor says so. failOn can make
+// a statement fail. Statements are recorded so a test can check what was written.
+type fakeSQL struct {
+	mu      sync.Mutex
+	nextID  int64
+	count   int64
+	rowsFor func(query string) ([]string, [][]driver.Value)
+	failOn  func(query string, args []driver.Value) error
+	log     []fakeStatement
+}
+
+type fakeStatement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// record logs a statement and returns the error failOn picks for it, if any
+func (f *fakeSQL) record(query string, args []driver.NamedValue) error {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	f.mu.Lock()
+	f.log = append(f.log, fakeStatement{Query: query, Args: values})
+	failOn := f.failOn
+	f.mu.Unlock()
+	if failOn != nil {
+		return failOn(query, values)
+	}
+	return nil
+}
+
+// statements returns the recorded statements that start with prefix and mention table
+func (f *fakeSQL) statements(prefix, table string) []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []fakeStatement
+	for _, s := range f.log {
+		if strings.HasPrefix(s.Query, prefix) && strings.Contains(s.Query, `"`+table+`"`) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func (f *fakeSQL) Connect(context.Context) (driver.Conn, error) { return &fakeSQLConn{db: f}, nil }
+func (f *fakeSQL) Driver() driver.Driver                        { return fakeSQLDriver{} }
+
+type fakeSQLDriver struct{}
+
+func (fakeSQLDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake sql: open through the connector")
+}
+
+type fakeSQLConn struct{ db *fakeSQL }
+
+func (c *fakeSQLConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake sql: prepared statements are not supported")
+}
+func (c *fakeSQLConn) Close() error              { return nil }
+func (c *fakeSQLConn) Begin() (driver.Tx, error) { return fakeSQLTx{c.db}, nil }
+
+func (c *fakeSQLConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.db.record(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeSQLConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.db.record(query, args); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(query, "SELECT count(*)"):
+		c.db.mu.Lock()
+		defer c.db.mu.Unlock()
+		return &fakeSQLRows{columns: []string{"count"}, values: [][]driver.Value{{c.db.count}}}, nil
+	case strings.HasPrefix(query, "INSERT") && strings.Contains(query, " RETURNING "):
+		var columns []string
+		for _, col := range strings.Split(query[strings.LastIndex(query, " RETURNING ")+len(" RETURNING "):], ",") {
+			columns = append(columns, strings.Trim(strings.TrimSpace(col), `"`))
+		}
+		c.db.mu.Lock()
+		c.db.nextID++
+		id := c.db.nextID
+		c.db.mu.Unlock()
+		row := make([]driver.Value, len(columns))
+		for i, col := range columns {
+			if col == "id" || col == "quotation_id" {
+				row[i] = id
+			}
+		}
+		return &fakeSQLRows{columns: columns, values: [][]driver.Value{row}}, nil
+	case c.db.rowsFor != nil:
+		columns, values := c.db.rowsFor(query)
+		return &fakeSQLRows{columns: columns, values: values}, nil
+	}
+	return &fakeSQLRows{}, nil
+}
+
+type fakeSQLTx struct{ db *fakeSQL }
+
+func (t fakeSQLTx) Commit() error {
+	return t.db.record("COMMIT", nil)
+}
+
+func (t fakeSQLTx) Rollback() error {
+	return t.db.record("ROLLBACK", nil)
+}
+
+type fakeSQLRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string { return r.columns }
+func (r *fakeSQLRows) Close() error      { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// openFakeDB opens gorm on a new fake database
+func openFakeDB(t *testing.T) (*gorm.DB, *fakeSQL) {
+	t.Helper()
+
+	fake := &fakeSQL{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(fake)}), &gorm.Config{
+		Logger:               logger.Default.LogMode(logger.Silent),
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("open fake database: %v", err)
+	}
+	return db, fake
+}
+
+// useFakeEmailInboxDB points the inbox at a fake database for the length of the test
+func useFakeEmailInboxDB(t *testing.T) *fakeSQL {
+	t.Helper()
+
+	db, fake := openFakeDB(t)
+	prev := emailInboxDB
+	emailInboxDB = db
+	t.Cleanup(func() { emailInboxDB = prev })
+	return fake
+}
+
+/* ========== IMAP RESPONDER ========== */
+
+// imapResponder is an in-process IMAP server holding one mailbox. It speaks just the commands
+// imapClient sends and records them.
+type imapResponder struct {
+	ln          net.Listener
+	uidValidity uint32
+	messages    map[uint32]string
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newIMAPResponder(t *testing.T, uidValidity uint32, messages map[uint32]string) *imapResponder {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &imapResponder{ln: ln, uidValidity: uidValidity, messages: messages}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *imapResponder) config() emailInboxConfig {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return emailInboxConfig{Host: host, Port: port, Security: "none", Username: "sales", Password: "secret", Mailbox: "INBOX", MarkSeen: true}
+}
+
+func (s *imapResponder) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *imapResponder) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, format+"\r\n", args...)
+	}
+
+	reply("* OK test IMAP ready")
+	w.Flush()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+
+		upper := strings.ToUpper(command)
+		switch {
+		case strings.HasPrefix(upper, "LOGIN "):
+			if command != `LOGIN "sales" "secret"` {
+				reply("%s NO [AUTHENTICATIONFAILED] invalid credentials", tag)
+				break
+			}
+			reply("%s OK LOGIN completed", tag)
+		case strings.HasPrefix(upper, "SELECT "):
+			reply("* %d EXISTS", len(s.messages))
+			reply("* OK [UIDVALIDITY %d] UIDs valid", s.uidValidity)
+			reply("%s OK [READ-WRITE] SELECT completed", tag)
+		case strings.HasPrefix(upper, "UID SEARCH "):
+			reply("* SEARCH%s", s.search(command[len("UID SEARCH "):]))
+			reply("%s OK SEARCH completed", tag)
+		case strings.HasPrefix(upper, "UID FETCH "):
+			uid, _ := strconv.ParseUint(strings.Fields(command)[2], 10, 32)
+			if raw, ok := s.messages[uint32(uid)]; ok {
+				reply("* 1 FETCH (UID %d INTERNALDATE \"18-Oct-2026 10:15:00 +0530\" BODY[] {%d}", uid, len(raw))
+				w.WriteString(raw)
+				reply(")")
+			}
+			reply("%s OK FETCH completed", tag)
+		case strings.HasPrefix(upper, "UID STORE "):
+			reply("%s OK STORE completed", tag)
+		case upper == "LOGOUT":
+			reply("* BYE logging out")
+			reply("%s OK LOGOUT completed", tag)
+			w.Flush()
+			return
+		default:
+			reply("%s BAD unknown command", tag)
+		}
+		w.Flush()
+	}
+}
+
+// search answers "UID n:*" like real servers do, always including the newest message, and
+// anything else (SINCE) with the whole mailbox
+func (s *imapResponder) search(criteria string) string {
+	from := uint64(0)
+	if rest, ok := strings.CutPrefix(criteria, "UID "); ok {
+		from, _ = strconv.ParseUint(strings.TrimSuffix(rest, ":*"), 10, 32)
+	}
+	var newest uint32
+	for uid := range s.messages {
+		newest = max(newest, uid)
+	}
+	var out strings.Builder
+	for uid := range s.messages {
+		if uint64(uid) >= from || uid == newest {
+			fmt.Fprintf(&out, " %d", uid)
+		}
+	}
+	return out.String()
+}
+
+/* ========== TESTS ========== */
+
+const plainInboundEmail = "From: Ravi Kumar <Ravi@Example.com>\r\n" +
+	"To: sales@example.com\r\n" +
+	"Subject: Packing machine enquiry\r\n" +
+	"Message-ID: <m1@example.com>\r\n" +
+	"Date: Sat, 18 Oct 2026 10:00:00 +0530\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Please share a price.\r\n"
+
+const attachmentInboundEmail = "From: Asha <asha@example.com>\r\n" +
+	"To: sales@example.com\r\n" +
+	"Subject: Drawing attached\r\n" +
+	"Message-ID: <m2@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=XYZ\r\n" +
+	"\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"See the drawing.\r\n" +
+	"--XYZ\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"../drawing.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--XYZ--\r\n"
+
+func TestReadEmailInboxStoresNewMessages(t *testing.T) {
+	t.Chdir(t.TempDir())
+	fake := useFakeEmailInboxDB(t)
+	server := newIMAPResponder(t, 7, map[uint32]string{
+		2: plainInboundEmail,
+		3: plainInboundEmail,
+		5: attachmentInboundEmail,
+	})
+
+	state := models.EmailSyncState{IntegrationID: 1, Mailbox: "INBOX", UIDValidity: 7, LastUID: 2}
+	var run emailInboxRun
+	if err := readEmailInbox(models.Integration{ID: 1}, server.config(), &state, &run); err != nil {
+		t.Fatalf("readEmailInbox: %v", err)
+	}
+
+	if run.Fetched != 2 || run.Unmatched != 2 || run.Matched != 0 {
+		t.Errorf("run = %+v, want 2 fetched and unmatched", run)
+	}
+	if state.LastUID != 5 || state.UIDValidity != 7 {
+		t.Errorf("state last uid %d, uid validity %d; want 5 and 7", state.LastUID, state.UIDValidity)
+	}
+
+	commands := server.received()
+	want := []string{
+		`LOGIN "sales" "secret"`,
+		`SELECT "INBOX"`,
+		"UID SEARCH UID 3:*",
+		"UID FETCH 3 (INTERNALDATE BODY.PEEK[])",
+		`UID STORE 3 +FLAGS.SILENT (\Seen)`,
+		"UID FETCH 5 (INTERNALDATE BODY.PEEK[])",
+		`UID STORE 5 +FLAGS.SILENT (\Seen)`,
+		"LOGOUT",
+	}
+	if strings.Join(commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands:\n%s\nwant:\n%s", strings.Join(commands, "\n"), strings.Join(want, "\n"))
+	}
+
+	inserts := fake.statements("INSERT", "inbound_emails")
+	if len(inserts) != 2 {
+		t.Fatalf("got %d inbound email inserts, want 2", len(inserts))
+	}
+	if !fakeArgsContain(inserts[0].Args, "Packing machine enquiry") || !fakeArgsContain(inserts[0].Args, "ravi@example.com") {
+		t.Errorf("first insert args %v lack the subject or the lower-cased sender", inserts[0].Args)
+	}
+
+	// The attachment lands in private storage under the email id, with a safe name
+	path := filepath.Join(emailInboxUploadDir, "2", "1_drawing.pdf")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("attachment not stored: %v", err)
+	}
+	if string(data) != "%PDF-1.4\n" {
+		t.Errorf("attachment = %q", data)
+	}
+	if strings.HasPrefix(filepath.ToSlash(path), "uploads/") {
+		t.Errorf("attachment stored under the public uploads root: %s", path)
+	}
+}
+
+func TestReadEmailInboxRestartsOnNewUIDValidity(t *testing.T) {
+	t.Chdir(t.TempDir())
+	useFakeEmailInboxDB(t)
+	server := newIMAPResponder(t, 9, map[uint32]string{1: plainInboundEmail})
+
+	state := models.EmailSyncState{IntegrationID: 1, Mailbox: "INBOX", UIDValidity: 7, LastUID: 40}
+	var run emailInboxRun
+	if err := readEmailInbox(models.Integration{ID: 1}, server.config(), &state, &run); err != nil {
+		t.Fatalf("readEmailInbox: %v", err)
+	}
+
+	if state.UIDValidity != 9 || state.LastUID != 1 || run.Fetched != 1 {
+		t.Errorf("state uid validity %d, last uid %d, fetched %d; want 9, 1, 1", state.UIDValidity, state.LastUID, run.Fetched)
+	}
+	var search string
+	for _, c := range server.received() {
+		if strings.HasPrefix(c, "UID SEARCH ") {
+			search = c
+		}
+	}
+	if !strings.HasPrefix(search, "UID SEARCH SINCE ") {
+		t.Errorf("search = %q, want a SINCE search after the UIDVALIDITY change", search)
+	}
+}
+
+func TestReadEmailInboxRejectedLogin(t *testing.T) {
+	useFakeEmailInboxDB(t)
+	server := newIMAPResponder(t, 7, map[uint32]string{})
+
+	cfg := server.config()
+	cfg.Password = "wrong"
+	state := models.EmailSyncState{IntegrationID: 1}
+	var run emailInboxRun
+	err := readEmailInbox(models.Integration{ID: 1}, cfg, &state, &run)
+	if err == nil || !strings.Contains(err.Error(), "AUTHENTICATIONFAILED") {
+		t.Errorf("err = %v, want the server's NO response", err)
+	}
+}
+
+func TestReadEmailInboxFilesUnstorableMessage(t *testing.T) {
+	t.Chdir(t.TempDir())
+	fake := useFakeEmailInboxDB(t)
+	refused := false
+	fake.failOn = func(query string, args []driver.Value) error {
+		if strings.HasPrefix(query, `INSERT INTO "inbound_emails"`) && !refused {
+			refused = true
+			return errors.New("invalid byte sequence for encoding \"UTF8\"")
+		}
+		return nil
+	}
+	server := newIMAPResponder(t, 7, map[uint32]string{3: plainInboundEmail, 4: attachmentInboundEmail})
+
+	state := models.EmailSyncState{IntegrationID: 1, Mailbox: "INBOX", UIDValidity: 7, LastUID: 2}
+	var run emailInboxRun
+	if err := readEmailInbox(models.Integration{ID: 1}, server.config(), &state, &run); err != nil {
+		t.Fatalf("readEmailInbox: %v", err)
+	}
+
+	if state.LastUID != 4 || run.Fetched != 2 || run.Unmatched != 2 {
+		t.Errorf("last uid %d, run %+v; want the read to move past the refused message", state.LastUID, run)
+	}
+	inserts := fake.statements("INSERT", "inbound_emails")
+	if len(inserts) != 3 {
+		t.Fatalf("got %d inbound email inserts, want the refused one, its triage entry and the next message", len(inserts))
+	}
+	if !fakeArgsContain(inserts[1].Args, unreadableEmailSubject) {
+		t.Errorf("triage entry args %v lack %q", inserts[1].Args, unreadableEmailSubject)
+	}
+	if !fakeArgsContain(inserts[2].Args, "Drawing attached") {
+		t.Errorf("message after the refused one was not stored: %v", inserts[2].Args)
+	}
+}
+
+func TestParseInboundEmailCleansText(t *testing.T) {
+	raw := "From: \"Ravi\xff\" <ravi@example.com>\r\n" +
+		"To: sales@example.com\x00\r\n" +
+		"Subject: Price\x00 list \xc3\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Body with a \x00 NUL and a bad \xfe byte\r\n"
+
+	msg, err := parseInboundEmail([]byte(raw))
+	if err != nil {
+		t.Fatalf("parseInboundEmail: %v", err)
+	}
+	for name, v := range map[string]string{"from name": msg.FromName, "to": msg.To, "subject": msg.Subject, "body": msg.Body} {
+		if strings.ContainsRune(v, 0) || !utf8.ValidString(v) {
+			t.Errorf("%s = %q still has NUL or invalid UTF-8", name, v)
+		}
+	}
+	if !strings.HasPrefix(msg.Subject, "Price list") {
+		t.Errorf("subject = %q", msg.Subject)
+	}
+}
+
+func TestIngestInboundEmailSkipsStoredMessage(t *testing.T) {
+	fake := useFakeEmailInboxDB(t)
+	fake.count = 1
+
+	status, err := ingestInboundEmail(emailInboxDB, 1, 7, 3, []byte(plainInboundEmail), time.Date(2026, 10, 18, 10, 15, 0, 0, istLocation))
+	if err != nil {
+		t.Fatalf("ingestInboundEmail: %v", err)
+	}
+	if status != "skipped" {
+		t.Errorf("status = %q, want skipped", status)
+	}
+	if len(fake.statements("INSERT", "inbound_emails")) != 0 {
+		t.Error("a stored message was inserted again")
+	}
+}
+
+func TestIngestInboundEmailMatchesLeadBySender(t *testing.T) {
+	t.Chdir(t.TempDir())
+	fake := useFakeEmailInboxDB(t)
+	fake.rowsFor = func(query string) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT") && strings.Contains(query, `FROM "leads"`) {
+			return []string{"id", "business"}, [][]driver.Value{{int64(42), "Kumar Packaging"}}
+		}
+		return nil, nil
+	}
+
+	status, err := ingestInboundEmail(emailInboxDB, 1, 7, 3, []byte(plainInboundEmail), time.Date(2026, 10, 18, 10, 15, 0, 0, istLocation))
+	if err != nil {
+		t.Fatalf("ingestInboundEmail: %v", err)
+	}
+	if status != "matched" {
+		t.Fatalf("status = %q, want matched", status)
+	}
+
+	interactions := fake.statements("INSERT", "lead_interactions")
+	if len(interactions) != 1 {
+		t.Fatalf("got %d interaction inserts, want 1", len(interactions))
+	}
+	if !fakeArgsContain(interactions[0].Args, "Email from ravi@example.com: Packing machine enquiry") {
+		t.Errorf("interaction args %v lack the summary", interactions[0].Args)
+	}
+	saves := fake.statements("UPDATE", "inbound_emails")
+	if len(saves) == 0 || !fakeArgsContain(saves[len(saves)-1].Args, "matched") || !fakeArgsContain(saves[len(saves)-1].Args, "sender") {
+		t.Errorf("inbound email not saved as matched by sender: %v", saves)
+	}
+}
+
+func fakeArgsContain(args []driver.Value, want string) bool {
+	for _, a := range args {
+		if s, ok := a.(string); ok && s == want {
+			return true
+		}
+	}
+	return false
+}
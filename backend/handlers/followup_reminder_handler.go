@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// A reminder goes out this long before a follow-up is due
+	followUpRemindBefore = 30 * time.Minute
+	// A pending follow-up this far past due is escalated to the assignee's manager
+	followUpEscalateAfter = 2 * time.Hour
+	// Upper bound of follow-ups handled per scheduler pass
+	followUpReminderBatch = 200
+)
+
+// followUpStatuses are the values LeadFollowUp.Status may take
+var followUpStatuses = map[string]bool{"pending": true, "done": true, "skipped": true, "cancelled": true}
+
+/* ========== HELPERS ========== */
+
+// syncLeadNextTalk sets Lead.NextTalk to the earliest pending follow-up, or clears it
+func syncLeadNextTalk(db *gorm.DB, leadID uint) error {
+	var next sql.NullTime
+	if err := db.Model(&models.LeadFollowUp{}).
+		Where("lead_id = ? AND status = ?", leadID, "pending").
+		Select("MIN(follow_up_on)").Row().Scan(&next); err != nil {
+		return err
+	}
+	return db.Model(&models.Lead{}).Where("id = ?", leadID).UpdateColumn("next_talk", next.Time).Error
+}
+
+// followUpAssignee is the follow-up's own assignee, else the lead owner
+func followUpAssignee(fup *models.LeadFollowUp, lead *models.Lead) *uint {
+	if fup.AssignedToID != nil {
+		return fup.AssignedToID
+	}
+	return lead.AssignedToID
+}
+
+// followUpNotifier delivers follow-up notices on every channel that is configured
+type followUpNotifier struct {
+	db       *gorm.DB
+	email    bool
+	whatsApp bool
+}
+
+func newFollowUpNotifier(db *gorm.DB) *followUpNotifier {
+	n := &followUpNotifier{db: db}
+	if integration, err := activeIntegration(db, "email"); err == nil && integration != nil {
+		n.email = true
+	}
+	if integration, err := activeIntegration(db, "whatsapp"); err == nil && integration != nil {
+		n.whatsApp = true
+	}
+	return n
+}
+
+func (n *followUpNotifier) deliver(fup *models.LeadFollowUp, userID uint, kind, title, message string) {
+	record := func(channel string, err error) {
+		entry := models.FollowUpReminderLog{
+			FollowUpID: fup.ID,
+			LeadID:     fup.LeadID,
+			UserID:     userID,
+			Kind:       kind,
+			Channel:    channel,
+			Status:     "sent",
+		}
+		if err != nil {
+			entry.Status = "failed"
+			entry.Error = err.Error()
+		}
+		if err := n.db.Create(&entry).Error; err != nil {
+			log.Printf("followup reminders: failed to log %s for follow-up %d: %v", channel, fup.ID, err)
+		}
+	}
+
+	record(channelInApp, notifyUser(n.db, userID, "followup_"+kind, title, message, "lead", &fup.LeadID))
+
+	if !n.email && !n.whatsApp {
+		return
+	}
+	var user models.User
+	if err := n.db.First(&user, userID).Error; err != nil {
+		return
+	}
+	if n.email && strings.TrimSpace(user.Email) != "" {
+		record(channelEmail, sendIntegrationEmail(n.db, user.Email, title, message))
+	}
+	if number := userWhatsAppNumber(&user); n.whatsApp && number != "" {
+		record(channelWhatsApp, sendIntegrationWhatsApp(n.db, number, title+"\n"+message))
+	}
+}
+
+func followUpNoticeText(fup *models.LeadFollowUp, lead *models.Lead) string {
+	name := lead.Business
+	if name == "" {
+		name = lead.Name
+	}
+	text := fmt.Sprintf("%s with %s", strings.TrimSpace(fup.Title), name)
+	if lead.Mobile != "" {
+		text += " (" + lead.Mobile + ")"
+	}
+	text += " at " + fup.FollowUpOn.In(istLocation).Format("02 Jan 2006 03:04 PM")
+	if fup.Notes != "" {
+		text += "\n" + fup.Notes
+	}
+	return text
+}
+
+// runFollowUpReminders sends reminders for follow-ups falling due and escalates overdue ones
+func runFollowUpReminders(now time.Time) {
+	db := leadFollowupDB
+	notifier := newFollowUpNotifier(db)
+
+	// Reminders: due within the reminder window and not yet so late that they escalate
+	var due []models.LeadFollowUp
+	if err := db.Preload("Lead").
+		Where("status = ? AND reminder_sent_at IS NULL", "pending").
+		Where("follow_up_on <= ? AND follow_up_on > ?", now.Add(followUpRemindBefore), now.Add(-followUpEscalateAfter)).
+		Order("follow_up_on asc").Limit(followUpReminderBatch).Find(&due).Error; err != nil {
+		log.Printf("followup reminders: failed to load due follow-ups: %v", err)
+		return
+	}
+	for i := range due {
+		fup := &due[i]
+		if userID := followUpAssignee(fup, &fup.Lead); userID != nil {
+			notifier.deliver(fup, *userID, "reminder", "Follow-up reminder", followUpNoticeText(fup, &fup.Lead))
+		}
+		if err := db.Model(fup).UpdateColumn("reminder_sent_at", now).Error; err != nil {
+			log.Printf("followup reminders: failed to mark follow-up %d reminded: %v", fup.ID, err)
+		}
+	}
+
+	// Escalations: still pending well past due
+	var overdue []models.LeadFollowUp
+	if err := db.Preload("Lead").
+		Where("status = ? AND escalated_at IS NULL AND follow_up_on <= ?", "pending", now.Add(-followUpEscalateAfter)).
+		Order("follow_up_on asc").Limit(followUpReminderBatch).Find(&overdue).Error; err != nil {
+		log.Printf("followup reminders: failed to load overdue follow-ups: %v", err)
+		return
+	}
+	for i := range overdue {
+		fup := &overdue[i]
+		if userID := followUpAssignee(fup, &fup.Lead); userID != nil {
+			text := followUpNoticeText(fup, &fup.Lead)
+			// A lookup failure still marks the follow-up escalated so it is not retried every minute
+			managerID, err := managerUserID(db, *userID)
+			if err != nil {
+				log.Printf("followup reminders: failed to find manager of user %d: %v", *userID, err)
+			}
+			if managerID != nil {
+				owner := fmt.Sprintf("User %d", *userID)
+				var assignee models.User
+				if err := db.First(&assignee, *userID).Error; err != nil {
+					log.Printf("followup reminders: failed to load user %d: %v", *userID, err)
+				} else if name := strings.TrimSpace(assignee.Firstname + " " + assignee.Lastname); name != "" {
+					owner = name
+				}
+				notifier.deliver(fup, *managerID, "escalation", "Overdue follow-up escalated",
+					fmt.Sprintf("%s has not completed: %s", owner, text))
+			}
+			_ = notifyUser(db, *userID, "followup_overdue", "Follow-up overdue", text, "lead", &fup.LeadID)
+		}
+		if err := db.Model(fup).UpdateColumn("escalated_at", now).Error; err != nil {
+			log.Printf("followup reminders: failed to mark follow-up %d escalated: %v", fup.ID, err)
+		}
+	}
+}
+
+// StartFollowUpReminderScheduler checks follow-ups every minute for reminders and escalations
+func StartFollowUpReminderScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			runFollowUpReminders(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+/* ========== HANDLERS ========== */
+
+type agendaItem struct {
+	models.LeadFollowUp
+	LeadBusiness string `json:"lead_business"`
+	LeadName     string `json:"lead_name"`
+	LeadMobile   string `json:"lead_mobile"`
+	LeadStage    string `json:"lead_stage"`
+}
+
+// GetFollowUpAgenda returns a user's follow-ups for one day plus everything still overdue.
+// Query: user_id (required), date (YYYY-MM-DD, IST; default today)
+func GetFollowUpAgenda(c *fiber.Ctx) error {
+	userID := c.QueryInt("user_id", 0)
+	if userID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "user_id is required"})
+	}
+
+	day := time.Now().In(istLocation)
+	if d := c.Query("date"); d != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", d, istLocation)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+		}
+		day = parsed
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, istLocation)
+	end := start.AddDate(0, 0, 1)
+
+	// Follow-ups assigned to the user, or unassigned ones on leads the user owns
+	mine := leadFollowupDB.Model(&models.LeadFollowUp{}).
+		Joins("JOIN leads ON leads.id = lead_follow_ups.lead_id").
+		Where("(lead_follow_ups.assigned_to_id = ? OR (lead_follow_ups.assigned_to_id IS NULL AND leads.assigned_to_id = ?))", userID, userID)
+
+	load := func(query *gorm.DB) ([]agendaItem, error) {
+		var fups []models.LeadFollowUp
+		if err := query.Select("lead_follow_ups.*").Preload("Lead").Preload("AssignedTo").
+			Order("lead_follow_ups.follow_up_on asc").Find(&fups).Error; err != nil {
+			return nil, err
+		}
+		items := make([]agendaItem, len(fups))
+		for i, f := range fups {
+			items[i] = agendaItem{
+				LeadFollowUp: f,
+				LeadBusiness: f.Lead.Business,
+				LeadName:     f.Lead.Name,
+				LeadMobile:   f.Lead.Mobile,
+				LeadStage:    f.Lead.Stage,
+			}
+		}
+		return items, nil
+	}
+
+	today, err := load(mine.Session(&gorm.Session{}).
+		Where("lead_follow_ups.follow_up_on >= ? AND lead_follow_ups.follow_up_on < ?", start, end))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	overdue, err := load(mine.Session(&gorm.Session{}).
+		Where("lead_follow_ups.status = ? AND lead_follow_ups.follow_up_on < ?", "pending", start))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	pending, done := 0, 0
+	for _, item := range today {
+		switch item.Status {
+		case "pending":
+			pending++
+		case "done":
+			done++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"user_id": userID,
+		"date":    start.Format("2006-01-02"),
+		"today":   today,
+		"overdue": overdue,
+		"summary": fiber.Map{
+			"today":   len(today),
+			"pending": pending,
+			"done":    done,
+			"overdue": len(overdue),
+		},
+	})
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapClient is a minimal IMAP4rev1 client (RFC 3501): enough to read new messages from one
+// mailbox. Commands are sent one at a time and never carry literals.
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapLine is one server response line; the {n} literals it carried are in Literals, in order
+type imapLine struct {
+	Text     string
+	Literals [][]byte
+}
+
+const imapTimeout = time.Minute
+
+// dialIMAP connects and reads the greeting. security is "tls" (implicit TLS, usually port 993),
+// "starttls", or "none" for local test servers.
+func dialIMAP(host, port, security string) (*imapClient, error) {
+	addr := net.JoinHostPort(host, port)
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.Text, "* OK") && !strings.HasPrefix(greeting.Text, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting %q", greeting.Text)
+	}
+
+	if security == "starttls" {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+	}
+	return c, nil
+}
+
+func (c *imapClient) Close() error {
+	return c.conn.Close()
+}
+
+// readLine reads one response line, pulling in any literals it announces
+func (c *imapClient) readLine() (imapLine, error) {
+	c.conn.SetReadDeadline(time.Now().Add(imapTimeout))
+
+	var line imapLine
+	var text strings.Builder
+	for {
+		s, err := c.r.ReadString('\n')
+		if err != nil {
+			return line, err
+		}
+		s = strings.TrimRight(s, "\r\n")
+		text.WriteString(s)
+
+		// A line ending in {n} is followed by n octets of data, then the rest of the line
+		n, ok := imapLiteralSize(s)
+		if !ok {
+			line.Text = text.String()
+			return line, nil
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return line, err
+		}
+		line.Literals = append(line.Literals, buf)
+	}
+}
+
+func imapLiteralSize(s string) (int, bool) {
+	if !strings.HasSuffix(s, "}") {
+		return 0, false
+	}
+	open := strings.LastIndexByte(s, '{')
+	if open < 0 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(s[open+1:len(s)-1], "+"))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// command sends a tagged command and returns the untagged responses that came before its
+// completion; a NO or BAD completion is returned as an error
+func (c *imapClient) command(format string, args ...interface{}) ([]imapLine, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+
+	c.conn.SetWriteDeadline(time.Now().Add(imapTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, err
+	}
+
+	var lines []imapLine
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return lines, err
+		}
+		if !strings.HasPrefix(line.Text, tag+" ") {
+			lines = append(lines, line)
+			continue
+		}
+		status := strings.TrimPrefix(line.Text, tag+" ")
+		if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+			return lines, fmt.Errorf("imap: %s", status)
+		}
+		return lines, nil
+	}
+}
+
+// imapQuote renders s as an IMAP quoted string
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (c *imapClient) Login(username, password string) error {
+	_, err := c.command("LOGIN %s %s", imapQuote(username), imapQuote(password))
+	return err
+}
+
+// Select opens a mailbox and returns its UIDVALIDITY
+func (c *imapClient) Select(mailbox string) (uint32, error) {
+	lines, err := c.command("SELECT %s", imapQuote(mailbox))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range lines {
+		upper := strings.ToUpper(line.Text)
+		i := strings.Index(upper, "[UIDVALIDITY ")
+		if i < 0 {
+			continue
+		}
+		rest := line.Text[i+len("[UIDVALIDITY "):]
+		if end := strings.IndexByte(rest, ']'); end >= 0 {
+			rest = rest[:end]
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(rest), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("imap: bad UIDVALIDITY %q", rest)
+		}
+		return uint32(v), nil
+	}
+	return 0, fmt.Errorf("imap: server sent no UIDVALIDITY for %s", mailbox)
+}
+
+// SearchUIDs runs UID SEARCH with the given criteria, e.g. "UID 42:*" or "SINCE 01-Jan-2025"
+func (c *imapClient) SearchUIDs(criteria string) ([]uint32, error) {
+	lines, err := c.command("UID SEARCH %s", criteria)
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.ToUpper(line.Text), "* SEARCH") {
+			continue
+		}
+		for _, f := range strings.Fields(line.Text[len("* SEARCH"):]) {
+			if v, err := strconv.ParseUint(f, 10, 32); err == nil {
+				uids = append(uids, uint32(v))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// FetchMessage returns the raw RFC 822 message and the server's INTERNALDATE without
+// marking the message as seen
+func (c *imapClient) FetchMessage(uid uint32) ([]byte, time.Time, error) {
+	lines, err := c.command("UID FETCH %d (INTERNALDATE BODY.PEEK[])", uid)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	for _, line := range lines {
+		if !strings.Contains(strings.ToUpper(line.Text), "FETCH (") || len(line.Literals) == 0 {
+			continue
+		}
+		var internal time.Time
+		upper := strings.ToUpper(line.Text)
+		if i := strings.Index(upper, `INTERNALDATE "`); i >= 0 {
+			rest := line.Text[i+len(`INTERNALDATE "`):]
+			if end := strings.IndexByte(rest, '"'); end >= 0 {
+				internal, _ = time.Parse("_2-Jan-2006 15:04:05 -0700", rest[:end])
+			}
+		}
+		return line.Literals[len(line.Literals)-1], internal, nil
+	}
+	return nil, time.Time{}, fmt.Errorf("imap: message %d not returned", uid)
+}
+
+// MarkSeen sets the \Seen flag on a message
+func (c *imapClient) MarkSeen(uid uint32) error {
+	_, err := c.command(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid)
+	return err
+}
+
+func (c *imapClient) Logout() error {
+	_, err := c.command("LOGOUT")
+	return err
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+)
+
+const (
+	defaultIndiaMartAPIURL = "https://mapi.indiamart.com/wservce/crm/crmListing/v2/"
+
+	// IndiaMART accepts a window of at most 7 days per call
+	indiaMartMaxWindow = 7 * 24 * time.Hour
+
+	indiaMartQueryTimeLayout = "2006-01-02 15:04:05"
+	indiaMartParamTimeLayout = "02-Jan-200615:04:05"
+)
+
+// indiaMartAPIURL allows the endpoint to be pointed at a stub (config "api_url" or INDIAMART_API_URL)
+func indiaMartAPIURL(integration *models.Integration) string {
+	if integration != nil {
+		if u := integrationConfigString(integration.Config, "api_url"); u != "" {
+			return u
+		}
+	}
+	if u := os.Getenv("INDIAMART_API_URL"); u != "" {
+		return u
+	}
+	return defaultIndiaMartAPIURL
+}
+
+// indiaMartCRMKey reads the CRM key saved from the Integrations page (stored as keySecret)
+func indiaMartCRMKey(integration *models.Integration) string {
+	return integrationConfigString(integration.Config, "keySecret", "api_key", "apiKey", "crm_key")
+}
+
+type indiaMartConnector struct {
+	integration models.Integration
+	client      *leadPlatformClient
+	apiKey      string
+}
+
+func newIndiaMartConnector(integration models.Integration, client *leadPlatformClient) (LeadConnector, error) {
+	apiKey := indiaMartCRMKey(&integration)
+	if apiKey == "" {
+		return nil, errors.New("IndiaMART CRM key is not configured")
+	}
+	return &indiaMartConnector{integration: integration, client: client, apiKey: apiKey}, nil
+}
+
+// FetchSince pulls the enquiries of one window starting at the cursor (QUERY_TIME, IST)
+func (c *indiaMartConnector) FetchSince(cursor string) ([]ExternalLeadRecord, string, error) {
+	now := time.Now().In(istLocation)
+	from := leadSyncWindowStart(cursor, indiaMartQueryTimeLayout, now)
+	to := now
+	if to.Sub(from) > indiaMartMaxWindow {
+		to = from.Add(indiaMartMaxWindow)
+	}
+
+	params := url.Values{}
+	params.Set("glusr_crm_key", c.apiKey)
+	params.Set("start_time", from.Format(indiaMartParamTimeLayout))
+	params.Set("end_time", to.Format(indiaMartParamTimeLayout))
+
+	status, body, err := c.client.Get(withQuery(indiaMartAPIURL(&c.integration), params))
+	if err != nil {
+		return nil, cursor, err
+	}
+	if status != http.StatusOK {
+		return nil, cursor, fmt.Errorf("IndiaMART API returned status %d: %s", status, string(body))
+	}
+
+	var apiResponse IndiaMartAPIResponse
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, cursor, fmt.Errorf("failed to parse IndiaMART response: %w", err)
+	}
+
+	// 204 means no leads in the window
+	if apiResponse.CODE != 0 && apiResponse.CODE != http.StatusOK && apiResponse.CODE != http.StatusNoContent {
+		return nil, cursor, fmt.Errorf("IndiaMART API error %d: %s", apiResponse.CODE, apiResponse.MESSAGE)
+	}
+
+	leads := apiResponse.RESPONSE
+	if len(leads) == 0 {
+		leads = apiResponse.DATA
+	}
+
+	next := cursor
+	records := make([]ExternalLeadRecord, 0, len(leads))
+	for _, l := range leads {
+		rec := ExternalLeadRecord{ExternalID: strings.TrimSpace(l.UNIQUE_QUERY_ID), Data: l}
+		if t, err := time.ParseInLocation(indiaMartQueryTimeLayout, l.QUERY_TIME, istLocation); err == nil {
+			rec.ReceivedAt = t
+		}
+		records = append(records, rec)
+
+		// QUERY_TIME is fixed width, so string order is time order
+		if l.QUERY_TIME > next {
+			next = l.QUERY_TIME
+		}
+	}
+
+	// Nothing newer in a capped window: move past it so the next run reads the following week
+	if next == cursor && to.Before(now) {
+		next = to.Format(indiaMartQueryTimeLayout)
+	}
+
+	return records, next, nil
+}
+
+// MapLead maps an IndiaMART enquiry to a CRM lead
+func (c *indiaMartConnector) MapLead(rec ExternalLeadRecord) models.Lead {
+	l := rec.Data.(IndiaMartLead)
+
+	lead := models.Lead{
+		Business:     strings.TrimSpace(l.SENDER_COMPANY),
+		Name:         strings.TrimSpace(l.SENDER_NAME),
+		Mobile:       strings.TrimSpace(l.SENDER_MOBILE),
+		Email:        strings.TrimSpace(l.SENDER_EMAIL),
+		AddressLine1: strings.TrimSpace(l.SENDER_ADDRESS),
+		City:         strings.TrimSpace(l.SENDER_CITY),
+		State:        strings.TrimSpace(l.SENDER_STATE),
+		Country:      strings.TrimSpace(l.SENDER_COUNTRY_ISO),
+		Source:       "IndiaMART",
+		Category:     strings.TrimSpace(l.QUERY_CATEGORY_NAME),
+		Requirements: strings.TrimSpace(l.QUERY_MESSAGE),
+		ProductName:  strings.TrimSpace(l.QUERY_PRODUCT_NAME),
+		Since:        rec.ReceivedAt,
+	}
+	if lead.Business == "" {
+		lead.Business = lead.Name
+	}
+	return lead
+}
+
+// Ack is a no-op: the IndiaMART pull API has no acknowledgement
+func (c *indiaMartConnector) Ack(records []ExternalLeadRecord) error {
+	return nil
+}
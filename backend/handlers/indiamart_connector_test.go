@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"erp.local/backend/models"
+)
+
+// indiaMartStub serves the pull API from a handler and returns a connector pointed at it
+func indiaMartStub(t *testing.T, handler http.HandlerFunc) (*indiaMartConnector, *httptest.Server) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	config, _ := json.Marshal(map[string]string{"keySecret": "test-key", "api_url": srv.URL + "/crmListing/v2/"})
+	client := &leadPlatformClient{
+		provider: "indiamart",
+		http:     srv.Client(),
+		limiter:  &leadRateLimiter{},
+		retry:    leadRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+	conn, err := newIndiaMartConnector(models.Integration{Provider: "indiamart", Config: config}, client)
+	if err != nil {
+		t.Fatalf("newIndiaMartConnector: %v", err)
+	}
+	return conn.(*indiaMartConnector), srv
+}
+
+func writeIndiaMartResponse(t *testing.T, w http.ResponseWriter, resp IndiaMartAPIResponse) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		t.Errorf("encode response: %v", err)
+	}
+}
+
+func TestIndiaMartFetchSince(t *testing.T) {
+	now := time.Now().In(istLocation)
+	cursor := now.Add(-2 * time.Hour).Format(indiaMartQueryTimeLayout)
+	first := now.Add(-90 * time.Minute).Format(indiaMartQueryTimeLayout)
+	second := now.Add(-30 * time.Minute).Format(indiaMartQueryTimeLayout)
+
+	conn, _ := indiaMartStub(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/crmListing/v2/" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := q.Get("glusr_crm_key"); got != "test-key" {
+			t.Errorf("glusr_crm_key = %q", got)
+		}
+		start, err := time.ParseInLocation(indiaMartParamTimeLayout, q.Get("start_time"), istLocation)
+		if err != nil {
+			t.Errorf("start_time %q: %v", q.Get("start_time"), err)
+		}
+		from, _ := time.ParseInLocation(indiaMartQueryTimeLayout, cursor, istLocation)
+		if !start.Equal(from.Add(-leadSyncOverlap)) {
+			t.Errorf("start_time = %v, want cursor minus overlap %v", start, from.Add(-leadSyncOverlap))
+		}
+		if _, err := time.ParseInLocation(indiaMartParamTimeLayout, q.Get("end_time"), istLocation); err != nil {
+			t.Errorf("end_time %q: %v", q.Get("end_time"), err)
+		}
+
+		writeIndiaMartResponse(t, w, IndiaMartAPIResponse{CODE: 200, STATUS: "SUCCESS", RESPONSE: []IndiaMartLead{
+			{UNIQUE_QUERY_ID: "Q2", QUERY_TIME: second, SENDER_NAME: "Ravi Kumar", SENDER_MOBILE: "+91-9876543210"},
+			{UNIQUE_QUERY_ID: " Q1 ", QUERY_TIME: first, SENDER_NAME: "Asha", SENDER_COMPANY: "Asha Traders"},
+		}})
+	})
+
+	records, next, err := conn.FetchSince(cursor)
+	if err != nil {
+		t.Fatalf("FetchSince: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if records[0].ExternalID != "Q2" || records[1].ExternalID != "Q1" {
+		t.Errorf("external ids = %q, %q", records[0].ExternalID, records[1].ExternalID)
+	}
+	if got := records[1].ReceivedAt.Format(indiaMartQueryTimeLayout); got != first {
+		t.Errorf("received at = %s, want %s", got, first)
+	}
+	if next != second {
+		t.Errorf("next cursor = %q, want newest QUERY_TIME %q", next, second)
+	}
+}
+
+func TestIndiaMartMapLead(t *testing.T) {
+	conn, _ := indiaMartStub(t, func(w http.ResponseWriter, r *http.Request) {})
+	received := time.Date(2026, 10, 18, 11, 30, 0, 0, istLocation)
+
+	lead := conn.MapLead(ExternalLeadRecord{ExternalID: "Q1", ReceivedAt: received, Data: IndiaMartLead{
+		SENDER_NAME:         " Ravi Kumar ",
+		SENDER_EMAIL:        "ravi@example.com",
+		SENDER_MOBILE:       "+91-9876543210",
+		SENDER_CITY:         "Pune",
+		SENDER_STATE:        "Maharashtra",
+		SENDER_COUNTRY_ISO:  "IN",
+		QUERY_PRODUCT_NAME:  "Packing Machine",
+		QUERY_MESSAGE:       "Need a quote",
+		QUERY_CATEGORY_NAME: "Machinery",
+	}})
+
+	if lead.Name != "Ravi Kumar" || lead.Business != "Ravi Kumar" {
+		t.Errorf("name = %q, business = %q; blank company should fall back to the name", lead.Name, lead.Business)
+	}
+	if lead.Source != "IndiaMART" || lead.ProductName != "Packing Machine" || lead.Requirements != "Need a quote" {
+		t.Errorf("unexpected lead %+v", lead)
+	}
+	if lead.City != "Pune" || lead.State != "Maharashtra" || lead.Country != "IN" {
+		t.Errorf("address = %q, %q, %q", lead.City, lead.State, lead.Country)
+	}
+	if !lead.Since.Equal(received) {
+		t.Errorf("since = %v, want %v", lead.Since, received)
+	}
+}
+
+func TestIndiaMartRetriesServerErrors(t *testing.T) {
+	var hits int32
+	conn, _ := indiaMartStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeIndiaMartResponse(t, w, IndiaMartAPIResponse{CODE: 204, MESSAGE: "no leads"})
+	})
+
+	if _, _, err := conn.FetchSince(""); err != nil {
+		t.Fatalf("FetchSince: %v", err)
+	}
+	if hits := atomic.LoadInt32(&hits); hits != 2 {
+		t.Errorf("server hit %d times, want 2", hits)
+	}
+}
+
+func TestIndiaMartAPIErrorKeepsCursor(t *testing.T) {
+	conn, _ := indiaMartStub(t, func(w http.ResponseWriter, r *http.Request) {
+		writeIndiaMartResponse(t, w, IndiaMartAPIResponse{CODE: 401, STATUS: "FAILURE", MESSAGE: "invalid key"})
+	})
+
+	cursor := time.Now().In(istLocation).Add(-time.Hour).Format(indiaMartQueryTimeLayout)
+	records, next, err := conn.FetchSince(cursor)
+	if err == nil {
+		t.Fatal("expected an error for CODE 401")
+	}
+	if len(records) != 0 || next != cursor {
+		t.Errorf("got %d records and cursor %q, want none and %q", len(records), next, cursor)
+	}
+}
+
+func TestIndiaMartCapsWindowAndMovesPastEmptyWeek(t *testing.T) {
+	cursor := time.Now().In(istLocation).Add(-20 * 24 * time.Hour).Format(indiaMartQueryTimeLayout)
+	from, _ := time.ParseInLocation(indiaMartQueryTimeLayout, cursor, istLocation)
+	wantEnd := from.Add(-leadSyncOverlap).Add(indiaMartMaxWindow)
+
+	conn, _ := indiaMartStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("end_time"); got != wantEnd.Format(indiaMartParamTimeLayout) {
+			t.Errorf("end_time = %q, want %q", got, wantEnd.Format(indiaMartParamTimeLayout))
+		}
+		writeIndiaMartResponse(t, w, IndiaMartAPIResponse{CODE: 204})
+	})
+
+	records, next, err := conn.FetchSince(cursor)
+	if err != nil {
+		t.Fatalf("FetchSince: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("got %d records, want none", len(records))
+	}
+	if next != wantEnd.Format(indiaMartQueryTimeLayout) {
+		t.Errorf("next cursor = %q, want end of the capped window %q", next, wantEnd.Format(indiaMartQueryTimeLayout))
+	}
+}
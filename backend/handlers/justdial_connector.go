@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+)
+
+// JustDial delivers leads by push, so the connector reads them from the relay endpoint configured
+// on the integration ("api_url", optional "api_key") and confirms them on "ack_url" when set.
+type justDialConnector struct {
+	client *leadPlatformClient
+	apiURL string
+	apiKey string
+	ackURL string
+}
+
+func newJustDialConnector(integration models.Integration, client *leadPlatformClient) (LeadConnector, error) {
+	c := &justDialConnector{
+		client: client,
+		apiURL: integrationConfigString(integration.Config, "api_url"),
+		apiKey: integrationConfigString(integration.Config, "api_key", "key"),
+		ackURL: integrationConfigString(integration.Config, "ack_url"),
+	}
+	if c.apiURL == "" {
+		return nil, errors.New("JustDial api_url is not configured")
+	}
+	return c, nil
+}
+
+// FetchSince reads leads received after the cursor (RFC 3339)
+func (c *justDialConnector) FetchSince(cursor string) ([]ExternalLeadRecord, string, error) {
+	params := url.Values{}
+	if cursor != "" {
+		params.Set("since", cursor)
+	}
+	if c.apiKey != "" {
+		params.Set("api_key", c.apiKey)
+	}
+
+	status, body, err := c.client.Get(withQuery(c.apiURL, params))
+	if err != nil {
+		return nil, cursor, err
+	}
+	if status != http.StatusOK {
+		return nil, cursor, fmt.Errorf("JustDial endpoint returned status %d: %s", status, string(body))
+	}
+
+	var leads []map[string]interface{}
+	if err := json.Unmarshal(body, &leads); err != nil {
+		var wrapped struct {
+			Leads []map[string]interface{} `json:"leads"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err != nil {
+			return nil, cursor, fmt.Errorf("failed to parse JustDial response: %w", err)
+		}
+		leads = wrapped.Leads
+	}
+
+	next := cursor
+	var nextTime time.Time
+	if t, err := time.Parse(time.RFC3339, cursor); err == nil {
+		nextTime = t
+	}
+
+	records := make([]ExternalLeadRecord, 0, len(leads))
+	for _, l := range leads {
+		rec := ExternalLeadRecord{ExternalID: mapString(l, "leadid", "lead_id"), Data: l}
+		received := strings.TrimSpace(mapString(l, "date") + " " + mapString(l, "time"))
+		if t, err := time.ParseInLocation(indiaMartQueryTimeLayout, received, istLocation); err == nil {
+			rec.ReceivedAt = t
+			if t.After(nextTime) {
+				nextTime = t
+				next = t.Format(time.RFC3339)
+			}
+		}
+		records = append(records, rec)
+	}
+
+	return records, next, nil
+}
+
+// MapLead maps a JustDial lead to a CRM lead
+func (c *justDialConnector) MapLead(rec ExternalLeadRecord) models.Lead {
+	l := rec.Data.(map[string]interface{})
+
+	name := strings.TrimSpace(mapString(l, "prefix") + " " + mapString(l, "name"))
+	lead := models.Lead{
+		Business:     mapString(l, "company"),
+		Name:         name,
+		Mobile:       mapString(l, "mobile", "phone"),
+		Email:        mapString(l, "email"),
+		AddressLine1: strings.TrimSpace(strings.Join([]string{mapString(l, "area"), mapString(l, "pincode")}, " ")),
+		City:         mapString(l, "city"),
+		Source:       "JustDial",
+		Category:     mapString(l, "category"),
+		Since:        rec.ReceivedAt,
+	}
+	if lead.Business == "" {
+		lead.Business = lead.Name
+	}
+	return lead
+}
+
+// Ack posts the stored lead ids to ack_url when configured
+func (c *justDialConnector) Ack(records []ExternalLeadRecord) error {
+	if c.ackURL == "" || len(records) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.ExternalID)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"leadids": ids})
+
+	status, body, err := c.client.Do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, c.ackURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	if status >= 300 {
+		return fmt.Errorf("JustDial ack returned status %d: %s", status, string(body))
+	}
+	return nil
+}
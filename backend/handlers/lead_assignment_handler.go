@@ -0,0 +1,442 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var leadAssignmentDB *gorm.DB
+
+func SetLeadAssignmentDB(db *gorm.DB) {
+	leadAssignmentDB = db
+}
+
+// leadOpenSQL restricts a leads query to leads still being worked: not converted and not in a
+// won or lost stage
+const leadOpenSQL = `leads.converted_at IS NULL AND NOT EXISTS (
+	SELECT 1 FROM lead_stages ls WHERE ls.id = leads.stage_id AND (ls.is_won OR ls.is_lost))`
+
+// employeeAvailableSQL filters employees (alias e) who have not left
+const employeeAvailableSQL = `(e.exit_date IS NULL OR e.exit_date > NOW())`
+
+/* ========== DTOs ========== */
+
+type CreateLeadAssignmentRuleRequest struct {
+	Name         string         `json:"name"`
+	Priority     int            `json:"priority"`
+	Active       *bool          `json:"active"`
+	State        string         `json:"state"`
+	City         string         `json:"city"`
+	Source       string         `json:"source"`
+	Category     string         `json:"category"`
+	UnitID       *uint          `json:"unit_id"`
+	AssigneeIDs  datatypes.JSON `json:"assignee_ids"`
+	MaxOpenLeads int            `json:"max_open_leads"`
+}
+
+type UpdateLeadAssignmentRuleRequest struct {
+	Name         *string        `json:"name"`
+	Priority     *int           `json:"priority"`
+	Active       *bool          `json:"active"`
+	State        *string        `json:"state"`
+	City         *string        `json:"city"`
+	Source       *string        `json:"source"`
+	Category     *string        `json:"category"`
+	UnitID       *uint          `json:"unit_id"`
+	AssigneeIDs  datatypes.JSON `json:"assignee_ids"`
+	MaxOpenLeads *int           `json:"max_open_leads"`
+}
+
+/* ========== HELPERS ========== */
+
+func leadRuleAssigneeIDs(rule *models.LeadAssignmentRule) ([]uint, error) {
+	if len(rule.AssigneeIDs) == 0 || string(rule.AssigneeIDs) == "null" {
+		return nil, nil
+	}
+	var ids []uint
+	if err := json.Unmarshal(rule.AssigneeIDs, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func validateLeadAssignmentRule(rule *models.LeadAssignmentRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rule.MaxOpenLeads < 0 {
+		return fmt.Errorf("max_open_leads cannot be negative")
+	}
+	ids, err := leadRuleAssigneeIDs(rule)
+	if err != nil {
+		return fmt.Errorf("assignee_ids must be an array of user IDs")
+	}
+	if rule.UnitID == nil && len(ids) == 0 {
+		return fmt.Errorf("unit_id or assignee_ids is required")
+	}
+	return nil
+}
+
+// leadRuleMatches reports whether every criterion set on the rule matches the lead
+func leadRuleMatches(rule *models.LeadAssignmentRule, lead *models.Lead) bool {
+	matches := func(criterion, value string) bool {
+		criterion = strings.TrimSpace(criterion)
+		return criterion == "" || strings.EqualFold(criterion, strings.TrimSpace(value))
+	}
+	return matches(rule.State, lead.State) &&
+		matches(rule.City, lead.City) &&
+		matches(rule.Source, lead.Source) &&
+		matches(rule.Category, lead.Category)
+}
+
+// leadRulePool returns the rule's candidate user IDs in a stable order, leaving out employees
+// whose exit date has passed
+func leadRulePool(db *gorm.DB, rule *models.LeadAssignmentRule) ([]uint, error) {
+	var pool []uint
+	if rule.UnitID != nil {
+		err := db.Table("employee_organization_units AS eou").
+			Joins("JOIN employees e ON e.id = eou.employee_id").
+			Where("eou.unit_id = ? AND e.user_id <> 0 AND "+employeeAvailableSQL, *rule.UnitID).
+			Distinct().Order("e.user_id").Pluck("e.user_id", &pool).Error
+		return pool, err
+	}
+
+	ids, err := leadRuleAssigneeIDs(rule)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	var exited []uint
+	if err := db.Table("employees AS e").
+		Where("e.user_id IN ? AND NOT "+employeeAvailableSQL, ids).
+		Pluck("e.user_id", &exited).Error; err != nil {
+		return nil, err
+	}
+	gone := map[uint]bool{}
+	for _, id := range exited {
+		gone[id] = true
+	}
+	for _, id := range ids {
+		if !gone[id] {
+			pool = append(pool, id)
+		}
+	}
+	return pool, nil
+}
+
+// openLeadCount is the number of open leads assigned to a user
+func openLeadCount(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.Lead{}).Where("assigned_to_id = ?", userID).Where(leadOpenSQL).Count(&count).Error
+	return count, err
+}
+
+// pickLeadRuleAssignee takes the next available user after the rule's round-robin cursor and
+// advances the cursor. It returns nil when everyone in the pool is unavailable or at the cap.
+func pickLeadRuleAssignee(tx *gorm.DB, rule *models.LeadAssignmentRule) (*uint, error) {
+	// Serialise concurrent picks on the same rule
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(rule, rule.ID).Error; err != nil {
+		return nil, err
+	}
+
+	pool, err := leadRulePool(tx, rule)
+	if err != nil || len(pool) == 0 {
+		return nil, err
+	}
+
+	start := 0
+	if rule.LastAssignedUserID != nil {
+		for i, id := range pool {
+			if id == *rule.LastAssignedUserID {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	for i := 0; i < len(pool); i++ {
+		userID := pool[(start+i)%len(pool)]
+		if rule.MaxOpenLeads > 0 {
+			open, err := openLeadCount(tx, userID)
+			if err != nil {
+				return nil, err
+			}
+			if open >= int64(rule.MaxOpenLeads) {
+				continue
+			}
+		}
+		if err := tx.Model(rule).Update("last_assigned_user_id", userID).Error; err != nil {
+			return nil, err
+		}
+		rule.LastAssignedUserID = &userID
+		return &userID, nil
+	}
+	return nil, nil
+}
+
+// recordLeadAssignment logs an assignee change and notifies the new assignee
+func recordLeadAssignment(tx *gorm.DB, lead *models.Lead, from *uint, ruleID *uint, method, reason string) error {
+	entry := models.LeadAssignmentLog{
+		LeadID:           lead.ID,
+		RuleID:           ruleID,
+		FromAssignedToID: from,
+		AssignedToID:     lead.AssignedToID,
+		Method:           method,
+		Reason:           reason,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	if lead.AssignedToID == nil {
+		return nil
+	}
+
+	title := "New lead assigned"
+	name := lead.Business
+	if name == "" {
+		name = lead.Name
+	}
+	message := fmt.Sprintf("Lead #%d %s has been assigned to you", lead.ID, name)
+	if lead.City != "" {
+		message += " (" + lead.City + ")"
+	}
+	return notifyUser(tx, *lead.AssignedToID, "lead_assigned", title, message, "lead", &lead.ID)
+}
+
+// assignLead sets the lead's assignee and records the change
+func assignLead(tx *gorm.DB, lead *models.Lead, userID uint, ruleID *uint, method, reason string) error {
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return err
+	}
+	name := strings.TrimSpace(user.Firstname + " " + user.Lastname)
+
+	from := lead.AssignedToID
+	if err := tx.Model(lead).Updates(map[string]interface{}{
+		"assigned_to_id":   userID,
+		"assigned_to_name": name,
+	}).Error; err != nil {
+		return err
+	}
+	lead.AssignedToID = &userID
+	lead.AssignedToName = name
+
+	return recordLeadAssignment(tx, lead, from, ruleID, method, reason)
+}
+
+// autoAssignLead runs the active rules in priority order and assigns the lead to the first
+// available user of the first matching rule that has one. It returns the rule used, or nil.
+func autoAssignLead(tx *gorm.DB, lead *models.Lead) (*models.LeadAssignmentRule, error) {
+	var rules []models.LeadAssignmentRule
+	if err := tx.Where("active = true").Order("priority asc, id asc").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if !leadRuleMatches(rule, lead) {
+			continue
+		}
+		userID, err := pickLeadRuleAssignee(tx, rule)
+		if err != nil {
+			return nil, err
+		}
+		if userID == nil {
+			continue
+		}
+		if err := assignLead(tx, lead, *userID, &rule.ID, "rule", "Matched rule "+rule.Name); err != nil {
+			return nil, err
+		}
+		return rule, nil
+	}
+	return nil, nil
+}
+
+/* ========== HANDLERS ========== */
+
+func CreateLeadAssignmentRule(c *fiber.Ctx) error {
+	var body CreateLeadAssignmentRuleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	rule := models.LeadAssignmentRule{
+		Name:         body.Name,
+		Priority:     body.Priority,
+		Active:       true,
+		State:        body.State,
+		City:         body.City,
+		Source:       body.Source,
+		Category:     body.Category,
+		UnitID:       body.UnitID,
+		AssigneeIDs:  body.AssigneeIDs,
+		MaxOpenLeads: body.MaxOpenLeads,
+	}
+
+	if body.Active != nil {
+		rule.Active = *body.Active
+	}
+
+	if err := validateLeadAssignmentRule(&rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := leadAssignmentDB.Create(&rule).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(rule)
+}
+
+func GetLeadAssignmentRules(c *fiber.Ctx) error {
+	var rules []models.LeadAssignmentRule
+
+	query := leadAssignmentDB.Preload("Unit").Order("priority asc, id asc")
+
+	if c.Query("active") == "true" {
+		query = query.Where("active = true")
+	}
+
+	if err := query.Find(&rules).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rules)
+}
+
+func GetLeadAssignmentRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var rule models.LeadAssignmentRule
+
+	if err := leadAssignmentDB.Preload("Unit").First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Assignment rule not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rule)
+}
+
+func UpdateLeadAssignmentRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body UpdateLeadAssignmentRuleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var rule models.LeadAssignmentRule
+	if err := leadAssignmentDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Assignment rule not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if body.Name != nil {
+		rule.Name = *body.Name
+	}
+	if body.Priority != nil {
+		rule.Priority = *body.Priority
+	}
+	if body.Active != nil {
+		rule.Active = *body.Active
+	}
+	if body.State != nil {
+		rule.State = *body.State
+	}
+	if body.City != nil {
+		rule.City = *body.City
+	}
+	if body.Source != nil {
+		rule.Source = *body.Source
+	}
+	if body.Category != nil {
+		rule.Category = *body.Category
+	}
+	if body.UnitID != nil {
+		if *body.UnitID == 0 {
+			rule.UnitID = nil
+		} else {
+			rule.UnitID = body.UnitID
+		}
+	}
+	if body.AssigneeIDs != nil {
+		rule.AssigneeIDs = body.AssigneeIDs
+	}
+	if body.MaxOpenLeads != nil {
+		rule.MaxOpenLeads = *body.MaxOpenLeads
+	}
+
+	if err := validateLeadAssignmentRule(&rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := leadAssignmentDB.Omit("Unit").Save(&rule).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rule)
+}
+
+func DeleteLeadAssignmentRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	if err := leadAssignmentDB.Delete(&models.LeadAssignmentRule{}, id).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Assignment rule deleted successfully"})
+}
+
+// AutoAssignLead re-runs the assignment rules for an existing lead
+func AutoAssignLead(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	tx := leadAssignmentDB.Begin()
+
+	var lead models.Lead
+	if err := tx.First(&lead, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rule, err := autoAssignLead(tx, &lead)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if rule == nil {
+		tx.Rollback()
+		return c.Status(422).JSON(fiber.Map{"error": "No assignment rule matched the lead or no assignee is available"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(fiber.Map{
+		"lead": lead,
+		"rule": rule,
+	})
+}
+
+// GetLeadAssignments lists the assignment history of a lead, newest first
+func GetLeadAssignments(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var logs []models.LeadAssignmentLog
+	if err := leadAssignmentDB.Where("lead_id = ?", id).Order("created_at desc, id desc").Find(&logs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(logs)
+}
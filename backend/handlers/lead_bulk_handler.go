@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Upper bound of leads one bulk request may touch
+const leadBulkMaxLeads = 1000
+
+/* ========== DTOs ========== */
+
+type BulkLeadFollowUp struct {
+	Title        string `json:"title"`
+	Notes        string `json:"notes"`
+	FollowUpOn   string `json:"followup_on"` // RFC3339
+	AssignedToID *uint  `json:"assigned_to_id"`
+}
+
+type BulkLeadRequest struct {
+	// reassign, stage, tag_add, tag_remove, followup or delete
+	Action string `json:"action"`
+
+	// Target leads: explicit IDs, or the GetAllLeads filters (contact, stage, city, tags, ...)
+	IDs    []uint            `json:"ids"`
+	Filter map[string]string `json:"filter"`
+
+	// With all_or_nothing a single failed lead rolls back the whole request
+	AllOrNothing bool  `json:"all_or_nothing"`
+	UserID       *uint `json:"user_id"`
+
+	AssignedToID      *uint             `json:"assigned_to_id"` // reassign
+	StageID           *uint             `json:"stage_id"`       // stage (or stage by code/name)
+	Stage             string            `json:"stage"`
+	RejectionReasonID *uint             `json:"rejection_reason_id"`
+	Remarks           string            `json:"remarks"`
+	TagIDs            []uint            `json:"tag_ids"` // tag_add, tag_remove
+	Tags              []string          `json:"tags"`
+	FollowUp          *BulkLeadFollowUp `json:"followup"` // followup
+}
+
+type bulkLeadResult struct {
+	LeadID uint   `json:"lead_id"`
+	Status string `json:"status"` // updated, unchanged, failed
+	Error  string `json:"error,omitempty"`
+}
+
+/* ========== HELPERS ========== */
+
+// bulkLeadTargets loads the leads a bulk request applies to, with their tags
+func bulkLeadTargets(db *gorm.DB, body *BulkLeadRequest) ([]models.Lead, error) {
+	query := db.Model(&models.Lead{}).Preload("CRMTags").Order("id asc")
+	if len(body.IDs) > 0 {
+		query = query.Where("id IN ?", body.IDs)
+	} else {
+		query = applyLeadFilters(query, func(key string) string { return strings.TrimSpace(body.Filter[key]) })
+	}
+
+	var leads []models.Lead
+	if err := query.Limit(leadBulkMaxLeads + 1).Find(&leads).Error; err != nil {
+		return nil, err
+	}
+	if len(leads) > leadBulkMaxLeads {
+		return nil, &httpError{Status: 400, Msg: fmt.Sprintf("A bulk action may touch at most %d leads; narrow the filter", leadBulkMaxLeads)}
+	}
+	return leads, nil
+}
+
+// lowerAll trims and lowercases each value, for case-insensitive IN lists
+func lowerAll(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(strings.TrimSpace(v))
+	}
+	return out
+}
+
+/* ========== HANDLERS ========== */
+
+// BulkUpdateLeads applies one action to many leads in a transaction and reports the outcome
+// per lead. A failed lead is rolled back on its own unless all_or_nothing is set.
+func BulkUpdateLeads(c *fiber.Ctx) error {
+	var body BulkLeadRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	if len(body.IDs) == 0 {
+		filtered := false
+		for _, key := range leadFilterKeys {
+			if key != "tag_mode" && strings.TrimSpace(body.Filter[key]) != "" {
+				filtered = true
+				break
+			}
+		}
+		if !filtered {
+			return c.Status(400).JSON(fiber.Map{"error": "ids or a filter is required"})
+		}
+	}
+
+	// Validate the action's parameters once, before touching any lead
+	var assignee models.User
+	var targetStage *models.LeadStage
+	var tags []models.CRMTag
+	var followUpOn time.Time
+
+	switch body.Action {
+	case "reassign":
+		if body.AssignedToID == nil {
+			return c.Status(400).JSON(fiber.Map{"error": "assigned_to_id is required"})
+		}
+		if err := leadsDB.First(&assignee, *body.AssignedToID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(400).JSON(fiber.Map{"error": "Invalid assigned_to_id", "detail": "user not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	case "stage":
+		if body.StageID != nil {
+			var stage models.LeadStage
+			if err := leadsDB.First(&stage, *body.StageID).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return c.Status(400).JSON(fiber.Map{"error": "Invalid stage_id", "detail": "stage not found"})
+				}
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			targetStage = &stage
+		} else {
+			stage, err := resolveLeadStage(leadsDB, body.Stage)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			if stage == nil {
+				return c.Status(400).JSON(fiber.Map{"error": "stage_id or a known stage is required"})
+			}
+			targetStage = stage
+		}
+	case "tag_add", "tag_remove":
+		if len(body.TagIDs) == 0 && len(body.Tags) == 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "tag_ids or tags is required"})
+		}
+		if len(body.TagIDs) > 0 {
+			if err := leadsDB.Where("id IN ?", body.TagIDs).Find(&tags).Error; err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			if len(tags) != len(body.TagIDs) {
+				return c.Status(400).JSON(fiber.Map{"error": "One or more tag_ids not found"})
+			}
+		}
+	case "followup":
+		if body.FollowUp == nil || strings.TrimSpace(body.FollowUp.Title) == "" || body.FollowUp.FollowUpOn == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "followup with title and followup_on is required"})
+		}
+		parsed, err := time.Parse(time.RFC3339, body.FollowUp.FollowUpOn)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid followup_on date format"})
+		}
+		followUpOn = parsed
+	case "delete":
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "action must be reassign, stage, tag_add, tag_remove, followup or delete"})
+	}
+
+	tx := leadsDB.Begin()
+
+	leads, err := bulkLeadTargets(tx, &body)
+	if err != nil {
+		tx.Rollback()
+		if he, ok := err.(*httpError); ok {
+			return c.Status(he.Status).JSON(fiber.Map{"error": he.Msg})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(leads) == 0 {
+		tx.Rollback()
+		return c.Status(404).JSON(fiber.Map{"error": "No leads match"})
+	}
+
+	// Tags given by title are resolved (tag_add creates missing ones) inside the transaction
+	if len(body.Tags) > 0 {
+		var named []models.CRMTag
+		if body.Action == "tag_add" {
+			named, err = resolveCRMTags(tx, body.Tags)
+		} else {
+			err = tx.Where("LOWER(title) IN ? OR code IN ?", lowerAll(body.Tags), lowerAll(body.Tags)).Find(&named).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		tags = append(tags, named...)
+	}
+
+	apply := func(lead *models.Lead) (bool, error) {
+		switch body.Action {
+		case "reassign":
+			if lead.AssignedToID != nil && *lead.AssignedToID == assignee.ID {
+				return false, nil
+			}
+			return true, assignLead(tx, lead, assignee.ID, nil, "manual", "Bulk reassignment")
+
+		case "stage":
+			if lead.StageID != nil && *lead.StageID == targetStage.ID {
+				return false, nil
+			}
+			return true, changeLeadStage(tx, lead, targetStage, body.RejectionReasonID, body.Remarks, body.UserID)
+
+		case "tag_add", "tag_remove":
+			has := map[uint]bool{}
+			for _, t := range tags {
+				has[t.ID] = true
+			}
+			var next []models.CRMTag
+			changed := false
+			for _, t := range lead.CRMTags {
+				if body.Action == "tag_remove" && has[t.ID] {
+					changed = true
+					continue
+				}
+				if body.Action == "tag_add" {
+					delete(has, t.ID)
+				}
+				next = append(next, t)
+			}
+			if body.Action == "tag_add" {
+				for _, t := range tags {
+					if has[t.ID] {
+						next = append(next, t)
+						delete(has, t.ID)
+						changed = true
+					}
+				}
+			}
+			if !changed {
+				return false, nil
+			}
+			return true, setLeadTags(tx, lead, next)
+
+		case "followup":
+			fup := models.LeadFollowUp{
+				LeadID:       lead.ID,
+				Title:        strings.TrimSpace(body.FollowUp.Title),
+				Notes:        body.FollowUp.Notes,
+				AssignedToID: body.FollowUp.AssignedToID,
+				FollowUpOn:   followUpOn,
+				Status:       "pending",
+			}
+			if err := tx.Create(&fup).Error; err != nil {
+				return false, err
+			}
+			return true, syncLeadNextTalk(tx, lead.ID)
+
+		case "delete":
+			return true, deleteLeadRecord(tx, lead.ID)
+		}
+		return false, nil
+	}
+
+	results := make([]bulkLeadResult, 0, len(leads))
+	updated, unchanged, failed := 0, 0, 0
+	var changedIDs []uint
+	for i := range leads {
+		lead := &leads[i]
+		result := bulkLeadResult{LeadID: lead.ID, Status: "updated"}
+
+		// Each lead runs under a savepoint so its failure can be undone alone
+		tx.SavePoint("bulk_lead")
+		changed, err := apply(lead)
+		switch {
+		case err != nil:
+			tx.RollbackTo("bulk_lead")
+			result.Status = "failed"
+			result.Error = err.Error()
+			if he, ok := err.(*httpError); ok {
+				result.Error = he.Msg
+			}
+			failed++
+		case !changed:
+			result.Status = "unchanged"
+			unchanged++
+		default:
+			updated++
+			changedIDs = append(changedIDs, lead.ID)
+		}
+		results = append(results, result)
+	}
+
+	summary := fiber.Map{
+		"action":    body.Action,
+		"matched":   len(leads),
+		"updated":   updated,
+		"unchanged": unchanged,
+		"failed":    failed,
+		"results":   results,
+	}
+
+	if failed > 0 && body.AllOrNothing {
+		tx.Rollback()
+		summary["rolled_back"] = true
+		return c.Status(422).JSON(summary)
+	}
+
+	details := fiber.Map{
+		"matched":   len(leads),
+		"updated":   updated,
+		"unchanged": unchanged,
+		"failed":    failed,
+		"lead_ids":  changedIDs,
+	}
+	if len(body.IDs) > 0 {
+		details["ids"] = body.IDs
+	} else {
+		details["filter"] = body.Filter
+	}
+	switch body.Action {
+	case "reassign":
+		details["assigned_to_id"] = assignee.ID
+	case "stage":
+		details["stage_id"] = targetStage.ID
+		details["stage"] = targetStage.Name
+	case "tag_add", "tag_remove":
+		ids := make([]uint, len(tags))
+		for i, t := range tags {
+			ids[i] = t.ID
+		}
+		details["tag_ids"] = ids
+	case "followup":
+		details["followup"] = body.FollowUp
+	}
+	if err := recordAudit(tx, body.UserID, "lead.bulk_"+body.Action, "lead", nil, details); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to write audit entry", "detail": err.Error()})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(summary)
+}
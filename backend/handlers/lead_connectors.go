@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"erp.local/backend/models"
+)
+
+// LeadConnector pulls enquiries from a lead platform (IndiaMART, TradeIndia, JustDial, 99acres)
+type LeadConnector interface {
+	// FetchSince returns the records received after cursor and the cursor to store once they are saved
+	FetchSince(cursor string) ([]ExternalLeadRecord, string, error)
+	// MapLead converts a platform record to a CRM lead
+	MapLead(rec ExternalLeadRecord) models.Lead
+	// Ack tells the platform the records were stored; a no-op where the platform has no ack
+	Ack(records []ExternalLeadRecord) error
+}
+
+// ExternalLeadRecord is one enquiry as received from a lead platform
+type ExternalLeadRecord struct {
+	ExternalID string
+	ReceivedAt time.Time
+	Data       interface{} // provider specific payload
+}
+
+type leadConnectorSpec struct {
+	New func(integration models.Integration, client *leadPlatformClient) (LeadConnector, error)
+	// DefaultInterval between scheduled pulls; an integration may set "interval_minutes" in its config
+	DefaultInterval time.Duration
+	// MinInterval is the shortest interval the platform tolerates
+	MinInterval time.Duration
+	// MinGap between two HTTP calls to the platform
+	MinGap time.Duration
+}
+
+var leadConnectors = map[string]leadConnectorSpec{
+	"indiamart": {
+		New:             newIndiaMartConnector,
+		DefaultInterval: 10 * time.Minute,
+		MinInterval:     5 * time.Minute,
+		MinGap:          5 * time.Second,
+	},
+	"tradeindia": {
+		New:             newTradeIndiaConnector,
+		DefaultInterval: 10 * time.Minute,
+		MinInterval:     5 * time.Minute,
+		MinGap:          2 * time.Second,
+	},
+	"justdial": {
+		New:             newJustDialConnector,
+		DefaultInterval: 5 * time.Minute,
+		MinInterval:     time.Minute,
+		MinGap:          time.Second,
+	},
+	"99acres": {
+		New:             newAcres99Connector,
+		DefaultInterval: 15 * time.Minute,
+		MinInterval:     5 * time.Minute,
+		MinGap:          5 * time.Second,
+	},
+}
+
+// newLeadConnector builds the connector for an integration
+func newLeadConnector(integration models.Integration) (LeadConnector, error) {
+	spec, ok := leadConnectors[integration.Provider]
+	if !ok {
+		return nil, fmt.Errorf("lead sync is not supported for provider %s", integration.Provider)
+	}
+	return spec.New(integration, newLeadPlatformClient(integration.Provider))
+}
+
+// leadSyncInterval is how often an integration is pulled by the scheduler
+func leadSyncInterval(integration models.Integration) time.Duration {
+	spec := leadConnectors[integration.Provider]
+	interval := spec.DefaultInterval
+	if v := integrationConfigString(integration.Config, "interval_minutes"); v != "" {
+		if mins, err := strconv.Atoi(v); err == nil && mins > 0 {
+			interval = time.Duration(mins) * time.Minute
+		}
+	}
+	if interval < spec.MinInterval {
+		interval = spec.MinInterval
+	}
+	return interval
+}
+
+/* ========== RATE LIMIT & RETRY ========== */
+
+var errLeadPlatformRateLimited = errors.New("lead platform rate limit exceeded")
+
+// leadRateLimiter spaces out calls to one platform across all callers
+type leadRateLimiter struct {
+	mu     sync.Mutex
+	minGap time.Duration
+	next   time.Time
+}
+
+func (l *leadRateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	wait := l.next.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	l.next = now.Add(wait + l.minGap)
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+var (
+	leadRateLimitersMu sync.Mutex
+	leadRateLimiters   = make(map[string]*leadRateLimiter)
+)
+
+func leadRateLimiterFor(provider string) *leadRateLimiter {
+	leadRateLimitersMu.Lock()
+	defer leadRateLimitersMu.Unlock()
+
+	if l, ok := leadRateLimiters[provider]; ok {
+		return l
+	}
+	l := &leadRateLimiter{minGap: leadConnectors[provider].MinGap}
+	leadRateLimiters[provider] = l
+	return l
+}
+
+// leadRetryPolicy retries network errors, 429 and 5xx responses with exponential backoff
+type leadRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var defaultLeadRetryPolicy = leadRetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+func (p leadRetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			return min(time.Duration(secs)*time.Second, p.MaxDelay)
+		}
+	}
+	return min(p.BaseDelay<<attempt, p.MaxDelay)
+}
+
+// leadPlatformClient is the HTTP client shared by the lead connectors
+type leadPlatformClient struct {
+	provider string
+	http     *http.Client
+	limiter  *leadRateLimiter
+	retry    leadRetryPolicy
+}
+
+func newLeadPlatformClient(provider string) *leadPlatformClient {
+	return &leadPlatformClient{
+		provider: provider,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		limiter:  leadRateLimiterFor(provider),
+		retry:    defaultLeadRetryPolicy,
+	}
+}
+
+// Do sends the request built by newReq, retrying per the policy, and returns the final status and body
+func (c *leadPlatformClient) Do(newReq func() (*http.Request, error)) (int, []byte, error) {
+	var lastErr error
+
+	for attempt := 0; attempt < c.retry.MaxAttempts; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		c.limiter.Wait()
+		resp, err := c.http.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to connect to %s: %w", c.provider, err)
+			time.Sleep(c.retry.delay(attempt, nil))
+			continue
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("failed to read %s response: %w", c.provider, err)
+			time.Sleep(c.retry.delay(attempt, nil))
+			continue
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("%s returned status %d", c.provider, resp.StatusCode)
+			if resp.StatusCode == http.StatusTooManyRequests {
+				lastErr = errLeadPlatformRateLimited
+			}
+			if attempt < c.retry.MaxAttempts-1 {
+				time.Sleep(c.retry.delay(attempt, resp))
+			}
+			continue
+		}
+
+		return resp.StatusCode, body, nil
+	}
+
+	return 0, nil, lastErr
+}
+
+// Get is Do for a plain GET request
+func (c *leadPlatformClient) Get(url string) (int, []byte, error) {
+	return c.Do(func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, url, nil)
+	})
+}
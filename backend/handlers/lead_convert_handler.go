@@ -0,0 +1,361 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type ConvertLeadRequest struct {
+	// Link to this user instead of matching by mobile, email or GSTIN
+	CustomerID   *uint  `json:"customer_id"`
+	AddressTitle string `json:"address_title"`
+
+	// Open a draft quotation for the lead's product
+	CreateQuotation     bool  `json:"create_quotation"`
+	CompanyID           uint  `json:"company_id"`
+	CompanyBranchID     uint  `json:"company_branch_id"`
+	SeriesID            *uint `json:"series_id"`
+	SalesCreditPersonID *uint `json:"sales_credit_person_id"`
+	CreatedBy           *uint `json:"created_by"`
+}
+
+// customerCandidates limits customer matching to users who are not employees, existing
+// customers first
+func customerCandidates(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.User{}).Where("is_employee IS NOT TRUE").Order("is_customer DESC, id ASC")
+}
+
+// matchCustomerForLead finds an existing non-employee user with the lead's mobile, email or GSTIN
+func matchCustomerForLead(tx *gorm.DB, lead *models.Lead) (*models.User, error) {
+	var user models.User
+
+	if mobile := normalizeMobile(lead.Mobile); len(mobile) >= 6 {
+		err := customerCandidates(tx).Where(`RIGHT(regexp_replace(mobile_number, '\D', '', 'g'), 10) = ?`, mobile).First(&user).Error
+		if err == nil {
+			return &user, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+	}
+	if email := normalizeEmail(lead.Email); email != "" {
+		err := customerCandidates(tx).Where("LOWER(TRIM(email)) = ?", email).First(&user).Error
+		if err == nil {
+			return &user, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+	}
+	if gstin := strings.ToUpper(strings.TrimSpace(lead.GSTIN)); gstin != "" {
+		err := customerCandidates(tx).Where("UPPER(gstin_number) = ?", gstin).First(&user).Error
+		if err == nil {
+			return &user, nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// ConvertLead creates (or links) a customer User and address from a lead, marks the lead
+// converted and optionally opens a draft quotation for the lead's product
+func ConvertLead(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req ConvertLeadRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+	}
+	if req.CreateQuotation && (req.CompanyID == 0 || req.CompanyBranchID == 0) {
+		return c.Status(400).JSON(fiber.Map{"error": "company_id and company_branch_id are required to open a quotation"})
+	}
+	if req.AddressTitle == "" {
+		req.AddressTitle = "Billing"
+	}
+
+	tx := leadsDB.Begin()
+
+	var lead models.Lead
+	if err := tx.First(&lead, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if lead.ConvertedAt != nil {
+		tx.Rollback()
+		return c.Status(409).JSON(fiber.Map{"error": "Lead is already converted", "customer_id": lead.CustomerID})
+	}
+
+	// ---------------------------
+	// Customer
+	// ---------------------------
+	var customer *models.User
+	if req.CustomerID != nil {
+		var user models.User
+		if err := tx.First(&user, *req.CustomerID).Error; err != nil {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid customer_id"})
+		}
+		if user.IsEmployee {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": "customer_id belongs to an employee"})
+		}
+		customer = &user
+	} else {
+		matched, err := matchCustomerForLead(tx, &lead)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		customer = matched
+	}
+
+	customerCreated := false
+	if customer != nil {
+		updates := map[string]interface{}{}
+		if !customer.IsCustomer {
+			updates["is_customer"] = true
+		}
+		if customer.GSTINNumber == "" && lead.GSTIN != "" {
+			updates["gstin_number"] = strings.ToUpper(strings.TrimSpace(lead.GSTIN))
+		}
+		if customer.BusinessName == "" && lead.Business != "" {
+			updates["business_name"] = lead.Business
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(customer).Updates(updates).Error; err != nil {
+				tx.Rollback()
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+	} else {
+		// Users need a unique mobile and email
+		if strings.TrimSpace(lead.Mobile) == "" || strings.TrimSpace(lead.Email) == "" {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": "Lead needs a mobile number and email to create a customer"})
+		}
+
+		firstname, lastname := lead.Name, ""
+		if parts := strings.Fields(lead.Name); len(parts) > 1 {
+			firstname = strings.Join(parts[:len(parts)-1], " ")
+			lastname = parts[len(parts)-1]
+		}
+		if firstname == "" {
+			firstname = lead.Business
+		}
+
+		user := models.User{
+			Firstname:    firstname,
+			Lastname:     lastname,
+			Country:      lead.Country,
+			MobileNumber: strings.TrimSpace(lead.Mobile),
+			Email:        normalizeEmail(lead.Email),
+			Website:      lead.Website,
+			Active:       true,
+			BusinessName: lead.Business,
+			CompanyName:  lead.Business,
+			Designation:  lead.Designation,
+			IsCustomer:   true,
+			GSTINNumber:  strings.ToUpper(strings.TrimSpace(lead.GSTIN)),
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to create customer", "detail": err.Error()})
+		}
+		customer = &user
+		customerCreated = true
+	}
+
+	// ---------------------------
+	// Address
+	// ---------------------------
+	var address *models.UserAddress
+	if lead.AddressLine1 != "" || lead.AddressLine2 != "" || lead.City != "" || lead.State != "" {
+		var existing models.UserAddress
+		err := tx.Where("user_id = ? AND LOWER(address1) = LOWER(?) AND LOWER(city) = LOWER(?)", customer.ID, lead.AddressLine1, lead.City).
+			First(&existing).Error
+		if err == nil {
+			address = &existing
+		} else if err == gorm.ErrRecordNotFound {
+			newAddress := models.UserAddress{
+				UserID:   customer.ID,
+				Title:    req.AddressTitle,
+				Address1: lead.AddressLine1,
+				Address2: lead.AddressLine2,
+				City:     lead.City,
+				State:    lead.State,
+				Country:  lead.Country,
+				GSTIN:    strings.ToUpper(strings.TrimSpace(lead.GSTIN)),
+			}
+			if err := tx.Create(&newAddress).Error; err != nil {
+				tx.Rollback()
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to create address", "detail": err.Error()})
+			}
+			address = &newAddress
+		} else {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	// ---------------------------
+	// Mark lead converted
+	// ---------------------------
+	now := time.Now()
+	if err := tx.Model(&lead).Updates(map[string]interface{}{
+		"customer_id":  customer.ID,
+		"converted_at": now,
+	}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	wonStage, err := wonLeadStage(tx)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if wonStage != nil {
+		// Conversion closes the lead as won from whatever stage it is in
+		if err := moveLeadStage(tx, &lead, wonStage, nil, "Converted to customer", req.CreatedBy, false); err != nil {
+			tx.Rollback()
+			if he, ok := err.(*httpError); ok {
+				return c.Status(he.Status).JSON(fiber.Map{"error": he.Msg})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	// ---------------------------
+	// Optional draft quotation
+	// ---------------------------
+	var quotation *models.QuotationTable
+	var items []models.QuotationTableItems
+	if req.CreateQuotation {
+		if address == nil {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": "Lead has no address to quote against"})
+		}
+
+		q := models.QuotationTable{
+			SeriesID:          req.SeriesID,
+			QuotationDate:     now,
+			CompanyID:         req.CompanyID,
+			CompanyBranchID:   req.CompanyBranchID,
+			CustomerID:        customer.ID,
+			LeadID:            &lead.ID,
+			BillingAddressID:  address.ID,
+			ShippingAddressID: address.ID,
+			Status:            models.Qt_Draft,
+		}
+		if req.SalesCreditPersonID != nil {
+			q.SalesCreditPersonID = *req.SalesCreditPersonID
+		} else if lead.AssignedToID != nil {
+			q.SalesCreditPersonID = *lead.AssignedToID
+		}
+		if req.CreatedBy != nil {
+			q.CreatedBy = *req.CreatedBy
+		}
+		if lead.Name != "" {
+			contact := lead.Name
+			q.ContactPerson = &contact
+		}
+
+		if lead.ProductID != nil {
+			var product models.Product
+			if err := tx.Preload("Variants").Preload("Tax").Preload("Unit").First(&product, *lead.ProductID).Error; err == nil && product.IsActive {
+				productID := product.ID
+				item := models.QuotationTableItems{
+					ProductID:   &productID,
+					ProductCode: product.Code,
+					Description: product.Name,
+					Quantity:    1,
+					Units:       product.Unit.Name,
+					HsnCode:     product.HsnSacCode,
+				}
+				if rate, ok := currentSalesRate(&product, ""); ok {
+					item.Rate = rate
+				}
+				if product.GstPercent > 0 {
+					item.Gst = product.GstPercent
+				} else {
+					item.Gst = product.Tax.Percentage
+				}
+				recalculateQuotationItem(&item)
+				items = append(items, item)
+			}
+		}
+		recalculateQuotationTotals(&q, items)
+
+		series, err := resolveQuotationSeries(tx, &q)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		q.SeriesID = &series.ID
+
+		quotationNo, err := nextSeriesNumber(tx, &series, q.QuotationDate, q.CompanyBranchID, q.DocumentType)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		q.QuotationNumber = quotationNo
+
+		if err := resolveQuotationExchangeRate(tx, &q); err != nil {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		applyBaseCurrencyTotals(&q)
+
+		if q.SalesCreditPersonID != 0 {
+			var maxCount uint
+			if err := tx.Model(&models.QuotationTable{}).
+				Where("sales_credit_person_id = ?", q.SalesCreditPersonID).
+				Select("COALESCE(MAX(quotation_scp_count), 0)").
+				Scan(&maxCount).Error; err != nil {
+				tx.Rollback()
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			q.QuotationScpCount = maxCount + 1
+		}
+
+		if err := tx.Create(&q).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to create quotation", "detail": err.Error()})
+		}
+		for i := range items {
+			items[i].QuotationID = q.QuotationID
+		}
+		if len(items) > 0 {
+			if err := tx.Create(&items).Error; err != nil {
+				tx.Rollback()
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to create quotation items", "detail": err.Error()})
+			}
+		}
+		quotation = &q
+	}
+
+	tx.Commit()
+
+	lead.CustomerID = &customer.ID
+	lead.ConvertedAt = &now
+
+	return c.JSON(fiber.Map{
+		"lead":             lead,
+		"customer":         customer,
+		"customer_created": customerCreated,
+		"address":          address,
+		"quotation":        quotation,
+		"quotation_items":  items,
+	})
+}
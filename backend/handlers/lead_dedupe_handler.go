@@ -0,0 +1,491 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SQL forms of the normalised keys; matching expression indexes are created by the migration
+const (
+	leadMobileKeySQL = `RIGHT(regexp_replace(mobile, '\D', '', 'g'), 10)`
+	leadEmailKeySQL  = `LOWER(TRIM(email))`
+)
+
+// Fuzzy business matches below this similarity are not reported
+const leadBusinessSimilarityThreshold = 0.8
+
+// leadRecordTables hold rows that belong to a lead through lead_id. A merge moves them all to
+// the surviving lead; deleting a lead removes the Owned ones and detaches the rest.
+var leadRecordTables = []struct {
+	Model interface{}
+	Owned bool
+}{
+	{&models.LeadInteraction{}, true},
+	{&models.LeadFollowUp{}, true},
+	{&models.LeadStageHistory{}, true},
+	{&models.LeadAssignmentLog{}, true},
+	{&models.QuotationTable{}, false},
+	{&models.FollowUpReminderLog{}, true},
+	{&models.InboundEmail{}, false},
+	{&models.WhatsappMessage{}, false},
+}
+
+var (
+	nonDigitRe    = regexp.MustCompile(`\D`)
+	nonAlnumRe    = regexp.MustCompile(`[^a-z0-9]+`)
+	businessNoise = map[string]bool{
+		"m": true, "s": true, "ms": true, "the": true, "pvt": true, "private": true, "ltd": true, "limited": true,
+		"llp": true, "inc": true, "co": true, "company": true, "corp": true, "corporation": true, "and": true,
+	}
+)
+
+// normalizeMobile keeps the last 10 digits, dropping the country code, leading zero, spaces and dashes
+func normalizeMobile(mobile string) string {
+	digits := nonDigitRe.ReplaceAllString(mobile, "")
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return digits
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeBusinessName lowercases a company name and drops punctuation and legal suffixes
+func normalizeBusinessName(name string) string {
+	words := strings.Fields(nonAlnumRe.ReplaceAllString(strings.ToLower(name), " "))
+	kept := words[:0]
+	for _, w := range words {
+		if !businessNoise[w] {
+			kept = append(kept, w)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// businessSimilarity is 1 - normalised Levenshtein distance of two normalised names
+func businessSimilarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+type leadDuplicateCandidate struct {
+	Lead    models.Lead `json:"lead"`
+	Score   float64     `json:"score"`
+	Reasons []string    `json:"reasons"` // mobile | email | business | business_fuzzy
+}
+
+// findLeadDuplicates returns leads sharing the mobile or email of lead, or with a similar business name
+func findLeadDuplicates(db *gorm.DB, lead models.Lead, excludeID uint) ([]leadDuplicateCandidate, error) {
+	mobile := normalizeMobile(lead.Mobile)
+	email := normalizeEmail(lead.Email)
+	business := normalizeBusinessName(lead.Business)
+
+	conds := []string{}
+	args := []interface{}{}
+	if len(mobile) >= 6 {
+		conds = append(conds, leadMobileKeySQL+" = ?")
+		args = append(args, mobile)
+	}
+	if email != "" {
+		conds = append(conds, leadEmailKeySQL+" = ?")
+		args = append(args, email)
+	}
+	// Narrow fuzzy candidates to names sharing the longest word
+	if business != "" {
+		longest := ""
+		for _, w := range strings.Fields(business) {
+			if len(w) > len(longest) {
+				longest = w
+			}
+		}
+		if len(longest) >= 3 {
+			conds = append(conds, "LOWER(business) LIKE ?")
+			args = append(args, "%"+longest+"%")
+		}
+	}
+	if len(conds) == 0 {
+		return nil, nil
+	}
+
+	var rows []models.Lead
+	query := db.Where("("+strings.Join(conds, " OR ")+")", args...)
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	if err := query.Limit(500).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var candidates []leadDuplicateCandidate
+	for _, row := range rows {
+		cand := leadDuplicateCandidate{Lead: row}
+		if len(mobile) >= 6 && normalizeMobile(row.Mobile) == mobile {
+			cand.Reasons = append(cand.Reasons, "mobile")
+			cand.Score = 1
+		}
+		if email != "" && normalizeEmail(row.Email) == email {
+			cand.Reasons = append(cand.Reasons, "email")
+			cand.Score = 1
+		}
+		if sim := businessSimilarity(business, normalizeBusinessName(row.Business)); sim == 1 {
+			cand.Reasons = append(cand.Reasons, "business")
+			cand.Score = max(cand.Score, 0.9)
+		} else if sim >= leadBusinessSimilarityThreshold {
+			cand.Reasons = append(cand.Reasons, "business_fuzzy")
+			cand.Score = max(cand.Score, sim*0.8)
+		}
+		if len(cand.Reasons) > 0 {
+			cand.Score = round2(cand.Score)
+			candidates = append(candidates, cand)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	return candidates, nil
+}
+
+// findExactDuplicateLead returns the oldest lead with the same mobile or email, if any
+func findExactDuplicateLead(db *gorm.DB, mobileRaw, emailRaw string) (*models.Lead, error) {
+	mobile := normalizeMobile(mobileRaw)
+	email := normalizeEmail(emailRaw)
+
+	query := db.Order("id asc")
+	switch {
+	case len(mobile) >= 6 && email != "":
+		query = query.Where(leadMobileKeySQL+" = ? OR "+leadEmailKeySQL+" = ?", mobile, email)
+	case len(mobile) >= 6:
+		query = query.Where(leadMobileKeySQL+" = ?", mobile)
+	case email != "":
+		query = query.Where(leadEmailKeySQL+" = ?", email)
+	default:
+		return nil, nil
+	}
+
+	var lead models.Lead
+	if err := query.First(&lead).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &lead, nil
+}
+
+func sameUintPtr(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+/* ========== HANDLERS ========== */
+
+// GetLeadDuplicates lists possible duplicates of a lead
+func GetLeadDuplicates(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var lead models.Lead
+	if err := leadsDB.First(&lead, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	candidates, err := findLeadDuplicates(leadsDB, lead, lead.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(candidates)
+}
+
+// CheckLeadDuplicates lists existing leads matching an unsaved lead (business, mobile, email)
+func CheckLeadDuplicates(c *fiber.Ctx) error {
+	var lead models.Lead
+	if err := json.Unmarshal(c.Body(), &lead); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	candidates, err := findLeadDuplicates(leadsDB, lead, 0)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(candidates)
+}
+
+type MergeLeadsRequest struct {
+	SurvivorID  uint `json:"survivor_id"`
+	DuplicateID uint `json:"duplicate_id"`
+	// Fields (lead JSON names) whose value should be taken from the duplicate even when the survivor has one
+	PreferDuplicate []string `json:"prefer_duplicate"`
+	MergedBy        *uint    `json:"merged_by"`
+}
+
+// MergeLeads folds the duplicate lead into the survivor: empty survivor fields are filled from the
+// duplicate, interactions and follow-ups are re-pointed to the survivor and the duplicate is deleted.
+func MergeLeads(c *fiber.Ctx) error {
+	var req MergeLeadsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if req.SurvivorID == 0 || req.DuplicateID == 0 || req.SurvivorID == req.DuplicateID {
+		return c.Status(400).JSON(fiber.Map{"error": "survivor_id and a different duplicate_id are required"})
+	}
+
+	tx := leadsDB.Begin()
+
+	var survivor, duplicate models.Lead
+	if err := tx.First(&survivor, req.SurvivorID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(404).JSON(fiber.Map{"error": "Survivor lead not found"})
+	}
+	if err := tx.First(&duplicate, req.DuplicateID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(404).JSON(fiber.Map{"error": "Duplicate lead not found"})
+	}
+
+	snapshot, _ := json.Marshal(duplicate)
+	before := survivor
+	mergeLeadFields(&survivor, &duplicate, req.PreferDuplicate)
+
+	// Re-point everything recorded against the duplicate to the survivor
+	var interactions, followUps int
+	for _, t := range leadRecordTables {
+		moved := tx.Model(t.Model).Where("lead_id = ?", duplicate.ID).Update("lead_id", survivor.ID)
+		if moved.Error != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": moved.Error.Error()})
+		}
+		switch t.Model.(type) {
+		case *models.LeadInteraction:
+			interactions = int(moved.RowsAffected)
+		case *models.LeadFollowUp:
+			followUps = int(moved.RowsAffected)
+		}
+	}
+
+	// A stage taken over from the duplicate is a stage change of the survivor
+	if !sameUintPtr(before.StageID, survivor.StageID) || before.Stage != survivor.Stage {
+		entry := models.LeadStageHistory{
+			LeadID:            survivor.ID,
+			FromStageID:       before.StageID,
+			FromStage:         before.Stage,
+			ToStageID:         survivor.StageID,
+			ToStage:           survivor.Stage,
+			RejectionReasonID: survivor.RejectionReasonID,
+			Remarks:           fmt.Sprintf("Merged from lead #%d", duplicate.ID),
+			ChangedByID:       req.MergedBy,
+			ChangedAt:         time.Now(),
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	// Delete the duplicate before saving so its external identity can move to the survivor
+	if err := tx.Model(&duplicate).Association("CRMTags").Clear(); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Delete(&duplicate).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Omit(clause.Associations).Save(&survivor).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := applyLeadTagText(tx, &survivor); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	// An assignee taken over from the duplicate is logged and notified like any reassignment
+	if !sameUintPtr(before.AssignedToID, survivor.AssignedToID) {
+		reason := fmt.Sprintf("Merged from lead #%d", duplicate.ID)
+		if err := recordLeadAssignment(tx, &survivor, before.AssignedToID, nil, "merge", reason); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	mergeLog := models.LeadMergeLog{
+		SurvivorID:   survivor.ID,
+		MergedID:     duplicate.ID,
+		MergedLead:   snapshot,
+		Interactions: interactions,
+		FollowUps:    followUps,
+		MergedBy:     req.MergedBy,
+	}
+	if err := tx.Create(&mergeLog).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := syncLeadNextTalk(tx, survivor.ID); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := syncLeadFirstResponse(tx, survivor.ID); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx.Commit()
+
+	touchLeadScore(survivor.ID)
+
+	return c.JSON(fiber.Map{
+		"lead":               survivor,
+		"merged_id":          duplicate.ID,
+		"interactions_moved": interactions,
+		"followups_moved":    followUps,
+		"merge_log_id":       mergeLog.ID,
+	})
+}
+
+// mergeLeadFields fills the survivor from the duplicate. Text fields are taken when empty on the
+// survivor (or when listed in prefer); notes and requirements are appended, tags are united, the
+// earliest Since and latest LastTalk are kept.
+func mergeLeadFields(survivor, duplicate *models.Lead, prefer []string) {
+	preferDup := map[string]bool{}
+	for _, f := range prefer {
+		preferDup[f] = true
+	}
+
+	texts := []struct {
+		name string
+		dst  *string
+		src  string
+	}{
+		{"business", &survivor.Business, duplicate.Business},
+		{"name", &survivor.Name, duplicate.Name},
+		{"designation", &survivor.Designation, duplicate.Designation},
+		{"mobile", &survivor.Mobile, duplicate.Mobile},
+		{"email", &survivor.Email, duplicate.Email},
+		{"addressLine1", &survivor.AddressLine1, duplicate.AddressLine1},
+		{"addressLine2", &survivor.AddressLine2, duplicate.AddressLine2},
+		{"city", &survivor.City, duplicate.City},
+		{"state", &survivor.State, duplicate.State},
+		{"country", &survivor.Country, duplicate.Country},
+		{"source", &survivor.Source, duplicate.Source},
+		{"gstin", &survivor.GSTIN, duplicate.GSTIN},
+		{"category", &survivor.Category, duplicate.Category},
+		{"website", &survivor.Website, duplicate.Website},
+		{"assignedToName", &survivor.AssignedToName, duplicate.AssignedToName},
+		{"productName", &survivor.ProductName, duplicate.ProductName},
+	}
+	for _, t := range texts {
+		if t.src != "" && (*t.dst == "" || preferDup[t.name]) {
+			*t.dst = t.src
+		}
+	}
+
+	appendText := func(dst *string, src string) {
+		src = strings.TrimSpace(src)
+		if src == "" || strings.Contains(*dst, src) {
+			return
+		}
+		if *dst == "" {
+			*dst = src
+		} else {
+			*dst += "\n" + src
+		}
+	}
+	appendText(&survivor.Requirements, duplicate.Requirements)
+	appendText(&survivor.Notes, duplicate.Notes)
+
+	if duplicate.Tags != "" {
+		seen := map[string]bool{}
+		var tags []string
+		for _, t := range strings.Split(survivor.Tags+","+duplicate.Tags, ",") {
+			t = strings.TrimSpace(t)
+			if t != "" && !seen[strings.ToLower(t)] {
+				seen[strings.ToLower(t)] = true
+				tags = append(tags, t)
+			}
+		}
+		survivor.Tags = strings.Join(tags, ",")
+	}
+
+	// The stage moves as a whole so the text, stage row and rejection reason stay in step
+	if duplicate.StageID != nil || duplicate.Stage != "" {
+		if (survivor.StageID == nil && survivor.Stage == "") || preferDup["stage"] || preferDup["stage_id"] {
+			survivor.Stage = duplicate.Stage
+			survivor.StageID = duplicate.StageID
+			survivor.StageChangedAt = duplicate.StageChangedAt
+			survivor.RejectionReasonID = duplicate.RejectionReasonID
+		}
+	}
+
+	// A conversion is never lost: an unconverted survivor takes the duplicate's customer
+	if survivor.CustomerID == nil && duplicate.CustomerID != nil {
+		survivor.CustomerID = duplicate.CustomerID
+		survivor.ConvertedAt = duplicate.ConvertedAt
+	}
+
+	if duplicate.Potential > survivor.Potential || preferDup["potential"] {
+		survivor.Potential = duplicate.Potential
+	}
+	if survivor.AssignedToID == nil || preferDup["assigned_to_id"] {
+		if duplicate.AssignedToID != nil {
+			survivor.AssignedToID = duplicate.AssignedToID
+		}
+	}
+	if survivor.ProductID == nil || preferDup["product_id"] {
+		if duplicate.ProductID != nil {
+			survivor.ProductID = duplicate.ProductID
+		}
+	}
+	if survivor.ExternalID == nil && duplicate.ExternalID != nil {
+		survivor.ExternalSource = duplicate.ExternalSource
+		survivor.ExternalID = duplicate.ExternalID
+	}
+
+	if !duplicate.Since.IsZero() && (survivor.Since.IsZero() || duplicate.Since.Before(survivor.Since)) {
+		survivor.Since = duplicate.Since
+	}
+	if duplicate.LastTalk.After(survivor.LastTalk) {
+		survivor.LastTalk = duplicate.LastTalk
+	}
+	if !duplicate.NextTalk.IsZero() && (survivor.NextTalk.IsZero() || duplicate.NextTalk.Before(survivor.NextTalk)) {
+		survivor.NextTalk = duplicate.NextTalk
+	}
+	survivor.UpdatedAt = time.Now()
+}
@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Leads read from the database per round trip while an export streams
+const leadExportBatch = 500
+
+/* ========== COLUMNS ========== */
+
+type leadExportColumn struct {
+	Key    string
+	Header string
+	Value  func(l *models.Lead, assignee string) interface{}
+}
+
+// exportTime formats a lead date in IST; unset dates (zero or the 0001 placeholder) are blank
+func exportTime(t time.Time) string {
+	if t.Year() <= 1900 {
+		return ""
+	}
+	return t.In(istLocation).Format("2006-01-02 15:04")
+}
+
+func exportTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return exportTime(*t)
+}
+
+// leadExportColumns in their default order; ?columns= picks and orders a subset by key
+var leadExportColumns = []leadExportColumn{
+	{"id", "ID", func(l *models.Lead, _ string) interface{} { return l.ID }},
+	{"business", "Business", func(l *models.Lead, _ string) interface{} { return l.Business }},
+	{"contact", "Contact", func(l *models.Lead, _ string) interface{} { return l.Name }},
+	{"designation", "Designation", func(l *models.Lead, _ string) interface{} { return l.Designation }},
+	{"mobile", "Mobile", func(l *models.Lead, _ string) interface{} { return l.Mobile }},
+	{"email", "Email", func(l *models.Lead, _ string) interface{} { return l.Email }},
+	{"address_line1", "Address Line 1", func(l *models.Lead, _ string) interface{} { return l.AddressLine1 }},
+	{"address_line2", "Address Line 2", func(l *models.Lead, _ string) interface{} { return l.AddressLine2 }},
+	{"city", "City", func(l *models.Lead, _ string) interface{} { return l.City }},
+	{"state", "State", func(l *models.Lead, _ string) interface{} { return l.State }},
+	{"country", "Country", func(l *models.Lead, _ string) interface{} { return l.Country }},
+	{"source", "Source", func(l *models.Lead, _ string) interface{} { return l.Source }},
+	{"stage", "Stage", func(l *models.Lead, _ string) interface{} { return l.Stage }},
+	{"potential", "Potential", func(l *models.Lead, _ string) interface{} { return l.Potential }},
+	{"score", "Score", func(l *models.Lead, _ string) interface{} { return l.Score }},
+	{"category", "Category", func(l *models.Lead, _ string) interface{} { return l.Category }},
+	{"product", "Product", func(l *models.Lead, _ string) interface{} { return l.ProductName }},
+	{"requirements", "Requirements", func(l *models.Lead, _ string) interface{} { return l.Requirements }},
+	{"gstin", "GSTIN", func(l *models.Lead, _ string) interface{} { return l.GSTIN }},
+	{"website", "Website", func(l *models.Lead, _ string) interface{} { return l.Website }},
+	{"tags", "Tags", func(l *models.Lead, _ string) interface{} {
+		titles := make([]string, len(l.CRMTags))
+		for i, t := range l.CRMTags {
+			titles[i] = t.Title
+		}
+		return strings.Join(titles, ", ")
+	}},
+	{"assigned_to", "Assigned To", func(_ *models.Lead, assignee string) interface{} { return assignee }},
+	{"since", "Since", func(l *models.Lead, _ string) interface{} { return exportTime(l.Since) }},
+	{"last_talk", "Last Talk", func(l *models.Lead, _ string) interface{} { return exportTime(l.LastTalk) }},
+	{"next_talk", "Next Talk", func(l *models.Lead, _ string) interface{} { return exportTime(l.NextTalk) }},
+	{"first_response_at", "First Response", func(l *models.Lead, _ string) interface{} { return exportTimePtr(l.FirstResponseAt) }},
+	{"sla_breached", "SLA Breached", func(l *models.Lead, _ string) interface{} {
+		if l.SLABreached {
+			return "Yes"
+		}
+		return "No"
+	}},
+	{"notes", "Notes", func(l *models.Lead, _ string) interface{} { return l.Notes }},
+	{"created_at", "Created At", func(l *models.Lead, _ string) interface{} { return exportTime(l.CreatedAt) }},
+	{"updated_at", "Updated At", func(l *models.Lead, _ string) interface{} { return exportTime(l.UpdatedAt) }},
+}
+
+// selectLeadExportColumns resolves a comma separated list of column keys; empty means all
+func selectLeadExportColumns(list string) ([]leadExportColumn, error) {
+	if strings.TrimSpace(list) == "" {
+		return leadExportColumns, nil
+	}
+
+	byKey := make(map[string]leadExportColumn, len(leadExportColumns))
+	for _, col := range leadExportColumns {
+		byKey[col.Key] = col
+	}
+
+	var selected []leadExportColumn
+	var unknown []string
+	seen := map[string]bool{}
+	for _, key := range strings.Split(list, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		col, ok := byKey[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		selected = append(selected, col)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown columns: %s", strings.Join(unknown, ", "))
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no columns selected")
+	}
+	return selected, nil
+}
+
+// leadAssigneeNames maps assigned user IDs of a batch to display names
+func leadAssigneeNames(db *gorm.DB, leads []models.Lead) (map[uint]string, error) {
+	ids := []uint{}
+	for _, l := range leads {
+		if l.AssignedToID != nil {
+			ids = append(ids, *l.AssignedToID)
+		}
+	}
+	names := map[uint]string{}
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	var users []models.User
+	if err := db.Select("id", "firstname", "lastname").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		names[u.ID] = strings.TrimSpace(u.Firstname + " " + u.Lastname)
+	}
+	return names, nil
+}
+
+/* ========== HANDLERS ========== */
+
+// ExportLeads streams every lead matching the GetAllLeads filters as CSV or XLSX.
+// Query: format=csv|xlsx (default csv), columns=id,business,... (default all), user_id,
+// plus the lead filters. Leads are read in batches, so the export never sits in memory.
+func ExportLeads(c *fiber.Ctx) error {
+	format := strings.ToLower(c.Query("format", "csv"))
+	if format != "csv" && format != "xlsx" {
+		return c.Status(400).JSON(fiber.Map{"error": "format must be csv or xlsx"})
+	}
+	columns, err := selectLeadExportColumns(c.Query("columns"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	query := applyLeadFilters(leadsDB.Model(&models.Lead{}), func(key string) string { return c.Query(key) })
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Exports carry contact data; record who took what before anything is sent
+	filters := map[string]string{}
+	for _, key := range leadFilterKeys {
+		if v := c.Query(key); v != "" {
+			filters[key] = v
+		}
+	}
+	keys := make([]string, len(columns))
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		keys[i] = col.Key
+		headers[i] = col.Header
+	}
+	var userID *uint
+	if id := c.QueryInt("user_id", 0); id > 0 {
+		uid := uint(id)
+		userID = &uid
+	}
+	if err := recordAudit(leadsDB, userID, "lead.export", "lead", nil, fiber.Map{
+		"format":  format,
+		"filters": filters,
+		"columns": keys,
+		"rows":    total,
+		"ip":      c.IP(),
+	}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	fileName := "leads-" + time.Now().In(istLocation).Format("20060102-1504") + "." + format
+	if format == "xlsx" {
+		c.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	} else {
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+	c.Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	db := leadsDB
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var writeRow func(values []interface{}) error
+		var finish func() error
+
+		if format == "xlsx" {
+			xw, err := newXLSXStreamWriter(w, "Leads")
+			if err != nil {
+				log.Printf("lead export: %v", err)
+				return
+			}
+			if err := xw.WriteHeader(headers); err != nil {
+				log.Printf("lead export: %v", err)
+				return
+			}
+			writeRow = xw.WriteRow
+			finish = xw.Close
+		} else {
+			w.WriteString("\ufeff") // BOM so Excel reads the file as UTF-8
+			cw := csv.NewWriter(w)
+			_ = cw.Write(headers)
+			line := make([]string, len(columns))
+			writeRow = func(values []interface{}) error {
+				for i, v := range values {
+					switch t := v.(type) {
+					case float64:
+						line[i] = strconv.FormatFloat(t, 'f', -1, 64)
+					default:
+						line[i] = escapeSpreadsheetFormula(fmt.Sprint(t))
+					}
+				}
+				return cw.Write(line)
+			}
+			finish = func() error {
+				cw.Flush()
+				return cw.Error()
+			}
+		}
+
+		var batch []models.Lead
+		result := query.Preload("CRMTags").FindInBatches(&batch, leadExportBatch, func(tx *gorm.DB, _ int) error {
+			names, err := leadAssigneeNames(db, batch)
+			if err != nil {
+				return err
+			}
+			values := make([]interface{}, len(columns))
+			for i := range batch {
+				lead := &batch[i]
+				assignee := lead.AssignedToName
+				if lead.AssignedToID != nil && names[*lead.AssignedToID] != "" {
+					assignee = names[*lead.AssignedToID]
+				}
+				for j, col := range columns {
+					values[j] = col.Value(lead, assignee)
+				}
+				if err := writeRow(values); err != nil {
+					return err
+				}
+			}
+			// Push each batch to the client as it is written
+			return w.Flush()
+		})
+		if result.Error != nil {
+			log.Printf("lead export: stopped early: %v", result.Error)
+		}
+		if err := finish(); err != nil {
+			log.Printf("lead export: %v", err)
+		}
+		w.Flush()
+	})
+	return nil
+}
@@ -50,6 +50,7 @@ func CreateLeadFollowUp(c *fiber.Ctx) error {
 		Title:        body.Title,
 		Notes:        body.Notes,
 		AssignedToID: body.AssignedToID,
+		Status:       "pending",
 	}
 
 	followTime, err := time.Parse(time.RFC3339, body.FollowUpOn)
@@ -62,6 +63,10 @@ func CreateLeadFollowUp(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if err := syncLeadNextTalk(leadFollowupDB, fup.LeadID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	return c.Status(201).JSON(fup)
 }
 
@@ -116,6 +121,9 @@ func UpdateLeadFollowUp(c *fiber.Ctx) error {
 		fup.Notes = *body.Notes
 	}
 	if body.Status != nil {
+		if !followUpStatuses[*body.Status] {
+			return c.Status(400).JSON(fiber.Map{"error": "Status must be pending, done, skipped or cancelled"})
+		}
 		fup.Status = *body.Status
 	}
 	if body.FollowUpOn != nil {
@@ -123,6 +131,11 @@ func UpdateLeadFollowUp(c *fiber.Ctx) error {
 		if err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid FollowUpOn format"})
 		}
+		// A rescheduled follow-up is reminded and escalated afresh
+		if !t.Equal(fup.FollowUpOn) {
+			fup.ReminderSentAt = nil
+			fup.EscalatedAt = nil
+		}
 		fup.FollowUpOn = t
 	}
 	if body.AssignedToID != nil {
@@ -133,6 +146,10 @@ func UpdateLeadFollowUp(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if err := syncLeadNextTalk(leadFollowupDB, fup.LeadID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	return c.JSON(fup)
 }
 
@@ -151,5 +168,9 @@ func DeleteLeadFollowUp(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if err := syncLeadNextTalk(leadFollowupDB, fup.LeadID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	return c.JSON(fiber.Map{"message": "Follow-up deleted successfully"})
 }
@@ -3,7 +3,7 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
-	"sort"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -19,6 +19,52 @@ func SetLeadsDB(db *gorm.DB) {
 	leadsDB = db
 }
 
+// insertLead creates a lead the way every entry point should: it applies the lead's stage
+// (reporting false when the named stage is unknown and the default was used), records the entry
+// into that stage, sets the first-response due time from the source's SLA, maps the free text
+// tags onto CRM tags and runs the assignment rules when no assignee was given.
+func insertLead(db *gorm.DB, lead *models.Lead) (bool, error) {
+	found, err := applyLeadStage(db, lead)
+	if err != nil {
+		return false, err
+	}
+	if err := applyLeadSLA(db, lead); err != nil {
+		return false, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("CRMTags").Create(lead).Error; err != nil {
+			return err
+		}
+		if lead.Tags != "" {
+			if err := applyLeadTagText(tx, lead); err != nil {
+				return err
+			}
+		}
+		if lead.StageID != nil {
+			history := models.LeadStageHistory{
+				LeadID:    lead.ID,
+				ToStageID: lead.StageID,
+				ToStage:   lead.Stage,
+				ChangedAt: *lead.StageChangedAt,
+			}
+			if err := tx.Create(&history).Error; err != nil {
+				return err
+			}
+		}
+		if lead.AssignedToID != nil {
+			if err := recordLeadAssignment(tx, lead, nil, nil, "manual", "Assigned on creation"); err != nil {
+				return err
+			}
+		} else if lead.AssignedToName == "" {
+			if _, err := autoAssignLead(tx, lead); err != nil {
+				return err
+			}
+		}
+		return refreshLeadScore(tx, lead)
+	})
+	return found, err
+}
+
 // 📌 Create Lead
 func CreateLead(c *fiber.Ctx) error {
 	var lead models.Lead
@@ -53,7 +99,17 @@ func CreateLead(c *fiber.Ctx) error {
 		}
 	}
 
-	if err := leadsDB.Create(&lead).Error; err != nil {
+	if lead.StageID == nil && lead.Stage != "" {
+		stage, err := resolveLeadStage(leadsDB, lead.Stage)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if stage == nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Unknown lead stage"})
+		}
+	}
+
+	if _, err := insertLead(leadsDB, &lead); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -61,6 +117,40 @@ func CreateLead(c *fiber.Ctx) error {
 	return c.JSON(lead)
 }
 
+// leadFilterKeys are the filters GetAllLeads accepts; bulk actions and exports take the same
+var leadFilterKeys = []string{"contact", "stage", "city", "tags", "tag_mode", "min_score", "max_score", "sla_breached"}
+
+// applyLeadFilters narrows a leads query by the list filters; get returns a filter's value by name
+func applyLeadFilters(query *gorm.DB, get func(key string) string) *gorm.DB {
+	if contact := get("contact"); contact != "" {
+		query = query.Where("contact ILIKE ?", "%"+contact+"%")
+	}
+	if stage := get("stage"); stage != "" {
+		query = query.Where("stage = ?", stage)
+	}
+	if city := get("city"); city != "" {
+		query = query.Where("city ILIKE ?", "%"+city+"%")
+	}
+	// Tag filter: tags=<id|code|title>,... with tag_mode=any (default) or all
+	if tags := get("tags"); tags != "" {
+		query = leadTagFilter(query, strings.Split(tags, ","), get("tag_mode") == "all")
+	}
+	if minScore := get("min_score"); minScore != "" {
+		if v, err := strconv.ParseFloat(minScore, 64); err == nil {
+			query = query.Where("score >= ?", v)
+		}
+	}
+	if maxScore := get("max_score"); maxScore != "" {
+		if v, err := strconv.ParseFloat(maxScore, 64); err == nil {
+			query = query.Where("score <= ?", v)
+		}
+	}
+	if breached := get("sla_breached"); breached != "" {
+		query = query.Where("sla_breached = ?", breached == "true")
+	}
+	return query
+}
+
 // 📌 Get All Leads with Pagination & Filtering
 func GetAllLeads(c *fiber.Ctx) error {
 	page := c.QueryInt("page", 1)
@@ -74,25 +164,26 @@ func GetAllLeads(c *fiber.Ctx) error {
 	offset := (page - 1) * limit
 
 	// Don't preload relations - use text fields instead
-	query := leadsDB
-
-	if contact := c.Query("contact"); contact != "" {
-		query = query.Where("contact ILIKE ?", "%"+contact+"%")
-	}
-	if stage := c.Query("stage"); stage != "" {
-		query = query.Where("stage = ?", stage)
-	}
-	if city := c.Query("city"); city != "" {
-		query = query.Where("city ILIKE ?", "%"+city+"%")
-	}
+	query := applyLeadFilters(leadsDB.Model(&models.Lead{}), func(key string) string { return c.Query(key) })
 
 	var total int64
-	if err := query.Model(&models.Lead{}).Count(&total).Error; err != nil {
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// Optional ordering: sort=score|potential|created_at|next_talk, order=asc|desc (default desc)
+	sortColumns := map[string]string{"score": "score", "potential": "potential", "created_at": "created_at", "next_talk": "next_talk"}
+	if column, ok := sortColumns[c.Query("sort")]; ok {
+		direction := "desc"
+		if strings.EqualFold(c.Query("order"), "asc") {
+			direction = "asc"
+		}
+		query = query.Order(column + " " + direction).Order("id desc")
+	}
+
+	// Only tags are preloaded; assignee and product use the text fields
 	var leads []models.Lead
-	if err := query.Offset(offset).Limit(limit).Find(&leads).Error; err != nil {
+	if err := query.Preload("CRMTags").Offset(offset).Limit(limit).Find(&leads).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -109,8 +200,8 @@ func GetAllLeads(c *fiber.Ctx) error {
 func GetLeadByID(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var lead models.Lead
-	// Don't preload relations - use text fields instead
-	if err := leadsDB.First(&lead, id).Error; err != nil {
+	// Only tags are preloaded; assignee and product use the text fields
+	if err := leadsDB.Preload("CRMTags").First(&lead, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
 	}
 	return c.JSON(lead)
@@ -155,6 +246,7 @@ func UpdateLead(c *fiber.Ctx) error {
 	if err := leadsDB.First(&lead, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
 	}
+	before := lead
 
 	req.UpdatedAt = time.Now()
 
@@ -178,19 +270,158 @@ func UpdateLead(c *fiber.Ctx) error {
 		}
 	}
 
-	if err := leadsDB.Model(&lead).Updates(req).Error; err != nil {
+	// Stage changes go through the transition rules; a repeated current stage is not a change
+	var targetStage *models.LeadStage
+	if req.StageID != nil {
+		var stage models.LeadStage
+		if err := leadsDB.First(&stage, *req.StageID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(400).JSON(fiber.Map{"error": "Invalid stage_id", "detail": "stage not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to validate stage", "detail": err.Error()})
+		}
+		targetStage = &stage
+	} else if req.Stage != "" && !strings.EqualFold(req.Stage, lead.Stage) {
+		stage, err := resolveLeadStage(leadsDB, req.Stage)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to validate stage", "detail": err.Error()})
+		}
+		if stage == nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Unknown lead stage"})
+		}
+		targetStage = stage
+	}
+
+	prevAssignee := lead.AssignedToID
+	_, tagsSent := payload["tags"]
+	tagsSent = tagsSent || req.Tags != ""
+
+	tx := leadsDB.Begin()
+	if err := tx.Model(&lead).Omit("stage", "stage_id", "stage_changed_at", "rejection_reason_id", "tags", "CRMTags",
+		"first_response_at", "sla_due_at", "sla_breached", "sla_breached_at", "score", "scored_at",
+		"customer_id", "converted_at", "external_source", "external_id").Updates(req).Error; err != nil {
+		tx.Rollback()
 		// Return DB error for easier debugging
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to update lead", "detail": err.Error()})
 	}
+	if tagsSent {
+		lead.Tags = req.Tags
+		if err := applyLeadTagText(tx, &lead); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to update tags", "detail": err.Error()})
+		}
+	}
+	if req.AssignedToID != nil && (prevAssignee == nil || *prevAssignee != *req.AssignedToID) {
+		lead.AssignedToID = req.AssignedToID
+		if err := recordLeadAssignment(tx, &lead, prevAssignee, nil, "manual", "Reassigned"); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to log assignment", "detail": err.Error()})
+		}
+	}
+	if targetStage != nil {
+		if err := changeLeadStage(tx, &lead, targetStage, req.RejectionReasonID, "", nil); err != nil {
+			tx.Rollback()
+			if he, ok := err.(*httpError); ok {
+				return c.Status(he.Status).JSON(fiber.Map{"error": he.Msg})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to change stage", "detail": err.Error()})
+		}
+	}
 
-	// Reload lead without preloading empty relations
-	if err := leadsDB.First(&lead, id).Error; err != nil {
+	// Field edits go to the audit log for the lead timeline; stage and assignee have their own logs
+	var after models.Lead
+	if err := tx.First(&after, lead.ID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch updated lead", "detail": err.Error()})
+	}
+	if changes := leadChanges(&before, &after); len(changes) > 0 {
+		var userID *uint
+		if uid := c.QueryInt("user_id", 0); uid > 0 {
+			u := uint(uid)
+			userID = &u
+		}
+		if err := recordAudit(tx, userID, "lead.update", "lead", &lead.ID, fiber.Map{"changes": changes}); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to write audit entry", "detail": err.Error()})
+		}
+	}
+	tx.Commit()
+
+	touchLeadScore(lead.ID)
+
+	// Reload lead with its tags only
+	if err := leadsDB.Preload("CRMTags").First(&lead, id).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch updated lead", "detail": err.Error()})
 	}
 
 	return c.JSON(lead)
 }
 
+// Lead JSON keys left out of edit history: timestamps, relations, and fields that have their
+// own logs (stage history, assignment log) or are maintained by the system
+var leadChangeSkip = map[string]bool{
+	"contact": true, "created_at": true, "updated_at": true,
+	"assigned_to": true, "product": true, "crm_tags": true,
+	"stage": true, "stage_id": true, "stage_changed_at": true, "rejection_reason_id": true,
+	"assigned_to_id": true, "score": true, "scored_at": true,
+	"first_response_at": true, "sla_due_at": true, "sla_breached": true, "sla_breached_at": true,
+	"customer_id": true, "converted_at": true, "external_source": true, "external_id": true,
+}
+
+// leadChanges lists the fields that differ between two versions of a lead as {"from", "to"}
+func leadChanges(before, after *models.Lead) map[string]fiber.Map {
+	var from, to map[string]interface{}
+	rawFrom, _ := json.Marshal(before)
+	rawTo, _ := json.Marshal(after)
+	if json.Unmarshal(rawFrom, &from) != nil || json.Unmarshal(rawTo, &to) != nil {
+		return nil
+	}
+
+	changes := map[string]fiber.Map{}
+	for key, v := range to {
+		if leadChangeSkip[key] || reflect.DeepEqual(from[key], v) {
+			continue
+		}
+		changes[key] = fiber.Map{"from": from[key], "to": v}
+	}
+	return changes
+}
+
+// deleteLeadRecord deletes a lead with its own activity (interactions, follow-ups, stage and
+// assignment history, reminder logs). Quotations, mail and WhatsApp messages are kept but
+// detached; matched mail goes back to the triage queue. Run it inside a transaction.
+func deleteLeadRecord(db *gorm.DB, id uint) error {
+	const ownInteractions = "interaction_id IN (SELECT id FROM lead_interactions WHERE lead_id = ?)"
+	if err := db.Model(&models.InboundEmail{}).Where(ownInteractions, id).Update("interaction_id", nil).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.WhatsappMessage{}).Where(ownInteractions, id).Update("interaction_id", nil).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.InboundEmail{}).Where("lead_id = ? AND status IN ?", id, []string{"matched", "assigned"}).
+		Updates(map[string]interface{}{"status": "unmatched", "matched_by": ""}).Error; err != nil {
+		return err
+	}
+
+	for _, t := range leadRecordTables {
+		var err error
+		if t.Owned {
+			err = db.Where("lead_id = ?", id).Delete(t.Model).Error
+		} else {
+			err = db.Model(t.Model).Where("lead_id = ?", id).Update("lead_id", nil).Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Tag links go first as the join table references the lead
+	if err := db.Model(&models.Lead{ID: id}).Association("CRMTags").Clear(); err != nil {
+		return err
+	}
+	return db.Delete(&models.Lead{}, id).Error
+}
+
 // 📌 Delete Lead
 func DeleteLead(c *fiber.Ctx) error {
 	idParam := c.Params("id")
@@ -200,53 +431,29 @@ func DeleteLead(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid lead id"})
 	}
 
-	if err := leadsDB.Delete(&models.Lead{}, uint(parsed)).Error; err != nil {
+	tx := leadsDB.Begin()
+	if err := deleteLeadRecord(tx, uint(parsed)); err != nil {
+		tx.Rollback()
 		// return actual DB error for easier debugging on client
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	return c.JSON(fiber.Map{"message": "Lead deleted successfully"})
-}
-
-// 📌 Lead Timeline (combined interactions & followups)
-func GetLeadTimeline(c *fiber.Ctx) error {
-	id := c.Params("id")
-	// Load interactions and followups
-	var interactions []models.LeadInteraction
-	var followups []models.LeadFollowUp
-
-	if err := leadInteractionDB.Preload("AssignedTo").Where("lead_id = ?", id).Find(&interactions).Error; err != nil {
+	if err := tx.Commit().Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	if err := leadFollowupDB.Preload("AssignedTo").Where("lead_id = ?", id).Find(&followups).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-	}
-
-	type timelineItem struct {
-		Type      string      `json:"type"`
-		Timestamp time.Time   `json:"timestamp"`
-		Item      interface{} `json:"item"`
-	}
-
-	var timeline []timelineItem
-	for _, it := range interactions {
-		timeline = append(timeline, timelineItem{Type: "interaction", Timestamp: it.Timestamp, Item: it})
-	}
-	for _, f := range followups {
-		timeline = append(timeline, timelineItem{Type: "followup", Timestamp: f.FollowUpOn, Item: f})
-	}
-
-	// Sort by timestamp descending
-	sort.Slice(timeline, func(i, j int) bool {
-		return timeline[i].Timestamp.After(timeline[j].Timestamp)
-	})
-
-	return c.JSON(timeline)
+	return c.JSON(fiber.Map{"message": "Lead deleted successfully"})
 }
 
 // 📌 Import Leads (Bulk Create)
+// Query: duplicates=insert (default) | skip | update. Duplicates match an existing lead on
+// normalised mobile or email; update overwrites it with the non-empty imported values.
 func ImportLeads(c *fiber.Ctx) error {
 	var leadsPayload []map[string]interface{}
 
+	mode := c.Query("duplicates", "insert")
+	if mode != "insert" && mode != "skip" && mode != "update" {
+		return c.Status(400).JSON(fiber.Map{"error": "duplicates must be insert, skip or update"})
+	}
+
 	if err := c.BodyParser(&leadsPayload); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input", "detail": err.Error()})
 	}
@@ -260,172 +467,15 @@ func ImportLeads(c *fiber.Ctx) error {
 
 	// Validate and process each lead
 	var createdLeads []models.Lead
+	var updatedLeads []models.Lead
+	var skipped []map[string]interface{}
 	var errors []map[string]interface{}
+	var warnings []map[string]interface{}
 
 	for i, payload := range leadsPayload {
 		fmt.Printf("DEBUG: Processing row %d with payload: %+v\n", i+1, payload)
 
-		lead := models.Lead{}
-
-		// Helper: case-insensitive string lookup
-		getString := func(key string) string {
-			if v, ok := payload[key]; ok {
-				switch t := v.(type) {
-				case string:
-					return strings.TrimSpace(t)
-				case float64:
-					return fmt.Sprintf("%v", t)
-				}
-			}
-			lk := strings.ToLower(key)
-			for k, v := range payload {
-				if strings.ToLower(k) == lk {
-					if s, ok := v.(string); ok {
-						return strings.TrimSpace(s)
-					}
-					if f, ok := v.(float64); ok {
-						return fmt.Sprintf("%v", f)
-					}
-				}
-			}
-			return ""
-		}
-
-		// Helper: try multiple keys, return first non-empty
-		getAny := func(keys ...string) string {
-			for _, k := range keys {
-				if s := getString(k); s != "" {
-					return s
-				}
-			}
-			return ""
-		}
-
-		// Helper: get float from multiple keys
-		getFloat := func(keys ...string) float64 {
-			for _, k := range keys {
-				if v, ok := payload[k]; ok {
-					switch t := v.(type) {
-					case float64:
-						return t
-					case string:
-						if f, err := strconv.ParseFloat(strings.TrimSpace(t), 64); err == nil {
-							return f
-						}
-					}
-				}
-				// case-insensitive search
-				lk := strings.ToLower(k)
-				for kk, vv := range payload {
-					if strings.ToLower(kk) == lk {
-						switch tt := vv.(type) {
-						case float64:
-							return tt
-						case string:
-							if f, err := strconv.ParseFloat(strings.TrimSpace(tt), 64); err == nil {
-								return f
-							}
-						}
-					}
-				}
-			}
-			return 0
-		}
-
-		// Helper: parse date/time from common formats
-		parseDate := func(val string) (time.Time, bool) {
-			val = strings.TrimSpace(val)
-			if val == "" {
-				return time.Time{}, false
-			}
-			// Try RFC3339/ISO
-			if t, err := time.Parse(time.RFC3339, val); err == nil {
-				return t, true
-			}
-			// Try common formats
-			layouts := []string{"02-01-2006", "02-01-2006 15:04", "02-01-2006 15:04:05", "2006-01-02", "2006/01/02", "02/01/2006", "2006-01-02T15:04:05Z07:00"}
-			for _, l := range layouts {
-				if t, err := time.Parse(l, val); err == nil {
-					return t, true
-				}
-			}
-			// Last attempt: try parsing as float (Excel serial) - skip for now
-			return time.Time{}, false
-		}
-
-		// Map payload to lead struct (support common key variants)
-		lead.Business = getAny("business", "company", "buyer_company")
-		lead.Name = getAny("name", "contact", "buyerName", "buyer_name")
-		lead.Designation = getAny("designation", "role")
-		lead.Mobile = getAny("mobile", "phone", "phone_no", "buyer_mobile")
-		lead.Email = getAny("email", "buyer_email")
-		lead.AddressLine1 = getAny("addressLine1", "address", "buyer_address")
-		lead.AddressLine2 = getAny("addressLine2", "address2")
-		lead.City = getAny("city", "buyer_city")
-		lead.State = getAny("state", "buyer_state")
-		lead.Country = getAny("country", "buyer_country")
-		lead.Source = getAny("source", "enquiry_source", "enquirySource")
-		lead.Stage = getAny("stage", "lead_stage")
-		lead.Potential = getFloat("potential", "estimated_value", "estimatedValue")
-		lead.GSTIN = getAny("gstin")
-		lead.Category = getAny("category", "lead_category")
-		lead.Website = getAny("website")
-		lead.Requirements = getAny("requirements", "requirement", "buyer_requirement", "message")
-		lead.Notes = getAny("notes")
-
-		// Tags may come as array or comma separated string
-		if v, ok := payload["tags"]; ok {
-			switch t := v.(type) {
-			case string:
-				lead.Tags = strings.TrimSpace(t)
-			case []interface{}:
-				parts := []string{}
-				for _, it := range t {
-					if s, ok := it.(string); ok {
-						parts = append(parts, strings.TrimSpace(s))
-					}
-				}
-				lead.Tags = strings.Join(parts, ",")
-			}
-		} else if v := getAny("lead_tags", "tags"); v != "" {
-			lead.Tags = v
-		}
-
-		// Parse time fields if provided
-		if s := getAny("since", "createdAt", "created_at", "enquiryDate", "enquiry_date"); s != "" {
-			if dt, ok := parseDate(s); ok {
-				lead.Since = dt
-			}
-		}
-		if s := getAny("lastTalk", "last_talk"); s != "" {
-			if dt, ok := parseDate(s); ok {
-				lead.LastTalk = dt
-			}
-		}
-		if s := getAny("nextTalk", "next_talk", "next_followup", "nextFollowup"); s != "" {
-			if dt, ok := parseDate(s); ok {
-				lead.NextTalk = dt
-			}
-		}
-		if s := getAny("transferredOn", "transferred_on"); s != "" {
-			if dt, ok := parseDate(s); ok {
-				lead.TransferredOn = dt
-			}
-		}
-
-		// Clean up Created/Updated timestamps
-		lead.CreatedAt = time.Now()
-		lead.UpdatedAt = time.Now()
-
-		// AssignedTo (store name if provided)
-		if assigned := getAny("assignedTo", "assignedToName", "assigned_to", "assigned_to_name"); assigned != "" {
-			lead.AssignedToName = assigned
-		}
-
-		// Product (store name)
-		if p := getAny("product", "productName", "product_name"); p != "" {
-			lead.ProductName = p
-		}
+		lead := leadFromImportRow(payload)
 
 		// Validate required fields
 		if lead.Business == "" || lead.Name == "" || lead.Mobile == "" || lead.Email == "" {
@@ -440,18 +490,37 @@ func ImportLeads(c *fiber.Ctx) error {
 			continue
 		}
 
-		// Create the lead
-		if err := leadsDB.Create(&lead).Error; err != nil {
-			fmt.Printf("DEBUG: Failed to create lead: %s\n", err.Error())
+		outcome, existing, warning, rowErr := importLeadRow(leadsDB, &lead, mode)
+		if rowErr != nil {
 			errors = append(errors, map[string]interface{}{
 				"row":      i + 2,
 				"lead":     lead.Name,
 				"business": lead.Business,
-				"error":    "Failed to create lead",
-				"detail":   err.Error(),
+				"error":    rowErr.Msg,
+				"detail":   rowErr.Detail,
+			})
+			continue
+		}
+		if outcome == "skipped" {
+			skipped = append(skipped, map[string]interface{}{
+				"row":         i + 2,
+				"lead":        lead.Name,
+				"business":    lead.Business,
+				"existing_id": existing.ID,
 			})
 			continue
 		}
+		if outcome == "updated" {
+			updatedLeads = append(updatedLeads, *existing)
+			continue
+		}
+		if warning != "" {
+			warnings = append(warnings, map[string]interface{}{
+				"row":     i + 2,
+				"lead":    lead.Name,
+				"warning": warning,
+			})
+		}
 
 		fmt.Printf("DEBUG: Successfully created lead ID %d\n", lead.ID)
 
@@ -461,9 +530,14 @@ func ImportLeads(c *fiber.Ctx) error {
 	fmt.Printf("DEBUG: Import complete - Created: %d, Errors: %d\n", len(createdLeads), len(errors))
 
 	return c.JSON(fiber.Map{
-		"created": len(createdLeads),
-		"failed":  len(errors),
-		"leads":   createdLeads,
-		"errors":  errors,
+		"created":       len(createdLeads),
+		"updated":       len(updatedLeads),
+		"skipped":       len(skipped),
+		"failed":        len(errors),
+		"leads":         createdLeads,
+		"updated_leads": updatedLeads,
+		"skipped_rows":  skipped,
+		"errors":        errors,
+		"warnings":      warnings,
 	})
 }
@@ -0,0 +1,804 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/mail"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Upper bound of data rows accepted from one uploaded file
+const leadImportMaxRows = 10000
+
+// leadImportFields are the lead fields a spreadsheet column can fill, with the column headers
+// recognised when no mapping is given. Headers compare after normalizeImportHeader.
+var leadImportFields = []struct {
+	Field   string
+	Headers []string
+}{
+	{"business", []string{"business", "company", "company name", "buyer company"}},
+	{"salutation", []string{"salutation", "title"}},
+	{"name", []string{"name", "contact", "contact name", "contact person", "buyer name"}},
+	{"designation", []string{"designation", "role"}},
+	{"mobile", []string{"mobile", "phone", "mobile number", "phone no", "buyer mobile"}},
+	{"email", []string{"email", "email id", "buyer email"}},
+	{"addressLine1", []string{"address line 1", "address", "address 1"}},
+	{"addressLine2", []string{"address line 2", "address 2"}},
+	{"city", []string{"city"}},
+	{"state", []string{"state"}},
+	{"country", []string{"country"}},
+	{"source", []string{"source", "enquiry source", "lead source"}},
+	{"stage", []string{"stage", "lead stage"}},
+	{"potential", []string{"potential", "potential (₹)", "estimated value", "value"}},
+	{"since", []string{"since", "created at", "enquiry date"}},
+	{"gstin", []string{"gstin", "gst no", "gst number"}},
+	{"productName", []string{"product", "product name"}},
+	{"assignedToName", []string{"assigned to", "assignee", "owner"}},
+	{"category", []string{"category", "lead category"}},
+	{"website", []string{"website"}},
+	{"requirements", []string{"requirement", "requirements", "message"}},
+	{"notes", []string{"notes", "remarks"}},
+	{"tags", []string{"tags"}},
+	{"lastTalk", []string{"last talk"}},
+	{"nextTalk", []string{"next talk", "next follow up", "next followup"}},
+}
+
+/* ========== ROW MAPPING ========== */
+
+// normalizeImportHeader lowercases a column header and keeps only letters and digits, so
+// "Potential (₹)", "potential" and "POTENTIAL" compare equal
+func normalizeImportHeader(h string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimPrefix(strings.TrimSpace(h), "\ufeff")) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// parseImportAmount reads an amount written like "50000", "50,000" or "₹ 50,000.00"
+func parseImportAmount(s string) (float64, error) {
+	s = strings.NewReplacer("₹", "", "Rs.", "", "Rs", "", "INR", "", ",", "", " ", "").Replace(strings.TrimSpace(s))
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseImportDate reads the date formats seen in lead spreadsheets, including Excel serial dates
+func parseImportDate(val string) (time.Time, bool) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return time.Time{}, false
+	}
+	// Try RFC3339/ISO
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, true
+	}
+	// Try common formats
+	layouts := []string{"02-01-2006", "02-01-2006 15:04", "02-01-2006 15:04:05", "2006-01-02", "2006-01-02 15:04:05", "2006/01/02", "02/01/2006", "02/01/2006 15:04", "2006-01-02T15:04:05Z07:00"}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l, val, istLocation); err == nil {
+			return t, true
+		}
+	}
+	// Excel serial date (days since 1899-12-30), as XLSX stores date cells
+	if f, err := strconv.ParseFloat(val, 64); err == nil && f > 1 && f < 100000 {
+		base := time.Date(1899, 12, 30, 0, 0, 0, 0, istLocation)
+		return base.Add(time.Duration(f * 24 * float64(time.Hour))).Round(time.Second), true
+	}
+	return time.Time{}, false
+}
+
+// leadFromImportRow maps one import row (keyed by lead field or a common variant of it) onto a lead
+func leadFromImportRow(payload map[string]interface{}) models.Lead {
+	lead := models.Lead{}
+
+	// Helper: case-insensitive string lookup
+	getString := func(key string) string {
+		if v, ok := payload[key]; ok {
+			switch t := v.(type) {
+			case string:
+				return strings.TrimSpace(t)
+			case float64:
+				return fmt.Sprintf("%v", t)
+			}
+		}
+		lk := strings.ToLower(key)
+		for k, v := range payload {
+			if strings.ToLower(k) == lk {
+				if s, ok := v.(string); ok {
+					return strings.TrimSpace(s)
+				}
+				if f, ok := v.(float64); ok {
+					return fmt.Sprintf("%v", f)
+				}
+			}
+		}
+		return ""
+	}
+
+	// Helper: try multiple keys, return first non-empty
+	getAny := func(keys ...string) string {
+		for _, k := range keys {
+			if s := getString(k); s != "" {
+				return s
+			}
+		}
+		return ""
+	}
+
+	// Helper: get float from multiple keys
+	getFloat := func(keys ...string) float64 {
+		for _, k := range keys {
+			if v, ok := payload[k]; ok {
+				switch t := v.(type) {
+				case float64:
+					return t
+				case string:
+					if f, err := parseImportAmount(t); err == nil {
+						return f
+					}
+				}
+			}
+			// case-insensitive search
+			lk := strings.ToLower(k)
+			for kk, vv := range payload {
+				if strings.ToLower(kk) == lk {
+					switch tt := vv.(type) {
+					case float64:
+						return tt
+					case string:
+						if f, err := parseImportAmount(tt); err == nil {
+							return f
+						}
+					}
+				}
+			}
+		}
+		return 0
+	}
+
+	// Map payload to lead struct (support common key variants)
+	lead.Business = getAny("business", "company", "buyer_company")
+	lead.Name = getAny("name", "contact", "buyerName", "buyer_name")
+	if salutation := getAny("salutation"); salutation != "" && lead.Name != "" {
+		lead.Name = salutation + " " + lead.Name
+	}
+	lead.Designation = getAny("designation", "role")
+	lead.Mobile = getAny("mobile", "phone", "phone_no", "buyer_mobile")
+	lead.Email = getAny("email", "buyer_email")
+	lead.AddressLine1 = getAny("addressLine1", "address", "buyer_address")
+	lead.AddressLine2 = getAny("addressLine2", "address2")
+	lead.City = getAny("city", "buyer_city")
+	lead.State = getAny("state", "buyer_state")
+	lead.Country = getAny("country", "buyer_country")
+	lead.Source = getAny("source", "enquiry_source", "enquirySource")
+	lead.Stage = getAny("stage", "lead_stage")
+	lead.Potential = getFloat("potential", "estimated_value", "estimatedValue")
+	lead.GSTIN = getAny("gstin")
+	lead.Category = getAny("category", "lead_category")
+	lead.Website = getAny("website")
+	lead.Requirements = getAny("requirements", "requirement", "buyer_requirement", "message")
+	lead.Notes = getAny("notes")
+
+	// Tags may come as array or comma separated string
+	if v, ok := payload["tags"]; ok {
+		switch t := v.(type) {
+		case string:
+			lead.Tags = strings.TrimSpace(t)
+		case []interface{}:
+			parts := []string{}
+			for _, it := range t {
+				if s, ok := it.(string); ok {
+					parts = append(parts, strings.TrimSpace(s))
+				}
+			}
+			lead.Tags = strings.Join(parts, ",")
+		}
+	} else if v := getAny("lead_tags", "tags"); v != "" {
+		lead.Tags = v
+	}
+
+	// Parse time fields if provided
+	if s := getAny("since", "createdAt", "created_at", "enquiryDate", "enquiry_date"); s != "" {
+		if dt, ok := parseImportDate(s); ok {
+			lead.Since = dt
+		}
+	}
+	if s := getAny("lastTalk", "last_talk"); s != "" {
+		if dt, ok := parseImportDate(s); ok {
+			lead.LastTalk = dt
+		}
+	}
+	if s := getAny("nextTalk", "next_talk", "next_followup", "nextFollowup"); s != "" {
+		if dt, ok := parseImportDate(s); ok {
+			lead.NextTalk = dt
+		}
+	}
+	if s := getAny("transferredOn", "transferred_on"); s != "" {
+		if dt, ok := parseImportDate(s); ok {
+			lead.TransferredOn = dt
+		}
+	}
+
+	// Clean up Created/Updated timestamps
+	lead.CreatedAt = time.Now()
+	lead.UpdatedAt = time.Now()
+
+	// AssignedTo (store name if provided)
+	if assigned := getAny("assignedTo", "assignedToName", "assigned_to", "assigned_to_name"); assigned != "" {
+		lead.AssignedToName = assigned
+	}
+
+	// Product (store name)
+	if p := getAny("product", "productName", "product_name"); p != "" {
+		lead.ProductName = p
+	}
+
+	return lead
+}
+
+// leadImportError is a row that could not be written: a short message plus the cause
+type leadImportError struct {
+	Msg    string
+	Detail string
+}
+
+// importLeadRow writes one import row, honouring the duplicates mode: insert always creates,
+// skip leaves a lead with the same mobile or email alone and update overwrites it. The outcome
+// is created, updated or skipped; warning notes a stage that fell back to the default.
+func importLeadRow(db *gorm.DB, lead *models.Lead, mode string) (outcome string, existing *models.Lead, warning string, rowErr *leadImportError) {
+	if mode != "insert" {
+		existing, err := findExactDuplicateLead(db, lead.Mobile, lead.Email)
+		if err != nil {
+			return "", nil, "", &leadImportError{"Failed to check duplicates", err.Error()}
+		}
+		if existing != nil && mode == "skip" {
+			return "skipped", existing, "", nil
+		}
+		if existing != nil {
+			if err := db.Model(existing).Omit("id", "created_at", "external_source", "external_id", "stage", "stage_id", "stage_changed_at", "rejection_reason_id", "tags", "CRMTags").Updates(*lead).Error; err != nil {
+				return "", nil, "", &leadImportError{"Failed to update duplicate lead", err.Error()}
+			}
+			if lead.Tags != "" {
+				existing.Tags = lead.Tags
+				if err := applyLeadTagText(db, existing); err != nil {
+					return "", nil, "", &leadImportError{"Failed to map tags", err.Error()}
+				}
+			}
+			if err := refreshLeadScore(db, existing); err != nil {
+				return "", nil, "", &leadImportError{"Failed to score lead", err.Error()}
+			}
+			return "updated", existing, "", nil
+		}
+	}
+
+	// Create the lead; an unknown stage falls back to the default stage
+	requestedStage := lead.Stage
+	found, err := insertLead(db, lead)
+	if err != nil {
+		return "", nil, "", &leadImportError{"Failed to create lead", err.Error()}
+	}
+	if !found {
+		warning = fmt.Sprintf("Unknown stage '%s'; set to %s", requestedStage, lead.Stage)
+	}
+	return "created", nil, warning, nil
+}
+
+/* ========== FILE PARSING ========== */
+
+// validateLeadImportMap checks an import map is an object of lead field -> column header
+func validateLeadImportMap(raw []byte) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var importMap map[string]string
+	if err := json.Unmarshal(raw, &importMap); err != nil {
+		return fmt.Errorf("import_map must be an object of lead field to column header")
+	}
+	for field := range importMap {
+		known := false
+		for _, f := range leadImportFields {
+			if f.Field == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("import_map: unknown lead field %q", field)
+		}
+	}
+	return nil
+}
+
+// leadImportColumns resolves which column fills each lead field: the mapping first, then the
+// recognised headers. It returns field -> column index and field -> header of what was used.
+func leadImportColumns(headers []string, mapping map[string]string) (map[string]int, map[string]string, error) {
+	byHeader := make(map[string]int, len(headers))
+	for i, h := range headers {
+		key := normalizeImportHeader(h)
+		if _, seen := byHeader[key]; key != "" && !seen {
+			byHeader[key] = i
+		}
+	}
+
+	columns := map[string]int{}
+	used := map[string]string{}
+	for _, f := range leadImportFields {
+		if header, ok := mapping[f.Field]; ok {
+			if strings.TrimSpace(header) == "" {
+				continue // explicitly left unmapped
+			}
+			i, found := byHeader[normalizeImportHeader(header)]
+			if !found {
+				return nil, nil, fmt.Errorf("column %q mapped to %s is not in the file", header, f.Field)
+			}
+			columns[f.Field] = i
+			used[f.Field] = headers[i]
+			continue
+		}
+		for _, alias := range f.Headers {
+			if i, found := byHeader[normalizeImportHeader(alias)]; found {
+				columns[f.Field] = i
+				used[f.Field] = headers[i]
+				break
+			}
+		}
+	}
+	return columns, used, nil
+}
+
+// readLeadImportFile returns the rows of an uploaded .csv or .xlsx file, header row first
+func readLeadImportFile(file *multipart.FileHeader) ([][]string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(file.Filename)) {
+	case ".csv", ".txt":
+		r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+		r.TrimLeadingSpace = true
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %v", err)
+		}
+		return rows, nil
+	case ".xlsx":
+		return readXLSXRows(bytes.NewReader(data), int64(len(data)))
+	default:
+		return nil, fmt.Errorf("upload a .csv or .xlsx file")
+	}
+}
+
+// leadImportRowIssue is one file row with the problems found in it
+type leadImportRowIssue struct {
+	Row    int      `json:"row"`
+	Values []string `json:"values,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+	// Warnings do not stop the row from being imported
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// validateLeadImportRow checks a mapped row before it is written
+func validateLeadImportRow(lead *models.Lead, values map[string]string) []string {
+	var errs []string
+	if lead.Business == "" {
+		errs = append(errs, "Business is required")
+	}
+	if lead.Name == "" {
+		errs = append(errs, "Name is required")
+	}
+	if lead.Mobile == "" {
+		errs = append(errs, "Mobile is required")
+	} else if n := len(normalizeMobile(lead.Mobile)); n < 10 || n > 15 {
+		errs = append(errs, fmt.Sprintf("Mobile '%s' must have 10 to 15 digits", lead.Mobile))
+	}
+	if lead.Email == "" {
+		errs = append(errs, "Email is required")
+	} else if _, err := mail.ParseAddress(lead.Email); err != nil {
+		errs = append(errs, fmt.Sprintf("Email '%s' is not valid", lead.Email))
+	}
+	if v := values["potential"]; v != "" {
+		if _, err := parseImportAmount(v); err != nil {
+			errs = append(errs, fmt.Sprintf("Potential '%s' is not a number", v))
+		}
+	}
+	for _, field := range []string{"since", "lastTalk", "nextTalk"} {
+		if v := values[field]; v != "" {
+			if _, ok := parseImportDate(v); !ok {
+				errs = append(errs, fmt.Sprintf("%s '%s' is not a recognised date", field, v))
+			}
+		}
+	}
+	return errs
+}
+
+/* ========== HANDLERS ========== */
+
+// ImportLeadsFile imports leads from an uploaded CSV or XLSX file.
+// Form fields: file (required), source_id, mapping (JSON lead field -> column header; defaults to
+// the source's saved import map, then to recognised headers), save_mapping, duplicates
+// (insert, skip or update), dry_run, strict (commit nothing when any row is invalid), user_id.
+// A dry run only validates. A commit writes every valid row in one transaction; if any write
+// fails the whole import is rolled back. Invalid rows are kept for the error report.
+func ImportLeadsFile(c *fiber.Ctx) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "file is required"})
+	}
+
+	mode := c.FormValue("duplicates", "insert")
+	if mode != "insert" && mode != "skip" && mode != "update" {
+		return c.Status(400).JSON(fiber.Map{"error": "duplicates must be insert, skip or update"})
+	}
+	dryRun := c.FormValue("dry_run") == "true"
+	strict := c.FormValue("strict") == "true"
+
+	record := models.LeadImport{
+		FileName: file.Filename,
+		Mode:     mode,
+		DryRun:   dryRun,
+	}
+	if uid, err := strconv.ParseUint(c.FormValue("user_id"), 10, 64); err == nil && uid > 0 {
+		id := uint(uid)
+		record.CreatedByID = &id
+	}
+
+	var source *models.LeadSource
+	if sid := c.FormValue("source_id"); sid != "" {
+		var s models.LeadSource
+		if err := leadsDB.First(&s, sid).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(400).JSON(fiber.Map{"error": "Lead source not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		source = &s
+		record.SourceID = &s.ID
+	}
+
+	// Column mapping: the request's, else the one saved on the source
+	rawMapping := []byte(c.FormValue("mapping"))
+	if len(rawMapping) == 0 && source != nil {
+		rawMapping = source.ImportMap
+	}
+	if err := validateLeadImportMap(rawMapping); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	mapping := map[string]string{}
+	if len(rawMapping) > 0 && string(rawMapping) != "null" {
+		_ = json.Unmarshal(rawMapping, &mapping)
+	}
+
+	rows, err := readLeadImportFile(file)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(rows) < 2 {
+		return c.Status(400).JSON(fiber.Map{"error": "No leads to import"})
+	}
+	headers := rows[0]
+	for i := range headers {
+		headers[i] = strings.TrimSpace(strings.TrimPrefix(headers[i], "\ufeff"))
+	}
+
+	columns, used, err := leadImportColumns(headers, mapping)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	var unmapped []string
+	for i, h := range headers {
+		mapped := false
+		for _, col := range columns {
+			if col == i {
+				mapped = true
+				break
+			}
+		}
+		if !mapped && h != "" {
+			unmapped = append(unmapped, h)
+		}
+	}
+
+	if c.FormValue("save_mapping") == "true" && source != nil {
+		saved, _ := json.Marshal(used)
+		if err := leadsDB.Model(source).Update("import_map", datatypes.JSON(saved)).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	type importRow struct {
+		Row    int
+		Values []string
+		Lead   models.Lead
+	}
+	var valid []importRow
+	var issues []leadImportRowIssue
+	var warnings []leadImportRowIssue
+	stageKnown := map[string]bool{}
+	firstSeen := map[string]int{}
+
+	for i, cells := range rows[1:] {
+		rowNo := i + 2
+		blank := true
+		for _, cell := range cells {
+			if strings.TrimSpace(cell) != "" {
+				blank = false
+				break
+			}
+		}
+		if blank {
+			continue
+		}
+		record.TotalRows++
+		if record.TotalRows > leadImportMaxRows {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("A file may hold at most %d leads", leadImportMaxRows)})
+		}
+
+		values := map[string]string{}
+		payload := map[string]interface{}{}
+		for field, col := range columns {
+			if col < len(cells) {
+				values[field] = strings.TrimSpace(cells[col])
+				payload[field] = values[field]
+			}
+		}
+		lead := leadFromImportRow(payload)
+		if lead.Source == "" && source != nil {
+			lead.Source = source.Name
+		}
+
+		var rowWarnings []string
+		if len(cells) > len(headers) {
+			rowWarnings = append(rowWarnings, fmt.Sprintf("Row has %d values but the header has %d columns", len(cells), len(headers)))
+		}
+		if lead.Stage != "" {
+			key := strings.ToLower(lead.Stage)
+			known, checked := stageKnown[key]
+			if !checked {
+				stage, err := resolveLeadStage(leadsDB, lead.Stage)
+				known = err == nil && stage != nil
+				stageKnown[key] = known
+			}
+			if !known {
+				rowWarnings = append(rowWarnings, fmt.Sprintf("Unknown stage '%s'; the default stage will be used", lead.Stage))
+			}
+		}
+		for _, key := range []string{normalizeMobile(lead.Mobile), normalizeEmail(lead.Email)} {
+			if key == "" {
+				continue
+			}
+			if first, seen := firstSeen[key]; seen {
+				rowWarnings = append(rowWarnings, fmt.Sprintf("Same mobile or email as row %d", first))
+				break
+			}
+			firstSeen[key] = rowNo
+		}
+
+		if errs := validateLeadImportRow(&lead, values); len(errs) > 0 {
+			issues = append(issues, leadImportRowIssue{Row: rowNo, Values: cells, Errors: errs, Warnings: rowWarnings})
+			continue
+		}
+		if len(rowWarnings) > 0 {
+			warnings = append(warnings, leadImportRowIssue{Row: rowNo, Warnings: rowWarnings})
+		}
+		valid = append(valid, importRow{Row: rowNo, Values: cells, Lead: lead})
+	}
+	record.Failed = len(issues)
+
+	var preview []fiber.Map
+	var leadIDs []uint
+	switch {
+	case dryRun:
+		record.Status = "validated"
+		for _, r := range valid {
+			action := "create"
+			if mode != "insert" {
+				existing, err := findExactDuplicateLead(leadsDB, r.Lead.Mobile, r.Lead.Email)
+				if err != nil {
+					return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+				}
+				if existing != nil {
+					action = mode
+				}
+			}
+			switch action {
+			case "create":
+				record.Created++
+			case "update":
+				record.Updated++
+			case "skip":
+				record.Skipped++
+			}
+			if len(preview) < 20 {
+				preview = append(preview, fiber.Map{"row": r.Row, "action": action, "lead": r.Lead})
+			}
+		}
+
+	case strict && len(issues) > 0:
+		record.Status = "rejected"
+		record.Message = fmt.Sprintf("%d invalid rows; nothing was imported", len(issues))
+
+	default:
+		tx := leadsDB.Begin()
+		var failure *leadImportError
+		failedRow := 0
+		for i := range valid {
+			r := &valid[i]
+			outcome, existing, warning, rowErr := importLeadRow(tx, &r.Lead, mode)
+			if rowErr != nil {
+				failure, failedRow = rowErr, r.Row
+				issues = append(issues, leadImportRowIssue{Row: r.Row, Values: r.Values, Errors: []string{rowErr.Msg + ": " + rowErr.Detail}})
+				break
+			}
+			switch outcome {
+			case "created":
+				record.Created++
+				leadIDs = append(leadIDs, r.Lead.ID)
+			case "updated":
+				record.Updated++
+				leadIDs = append(leadIDs, existing.ID)
+			case "skipped":
+				record.Skipped++
+			}
+			if warning != "" {
+				warnings = append(warnings, leadImportRowIssue{Row: r.Row, Warnings: []string{warning}})
+			}
+		}
+
+		if failure != nil {
+			tx.Rollback()
+			record.Status = "rolled_back"
+			record.Message = fmt.Sprintf("Row %d: %s; nothing was imported", failedRow, failure.Msg)
+			record.Created, record.Updated, record.Skipped = 0, 0, 0
+			record.Failed = len(issues)
+			leadIDs = nil
+		} else if err := tx.Commit().Error; err != nil {
+			record.Status = "rolled_back"
+			record.Message = err.Error()
+			record.Created, record.Updated, record.Skipped = 0, 0, 0
+			leadIDs = nil
+		} else {
+			record.Status = "committed"
+		}
+	}
+
+	mappingJSON, _ := json.Marshal(used)
+	headersJSON, _ := json.Marshal(headers)
+	issuesJSON, _ := json.Marshal(issues)
+	record.Mapping = mappingJSON
+	record.Headers = headersJSON
+	record.Errors = issuesJSON
+	if err := leadsDB.Create(&record).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	response := fiber.Map{
+		"import_id":        record.ID,
+		"dry_run":          dryRun,
+		"status":           record.Status,
+		"message":          record.Message,
+		"total_rows":       record.TotalRows,
+		"valid":            len(valid),
+		"created":          record.Created,
+		"updated":          record.Updated,
+		"skipped":          record.Skipped,
+		"failed":           record.Failed,
+		"mapping":          used,
+		"unmapped_headers": unmapped,
+		"errors":           issues,
+		"warnings":         warnings,
+	}
+	if dryRun {
+		response["preview"] = preview
+	} else {
+		response["lead_ids"] = leadIDs
+	}
+	if len(issues) > 0 {
+		response["error_report"] = fmt.Sprintf("/api/lead-imports/%d/errors", record.ID)
+	}
+
+	status := 200
+	if record.Status == "rolled_back" || record.Status == "rejected" {
+		status = 422
+	}
+	return c.Status(status).JSON(response)
+}
+
+// GetLeadImports lists past file imports, newest first. Query: source_id, limit
+func GetLeadImports(c *fiber.Ctx) error {
+	query := leadsDB.Omit("errors").Order("created_at desc")
+	if sid := c.QueryInt("source_id", 0); sid > 0 {
+		query = query.Where("source_id = ?", sid)
+	}
+
+	var imports []models.LeadImport
+	if err := query.Limit(c.QueryInt("limit", 50)).Find(&imports).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(imports)
+}
+
+func GetLeadImport(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var record models.LeadImport
+	if err := leadsDB.Preload("Source").First(&record, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead import not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(record)
+}
+
+// DownloadLeadImportErrors returns the failed rows of an import as CSV: the original columns
+// plus the row number and what was wrong, ready to fix and upload again
+func DownloadLeadImportErrors(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var record models.LeadImport
+	if err := leadsDB.First(&record, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead import not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var headers []string
+	var issues []leadImportRowIssue
+	_ = json.Unmarshal(record.Headers, &headers)
+	_ = json.Unmarshal(record.Errors, &issues)
+
+	var buf bytes.Buffer
+	buf.WriteString("\ufeff") // BOM so Excel reads the file as UTF-8
+	w := csv.NewWriter(&buf)
+	head := make([]string, 0, len(headers)+2)
+	head = append(head, "Row")
+	for _, h := range headers {
+		head = append(head, escapeSpreadsheetFormula(h))
+	}
+	_ = w.Write(append(head, "Errors"))
+	for _, issue := range issues {
+		line := make([]string, 0, len(headers)+2)
+		line = append(line, strconv.Itoa(issue.Row))
+		for i := range headers {
+			value := ""
+			if i < len(issue.Values) {
+				value = issue.Values[i]
+			}
+			line = append(line, escapeSpreadsheetFormula(value))
+		}
+		line = append(line, escapeSpreadsheetFormula(strings.Join(issue.Errors, "; ")))
+		_ = w.Write(line)
+	}
+	w.Flush()
+
+	c.Set("Content-Type", "text/csv; charset=utf-8")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"lead-import-%d-errors.csv\"", record.ID))
+	return c.Send(buf.Bytes())
+}
@@ -58,6 +58,11 @@ func CreateLeadInteraction(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if err := syncLeadFirstResponse(leadInteractionDB, interaction.LeadID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	touchLeadScore(interaction.LeadID)
+
 	return c.Status(201).JSON(interaction)
 }
 
@@ -141,6 +146,11 @@ func DeleteLeadInteraction(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if err := syncLeadFirstResponse(leadInteractionDB, interaction.LeadID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	touchLeadScore(interaction.LeadID)
+
 	return c.JSON(fiber.Map{"message": "Interaction deleted successfully"})
 }
 
@@ -241,6 +251,10 @@ func CreateLeadInteractionForLead(c *fiber.Ctx) error {
 			tx.Rollback()
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to create interaction", "detail": err.Error()})
 		}
+		if err := syncLeadFirstResponse(tx, lid); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to update first response", "detail": err.Error()})
+		}
 	}
 
 	var fup models.LeadFollowUp
@@ -291,6 +305,10 @@ func CreateLeadInteractionForLead(c *fiber.Ctx) error {
 			tx.Rollback()
 			return c.Status(500).JSON(fiber.Map{"error": "failed to create follow-up", "detail": err.Error()})
 		}
+		if err := syncLeadNextTalk(tx, lid); err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "failed to update next talk", "detail": err.Error()})
+		}
 		createdFup = true
 	}
 
@@ -299,6 +317,10 @@ func CreateLeadInteractionForLead(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to commit transaction", "detail": err.Error()})
 	}
 
+	if createInteraction {
+		touchLeadScore(lid)
+	}
+
 	resp := fiber.Map{}
 	if createInteraction {
 		resp["interaction"] = interaction
@@ -0,0 +1,434 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var leadScoreDB *gorm.DB
+
+func SetLeadScoreDB(db *gorm.DB) {
+	leadScoreDB = db
+}
+
+// leadScoreNightlyHour is the IST hour the nightly rescoring runs at
+const leadScoreNightlyHour = 2
+
+var leadScoreFactors = map[string]bool{
+	models.LeadScoreSource:             true,
+	models.LeadScorePotential:          true,
+	models.LeadScoreGSTIN:              true,
+	models.LeadScoreEmail:              true,
+	models.LeadScoreLastTalk:           true,
+	models.LeadScoreInteractions:       true,
+	models.LeadScoreQuotationSent:      true,
+	models.LeadScoreQuotationConfirmed: true,
+}
+
+/* ========== DTOs ========== */
+
+type CreateLeadScoringRuleRequest struct {
+	Name      string  `json:"name"`
+	Factor    string  `json:"factor"`
+	Value     string  `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Weight    float64 `json:"weight"`
+	Active    *bool   `json:"active"`
+}
+
+type UpdateLeadScoringRuleRequest struct {
+	Name      *string  `json:"name"`
+	Factor    *string  `json:"factor"`
+	Value     *string  `json:"value"`
+	Threshold *float64 `json:"threshold"`
+	Weight    *float64 `json:"weight"`
+	Active    *bool    `json:"active"`
+}
+
+// leadScoreStats holds the counts a lead is scored on besides its own fields
+type leadScoreStats struct {
+	Interactions        int64
+	QuotationsSent      int64
+	QuotationsConfirmed int64
+}
+
+type leadScoreComponent struct {
+	RuleID uint    `json:"rule_id"`
+	Name   string  `json:"name"`
+	Factor string  `json:"factor"`
+	Points float64 `json:"points"`
+}
+
+/* ========== HELPERS ========== */
+
+func validateLeadScoringRule(rule *models.LeadScoringRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !leadScoreFactors[rule.Factor] {
+		return fmt.Errorf("unknown factor %q", rule.Factor)
+	}
+	if rule.Factor == models.LeadScoreSource && strings.TrimSpace(rule.Value) == "" {
+		return fmt.Errorf("value is required for the source factor")
+	}
+	if rule.Threshold < 0 {
+		return fmt.Errorf("threshold cannot be negative")
+	}
+	if rule.Factor == models.LeadScoreLastTalk && rule.Threshold <= 0 {
+		return fmt.Errorf("threshold (days) is required for the last_talk factor")
+	}
+	return nil
+}
+
+func activeLeadScoringRules(db *gorm.DB) ([]models.LeadScoringRule, error) {
+	var rules []models.LeadScoringRule
+	err := db.Where("active = true").Order("id asc").Find(&rules).Error
+	return rules, err
+}
+
+// loadLeadScoreStats counts interactions and quotations for the given leads
+func loadLeadScoreStats(db *gorm.DB, leadIDs []uint) (map[uint]*leadScoreStats, error) {
+	stats := make(map[uint]*leadScoreStats, len(leadIDs))
+	for _, id := range leadIDs {
+		stats[id] = &leadScoreStats{}
+	}
+	if len(leadIDs) == 0 {
+		return stats, nil
+	}
+
+	type countRow struct {
+		LeadID    uint
+		Total     int64
+		Confirmed int64
+	}
+
+	var interactions []countRow
+	if err := db.Model(&models.LeadInteraction{}).
+		Select("lead_id, COUNT(*) AS total").
+		Where("lead_id IN ?", leadIDs).Group("lead_id").
+		Scan(&interactions).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range interactions {
+		stats[r.LeadID].Interactions = r.Total
+	}
+
+	var quotations []countRow
+	if err := db.Model(&models.QuotationTable{}).
+		Select("lead_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE LOWER(status) = ?) AS confirmed", string(models.Qt_Confirmed)).
+		Where("lead_id IN ? AND LOWER(status) IN ?", leadIDs, []string{string(models.Qt_Sent), string(models.Qt_Confirmed)}).
+		Group("lead_id").
+		Scan(&quotations).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range quotations {
+		stats[r.LeadID].QuotationsSent = r.Total
+		stats[r.LeadID].QuotationsConfirmed = r.Confirmed
+	}
+
+	return stats, nil
+}
+
+// scoreLead adds up the weights of the rules that hold for the lead
+func scoreLead(lead *models.Lead, rules []models.LeadScoringRule, stats *leadScoreStats, now time.Time) (float64, []leadScoreComponent) {
+	atLeast := func(count int64, threshold float64) bool {
+		return float64(count) >= math.Max(threshold, 1)
+	}
+
+	var score float64
+	var components []leadScoreComponent
+	for _, rule := range rules {
+		var hit bool
+		switch rule.Factor {
+		case models.LeadScoreSource:
+			hit = strings.EqualFold(strings.TrimSpace(lead.Source), strings.TrimSpace(rule.Value))
+		case models.LeadScorePotential:
+			hit = lead.Potential > 0 && lead.Potential >= rule.Threshold
+		case models.LeadScoreGSTIN:
+			hit = strings.TrimSpace(lead.GSTIN) != ""
+		case models.LeadScoreEmail:
+			hit = strings.TrimSpace(lead.Email) != ""
+		case models.LeadScoreLastTalk:
+			hit = !lead.LastTalk.IsZero() && now.Sub(lead.LastTalk) <= time.Duration(rule.Threshold*24)*time.Hour
+		case models.LeadScoreInteractions:
+			hit = atLeast(stats.Interactions, rule.Threshold)
+		case models.LeadScoreQuotationSent:
+			hit = atLeast(stats.QuotationsSent, rule.Threshold)
+		case models.LeadScoreQuotationConfirmed:
+			hit = atLeast(stats.QuotationsConfirmed, rule.Threshold)
+		}
+		if !hit {
+			continue
+		}
+		score += rule.Weight
+		components = append(components, leadScoreComponent{RuleID: rule.ID, Name: rule.Name, Factor: rule.Factor, Points: rule.Weight})
+	}
+	return round2(score), components
+}
+
+// refreshLeadScore recomputes and stores one lead's score within db (which may be a transaction)
+func refreshLeadScore(db *gorm.DB, lead *models.Lead) error {
+	rules, err := activeLeadScoringRules(db)
+	if err != nil {
+		return err
+	}
+	stats, err := loadLeadScoreStats(db, []uint{lead.ID})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	score, _ := scoreLead(lead, rules, stats[lead.ID], now)
+	if err := db.Model(lead).UpdateColumns(map[string]interface{}{"score": score, "scored_at": now}).Error; err != nil {
+		return err
+	}
+	lead.Score = score
+	lead.ScoredAt = &now
+	return nil
+}
+
+// touchLeadScore rescores a lead after a change elsewhere (interaction, quotation). Failures are
+// only logged; the nightly run catches up.
+func touchLeadScore(leadID uint) {
+	if leadScoreDB == nil || leadID == 0 {
+		return
+	}
+	var lead models.Lead
+	if err := leadScoreDB.First(&lead, leadID).Error; err != nil {
+		return
+	}
+	if err := refreshLeadScore(leadScoreDB, &lead); err != nil {
+		log.Printf("lead score: failed to rescore lead %d: %v", leadID, err)
+	}
+}
+
+// recomputeAllLeadScores rescores every lead in batches and returns how many were scored
+func recomputeAllLeadScores() (int, error) {
+	rules, err := activeLeadScoringRules(leadScoreDB)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	scored := 0
+	var leads []models.Lead
+	result := leadScoreDB.Select("id, source, potential, gstin, email, last_talk").FindInBatches(&leads, 500, func(tx *gorm.DB, batch int) error {
+		ids := make([]uint, len(leads))
+		for i := range leads {
+			ids[i] = leads[i].ID
+		}
+		stats, err := loadLeadScoreStats(leadScoreDB, ids)
+		if err != nil {
+			return err
+		}
+		for i := range leads {
+			score, _ := scoreLead(&leads[i], rules, stats[leads[i].ID], now)
+			if err := leadScoreDB.Model(&models.Lead{}).Where("id = ?", leads[i].ID).
+				UpdateColumns(map[string]interface{}{"score": score, "scored_at": now}).Error; err != nil {
+				return err
+			}
+			scored++
+		}
+		return nil
+	})
+	return scored, result.Error
+}
+
+// StartLeadScoreScheduler rescores all leads every night, so time based factors such as the
+// recency of the last talk decay without waiting for an edit
+func StartLeadScoreScheduler() {
+	go func() {
+		for {
+			now := time.Now().In(istLocation)
+			next := time.Date(now.Year(), now.Month(), now.Day(), leadScoreNightlyHour, 0, 0, 0, istLocation)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			started := time.Now()
+			n, err := recomputeAllLeadScores()
+			if err != nil {
+				log.Printf("lead score: nightly run failed after %d leads: %v", n, err)
+				continue
+			}
+			log.Printf("lead score: rescored %d leads in %s", n, time.Since(started).Round(time.Second))
+		}
+	}()
+}
+
+/* ========== HANDLERS ========== */
+
+func CreateLeadScoringRule(c *fiber.Ctx) error {
+	var body CreateLeadScoringRuleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	rule := models.LeadScoringRule{
+		Name:      body.Name,
+		Factor:    strings.ToLower(strings.TrimSpace(body.Factor)),
+		Value:     body.Value,
+		Threshold: body.Threshold,
+		Weight:    body.Weight,
+		Active:    true,
+	}
+
+	if body.Active != nil {
+		rule.Active = *body.Active
+	}
+
+	if err := validateLeadScoringRule(&rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := leadScoreDB.Create(&rule).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(rule)
+}
+
+func GetLeadScoringRules(c *fiber.Ctx) error {
+	var rules []models.LeadScoringRule
+
+	query := leadScoreDB.Order("id asc")
+
+	if c.Query("active") == "true" {
+		query = query.Where("active = true")
+	}
+
+	if err := query.Find(&rules).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rules)
+}
+
+func GetLeadScoringRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var rule models.LeadScoringRule
+
+	if err := leadScoreDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Scoring rule not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rule)
+}
+
+func UpdateLeadScoringRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body UpdateLeadScoringRuleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var rule models.LeadScoringRule
+	if err := leadScoreDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Scoring rule not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if body.Name != nil {
+		rule.Name = *body.Name
+	}
+	if body.Factor != nil {
+		rule.Factor = strings.ToLower(strings.TrimSpace(*body.Factor))
+	}
+	if body.Value != nil {
+		rule.Value = *body.Value
+	}
+	if body.Threshold != nil {
+		rule.Threshold = *body.Threshold
+	}
+	if body.Weight != nil {
+		rule.Weight = *body.Weight
+	}
+	if body.Active != nil {
+		rule.Active = *body.Active
+	}
+
+	if err := validateLeadScoringRule(&rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := leadScoreDB.Save(&rule).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rule)
+}
+
+func DeleteLeadScoringRule(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	if err := leadScoreDB.Delete(&models.LeadScoringRule{}, id).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Scoring rule deleted successfully"})
+}
+
+// GetLeadScore recomputes a lead's score and explains which rules contributed
+func GetLeadScore(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var lead models.Lead
+	if err := leadScoreDB.First(&lead, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rules, err := activeLeadScoringRules(leadScoreDB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	stats, err := loadLeadScoreStats(leadScoreDB, []uint{lead.ID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	now := time.Now()
+	score, components := scoreLead(&lead, rules, stats[lead.ID], now)
+	if score != lead.Score || lead.ScoredAt == nil {
+		if err := leadScoreDB.Model(&lead).UpdateColumns(map[string]interface{}{"score": score, "scored_at": now}).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"lead_id":    lead.ID,
+		"score":      score,
+		"components": components,
+		"stats": fiber.Map{
+			"interactions":         stats[lead.ID].Interactions,
+			"quotations_sent":      stats[lead.ID].QuotationsSent,
+			"quotations_confirmed": stats[lead.ID].QuotationsConfirmed,
+		},
+	})
+}
+
+// RecomputeLeadScores rescores every lead now instead of waiting for the nightly run
+func RecomputeLeadScores(c *fiber.Ctx) error {
+	n, err := recomputeAllLeadScores()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error(), "scored": n})
+	}
+
+	return c.JSON(fiber.Map{"scored": n})
+}
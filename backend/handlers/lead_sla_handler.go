@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Upper bound of breached leads handled per scheduler pass
+const leadSLABatch = 200
+
+var leadSLADB *gorm.DB
+
+func SetLeadSLADB(db *gorm.DB) {
+	leadSLADB = db
+}
+
+/* ========== HELPERS ========== */
+
+// leadSourceSLA returns the first-response SLA in minutes of the lead's source, matched by
+// name or code on Lead.Source or by code on the platform it was pulled from; 0 means none
+func leadSourceSLA(db *gorm.DB, lead *models.Lead) (int, error) {
+	names := []string{}
+	if s := strings.ToLower(strings.TrimSpace(lead.Source)); s != "" {
+		names = append(names, s)
+	}
+	if lead.ExternalSource != nil && *lead.ExternalSource != "" {
+		names = append(names, strings.ToLower(*lead.ExternalSource))
+	}
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	var source models.LeadSource
+	err := db.Where("active = true AND response_sla_minutes > 0").
+		Where("LOWER(name) IN ? OR LOWER(code) IN ?", names, names).
+		Order("id").First(&source).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return source.ResponseSLAMinutes, nil
+}
+
+// applyLeadSLA sets the first-response due time of a lead that is about to be created
+func applyLeadSLA(db *gorm.DB, lead *models.Lead) error {
+	minutes, err := leadSourceSLA(db, lead)
+	if err != nil || minutes == 0 {
+		return err
+	}
+	start := lead.CreatedAt
+	if start.IsZero() {
+		start = time.Now()
+	}
+	due := start.Add(time.Duration(minutes) * time.Minute)
+	lead.SLADueAt = &due
+	return nil
+}
+
+// syncLeadFirstResponse sets Lead.FirstResponseAt to the earliest interaction and re-evaluates
+// the SLA: breached when the first interaction came after the due time, or none has come yet
+// and the due time has passed. Mail pulled from the inbox and incoming WhatsApp messages are the customer
+// writing, not a response.
+func syncLeadFirstResponse(db *gorm.DB, leadID uint) error {
+	var first sql.NullTime
+	if err := db.Model(&models.LeadInteraction{}).
+		Where("lead_id = ?", leadID).
+		Where("id NOT IN (SELECT interaction_id FROM inbound_emails WHERE interaction_id IS NOT NULL)").
+		Where("id NOT IN (SELECT interaction_id FROM whatsapp_messages WHERE direction = 'inbound' AND interaction_id IS NOT NULL)").
+		Select(`MIN("timestamp")`).Row().Scan(&first); err != nil {
+		return err
+	}
+
+	var lead models.Lead
+	if err := db.Select("id", "sla_due_at").First(&lead, leadID).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"first_response_at": nil}
+	if first.Valid {
+		updates["first_response_at"] = first.Time
+	}
+	if lead.SLADueAt != nil {
+		due := *lead.SLADueAt
+		breached := (first.Valid && first.Time.After(due)) || (!first.Valid && time.Now().After(due))
+		updates["sla_breached"] = breached
+		updates["sla_breached_at"] = nil
+		if breached {
+			updates["sla_breached_at"] = due
+		}
+	}
+	return db.Model(&models.Lead{}).Where("id = ?", leadID).UpdateColumns(updates).Error
+}
+
+// runLeadSLACheck flags leads whose first response is overdue and tells the assignee and
+// their manager
+func runLeadSLACheck(now time.Time) {
+	db := leadSLADB
+
+	var leads []models.Lead
+	if err := db.Where("sla_due_at <= ? AND sla_breached = false AND first_response_at IS NULL AND customer_id IS NULL", now).
+		Order("sla_due_at asc").Limit(leadSLABatch).Find(&leads).Error; err != nil {
+		log.Printf("lead sla: failed to load overdue leads: %v", err)
+		return
+	}
+
+	for i := range leads {
+		lead := &leads[i]
+		if err := db.Model(lead).UpdateColumns(map[string]interface{}{
+			"sla_breached":    true,
+			"sla_breached_at": *lead.SLADueAt,
+		}).Error; err != nil {
+			log.Printf("lead sla: failed to flag lead %d: %v", lead.ID, err)
+			continue
+		}
+		if lead.AssignedToID == nil {
+			continue
+		}
+
+		name := lead.Business
+		if name == "" {
+			name = lead.Name
+		}
+		text := fmt.Sprintf("Lead #%d %s", lead.ID, name)
+		if lead.Mobile != "" {
+			text += " (" + lead.Mobile + ")"
+		}
+		if lead.Source != "" {
+			text += " from " + lead.Source
+		}
+		text += " has had no response since " + lead.CreatedAt.In(istLocation).Format("02 Jan 2006 03:04 PM")
+
+		if err := notifyUser(db, *lead.AssignedToID, "lead_sla_breach", "First response overdue", text, "lead", &lead.ID); err != nil {
+			log.Printf("lead sla: failed to notify user %d: %v", *lead.AssignedToID, err)
+		}
+		managerID, err := managerUserID(db, *lead.AssignedToID)
+		if err != nil {
+			log.Printf("lead sla: failed to find manager of user %d: %v", *lead.AssignedToID, err)
+			continue
+		}
+		if managerID != nil {
+			owner := lead.AssignedToName
+			if owner == "" {
+				owner = "The assignee"
+			}
+			if err := notifyUser(db, *managerID, "lead_sla_breach", "First response overdue",
+				fmt.Sprintf("%s has not responded: %s", owner, text), "lead", &lead.ID); err != nil {
+				log.Printf("lead sla: failed to notify manager %d: %v", *managerID, err)
+			}
+		}
+	}
+}
+
+// StartLeadSLAScheduler checks every minute for leads that have run past their first-response SLA
+func StartLeadSLAScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			runLeadSLACheck(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+/* ========== HANDLERS ========== */
+
+type slaLeadItem struct {
+	ID             uint       `json:"id"`
+	Business       string     `json:"business"`
+	Name           string     `json:"name"`
+	Mobile         string     `json:"mobile"`
+	Source         string     `json:"source"`
+	Stage          string     `json:"stage"`
+	AssignedToID   *uint      `json:"assigned_to_id"`
+	AssignedToName string     `json:"assignedToName"`
+	CreatedAt      time.Time  `json:"created_at"`
+	SLADueAt       *time.Time `json:"sla_due_at"`
+	// Negative once the due time has passed
+	MinutesLeft int `json:"minutes_left"`
+}
+
+// GetLeadSLAAtRisk lists leads still waiting for a first response: those due within the next
+// `within` minutes (default 30) and those already breached.
+// Query: user_id (assignee), within
+func GetLeadSLAAtRisk(c *fiber.Ctx) error {
+	now := time.Now()
+	within := c.QueryInt("within", 30)
+	if within < 0 {
+		within = 0
+	}
+
+	base := leadSLADB.Model(&models.Lead{}).
+		Where("sla_due_at IS NOT NULL AND first_response_at IS NULL AND customer_id IS NULL")
+	if userID := c.QueryInt("user_id", 0); userID > 0 {
+		base = base.Where("assigned_to_id = ?", userID)
+	}
+
+	load := func(query *gorm.DB) ([]slaLeadItem, error) {
+		var leads []models.Lead
+		if err := query.Order("sla_due_at asc").Limit(500).Find(&leads).Error; err != nil {
+			return nil, err
+		}
+		items := make([]slaLeadItem, len(leads))
+		for i, l := range leads {
+			items[i] = slaLeadItem{
+				ID:             l.ID,
+				Business:       l.Business,
+				Name:           l.Name,
+				Mobile:         l.Mobile,
+				Source:         l.Source,
+				Stage:          l.Stage,
+				AssignedToID:   l.AssignedToID,
+				AssignedToName: l.AssignedToName,
+				CreatedAt:      l.CreatedAt,
+				SLADueAt:       l.SLADueAt,
+				MinutesLeft:    int(l.SLADueAt.Sub(now).Minutes()),
+			}
+		}
+		return items, nil
+	}
+
+	atRisk, err := load(base.Session(&gorm.Session{}).
+		Where("sla_due_at > ? AND sla_due_at <= ?", now, now.Add(time.Duration(within)*time.Minute)))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	breached, err := load(base.Session(&gorm.Session{}).Where("sla_due_at <= ?", now))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"within_minutes": within,
+		"at_risk":        atRisk,
+		"breached":       breached,
+		"summary": fiber.Map{
+			"at_risk":  len(atRisk),
+			"breached": len(breached),
+		},
+	})
+}
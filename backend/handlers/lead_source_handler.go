@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+
 	"erp.local/backend/models"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -15,17 +19,45 @@ func SetLeadSourceDB(db *gorm.DB) {
 /* ========== DTOs ========== */
 
 type CreateLeadSourceRequest struct {
-	Code        string `json:"code"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Active      *bool  `json:"active"`
+	Code               string         `json:"code"`
+	Name               string         `json:"name"`
+	Description        string         `json:"description"`
+	Active             *bool          `json:"active"`
+	WebhookSecret      string         `json:"webhook_secret"`
+	FieldMap           datatypes.JSON `json:"field_map"`
+	ImportMap          datatypes.JSON `json:"import_map"`
+	ResponseSLAMinutes int            `json:"response_sla_minutes"`
 }
 
 type UpdateLeadSourceRequest struct {
-	Code        *string `json:"code"`
-	Name        *string `json:"name"`
-	Description *string `json:"description"`
-	Active      *bool   `json:"active"`
+	Code               *string        `json:"code"`
+	Name               *string        `json:"name"`
+	Description        *string        `json:"description"`
+	Active             *bool          `json:"active"`
+	WebhookSecret      *string        `json:"webhook_secret"`
+	FieldMap           datatypes.JSON `json:"field_map"`
+	ImportMap          datatypes.JSON `json:"import_map"`
+	ResponseSLAMinutes *int           `json:"response_sla_minutes"`
+}
+
+// leadSourceWithSecret is the one response that carries the webhook secret
+type leadSourceWithSecret struct {
+	models.LeadSource
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+/* ========== HELPERS ========== */
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func markLeadSourceSecret(source *models.LeadSource) {
+	source.HasWebhookSecret = source.WebhookSecret != ""
 }
 
 /* ========== HANDLERS ========== */
@@ -40,11 +72,25 @@ func CreateLeadSource(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Code and Name are required"})
 	}
 
+	if err := validateWebhookFieldMap(body.FieldMap); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validateLeadImportMap(body.ImportMap); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.ResponseSLAMinutes < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "response_sla_minutes cannot be negative"})
+	}
+
 	source := models.LeadSource{
-		Code:        body.Code,
-		Name:        body.Name,
-		Description: body.Description,
-		Active:      true,
+		Code:               body.Code,
+		Name:               body.Name,
+		Description:        body.Description,
+		Active:             true,
+		WebhookSecret:      body.WebhookSecret,
+		FieldMap:           body.FieldMap,
+		ImportMap:          body.ImportMap,
+		ResponseSLAMinutes: body.ResponseSLAMinutes,
 	}
 
 	if body.Active != nil {
@@ -55,6 +101,10 @@ func CreateLeadSource(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	markLeadSourceSecret(&source)
+	if source.WebhookSecret != "" {
+		return c.Status(201).JSON(leadSourceWithSecret{LeadSource: source, WebhookSecret: source.WebhookSecret})
+	}
 	return c.Status(201).JSON(source)
 }
 
@@ -70,6 +120,9 @@ func GetLeadSources(c *fiber.Ctx) error {
 	if err := query.Find(&sources).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	for i := range sources {
+		markLeadSourceSecret(&sources[i])
+	}
 
 	return c.JSON(sources)
 }
@@ -85,6 +138,7 @@ func GetLeadSource(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	markLeadSourceSecret(&source)
 	return c.JSON(source)
 }
 
@@ -116,14 +170,61 @@ func UpdateLeadSource(c *fiber.Ctx) error {
 	if body.Active != nil {
 		source.Active = *body.Active
 	}
+	if body.WebhookSecret != nil {
+		source.WebhookSecret = *body.WebhookSecret
+	}
+	if body.FieldMap != nil {
+		if err := validateWebhookFieldMap(body.FieldMap); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		source.FieldMap = body.FieldMap
+	}
+	if body.ImportMap != nil {
+		if err := validateLeadImportMap(body.ImportMap); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		source.ImportMap = body.ImportMap
+	}
+	if body.ResponseSLAMinutes != nil {
+		if *body.ResponseSLAMinutes < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "response_sla_minutes cannot be negative"})
+		}
+		source.ResponseSLAMinutes = *body.ResponseSLAMinutes
+	}
 
 	if err := leadSourceDB.Save(&source).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	markLeadSourceSecret(&source)
 	return c.JSON(source)
 }
 
+// RotateLeadSourceSecret replaces the webhook secret with a generated one and returns it. This
+// is the only time the new secret can be read.
+func RotateLeadSourceSecret(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var source models.LeadSource
+	if err := leadSourceDB.First(&source, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead source not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := leadSourceDB.Model(&source).Update("webhook_secret", secret).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	markLeadSourceSecret(&source)
+	return c.JSON(leadSourceWithSecret{LeadSource: source, WebhookSecret: secret})
+}
+
 func DeleteLeadSource(c *fiber.Ctx) error {
 	id := c.Params("id")
 
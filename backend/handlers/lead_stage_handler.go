@@ -0,0 +1,480 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var leadStageDB *gorm.DB
+
+func SetLeadStageDB(db *gorm.DB) {
+	leadStageDB = db
+}
+
+/* ========== DTOs ========== */
+
+type CreateLeadStageRequest struct {
+	Code        string         `json:"code"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	SortOrder   int            `json:"sort_order"`
+	Probability float64        `json:"probability"`
+	IsWon       bool           `json:"is_won"`
+	IsLost      bool           `json:"is_lost"`
+	AllowedNext datatypes.JSON `json:"allowed_next"`
+	Active      *bool          `json:"active"`
+}
+
+type UpdateLeadStageRequest struct {
+	Code        *string        `json:"code"`
+	Name        *string        `json:"name"`
+	Description *string        `json:"description"`
+	SortOrder   *int           `json:"sort_order"`
+	Probability *float64       `json:"probability"`
+	IsWon       *bool          `json:"is_won"`
+	IsLost      *bool          `json:"is_lost"`
+	AllowedNext datatypes.JSON `json:"allowed_next"`
+	Active      *bool          `json:"active"`
+}
+
+type ChangeLeadStageRequest struct {
+	StageID           *uint  `json:"stage_id"`
+	Stage             string `json:"stage"` // code or name, used when stage_id is not sent
+	RejectionReasonID *uint  `json:"rejection_reason_id"`
+	Remarks           string `json:"remarks"`
+	ChangedByID       *uint  `json:"changed_by_id"`
+}
+
+/* ========== HELPERS ========== */
+
+// validateLeadStage checks the flags and transition list of a stage before it is saved
+func validateLeadStage(stage *models.LeadStage) error {
+	if stage.IsWon && stage.IsLost {
+		return fmt.Errorf("a stage cannot be both won and lost")
+	}
+	if stage.Probability < 0 || stage.Probability > 100 {
+		return fmt.Errorf("probability must be between 0 and 100")
+	}
+	if _, err := leadStageAllowedNext(stage); err != nil {
+		return fmt.Errorf("allowed_next must be an array of stage codes")
+	}
+	return nil
+}
+
+// leadStageAllowedNext decodes the stage codes a lead may move to from the stage
+func leadStageAllowedNext(stage *models.LeadStage) ([]string, error) {
+	if len(stage.AllowedNext) == 0 || string(stage.AllowedNext) == "null" {
+		return nil, nil
+	}
+	var codes []string
+	if err := json.Unmarshal(stage.AllowedNext, &codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// resolveLeadStage finds an active or inactive stage by code or name, case-insensitively
+func resolveLeadStage(db *gorm.DB, value string) (*models.LeadStage, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	var stage models.LeadStage
+	err := db.Where("LOWER(code) = LOWER(?) OR LOWER(name) = LOWER(?)", value, value).
+		Order("active desc, sort_order asc").First(&stage).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stage, nil
+}
+
+// defaultLeadStage is the first active open stage; new leads start here
+func defaultLeadStage(db *gorm.DB) (*models.LeadStage, error) {
+	var stage models.LeadStage
+	err := db.Where("active = true AND is_won = false AND is_lost = false").
+		Order("sort_order asc, id asc").First(&stage).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stage, nil
+}
+
+// wonLeadStage is the first active won stage, used when a lead is converted
+func wonLeadStage(db *gorm.DB) (*models.LeadStage, error) {
+	var stage models.LeadStage
+	err := db.Where("active = true AND is_won = true").Order("sort_order asc, id asc").First(&stage).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stage, nil
+}
+
+// applyLeadStage points a lead that is about to be created at the stage named in lead.Stage,
+// or at the default stage when none is named. It reports false when the named stage is unknown,
+// in which case the default stage is applied.
+func applyLeadStage(db *gorm.DB, lead *models.Lead) (bool, error) {
+	var stage *models.LeadStage
+	var err error
+	if lead.StageID != nil {
+		var byID models.LeadStage
+		if err := db.First(&byID, *lead.StageID).Error; err == nil {
+			stage = &byID
+		} else if err != gorm.ErrRecordNotFound {
+			return false, err
+		}
+	} else {
+		stage, err = resolveLeadStage(db, lead.Stage)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	found := stage != nil || (lead.StageID == nil && strings.TrimSpace(lead.Stage) == "")
+	if stage == nil {
+		if stage, err = defaultLeadStage(db); err != nil {
+			return false, err
+		}
+	}
+	if stage == nil {
+		// No stage master configured; keep the free text stage
+		lead.StageID = nil
+		return found, nil
+	}
+
+	now := time.Now()
+	lead.StageID = &stage.ID
+	lead.Stage = stage.Name
+	lead.StageChangedAt = &now
+	return found, nil
+}
+
+// changeLeadStage moves a lead to another stage inside tx after checking the transition rules:
+// the target must be active, closed (won/lost) stages only reopen into stages listed in their
+// allowed_next, a non-empty allowed_next restricts the targets, and lost needs an active
+// rejection reason. Moving to the current stage is a no-op.
+func changeLeadStage(tx *gorm.DB, lead *models.Lead, target *models.LeadStage, reasonID *uint, remarks string, changedBy *uint) error {
+	return moveLeadStage(tx, lead, target, reasonID, remarks, changedBy, true)
+}
+
+// moveLeadStage is changeLeadStage with the allowed_next check optional, for moves the system
+// makes itself such as closing a converted lead as won
+func moveLeadStage(tx *gorm.DB, lead *models.Lead, target *models.LeadStage, reasonID *uint, remarks string, changedBy *uint, checkTransition bool) error {
+	if lead.StageID != nil && *lead.StageID == target.ID {
+		return nil
+	}
+	if !target.Active {
+		return &httpError{Status: 400, Msg: fmt.Sprintf("Stage %s is inactive", target.Name)}
+	}
+
+	var from *models.LeadStage
+	if lead.StageID != nil {
+		var current models.LeadStage
+		if err := tx.First(&current, *lead.StageID).Error; err == nil {
+			from = &current
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+	}
+
+	if from != nil && checkTransition {
+		allowed, err := leadStageAllowedNext(from)
+		if err != nil {
+			return err
+		}
+		permitted := len(allowed) == 0 && !from.IsWon && !from.IsLost
+		for _, code := range allowed {
+			if strings.EqualFold(code, target.Code) {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return &httpError{Status: 400, Msg: fmt.Sprintf("Cannot move a lead from %s to %s", from.Name, target.Name)}
+		}
+	}
+
+	if target.IsLost {
+		if reasonID == nil {
+			return &httpError{Status: 400, Msg: "A rejection reason is required to mark a lead lost"}
+		}
+		var reason models.RejectionReason
+		if err := tx.First(&reason, *reasonID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return &httpError{Status: 400, Msg: "Rejection reason not found"}
+			}
+			return err
+		}
+		if !reason.Active {
+			return &httpError{Status: 400, Msg: "Rejection reason is inactive"}
+		}
+	} else {
+		reasonID = nil
+	}
+
+	now := time.Now()
+	if err := tx.Model(lead).Updates(map[string]interface{}{
+		"stage_id":            target.ID,
+		"stage":               target.Name,
+		"stage_changed_at":    now,
+		"rejection_reason_id": reasonID,
+	}).Error; err != nil {
+		return err
+	}
+
+	history := models.LeadStageHistory{
+		LeadID:            lead.ID,
+		ToStageID:         &target.ID,
+		ToStage:           target.Name,
+		FromStage:         lead.Stage,
+		RejectionReasonID: reasonID,
+		Remarks:           remarks,
+		ChangedByID:       changedBy,
+		ChangedAt:         now,
+	}
+	if from != nil {
+		history.FromStageID = &from.ID
+		history.FromStage = from.Name
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return err
+	}
+
+	lead.StageID = &target.ID
+	lead.Stage = target.Name
+	lead.StageChangedAt = &now
+	lead.RejectionReasonID = reasonID
+	return nil
+}
+
+/* ========== HANDLERS ========== */
+
+func CreateLeadStage(c *fiber.Ctx) error {
+	var body CreateLeadStageRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	if body.Code == "" || body.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Code and Name are required"})
+	}
+
+	stage := models.LeadStage{
+		Code:        body.Code,
+		Name:        body.Name,
+		Description: body.Description,
+		SortOrder:   body.SortOrder,
+		Probability: body.Probability,
+		IsWon:       body.IsWon,
+		IsLost:      body.IsLost,
+		AllowedNext: body.AllowedNext,
+		Active:      true,
+	}
+
+	if body.Active != nil {
+		stage.Active = *body.Active
+	}
+
+	if err := validateLeadStage(&stage); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := leadStageDB.Create(&stage).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(stage)
+}
+
+func GetLeadStages(c *fiber.Ctx) error {
+	var stages []models.LeadStage
+
+	query := leadStageDB.Order("sort_order asc, id asc")
+
+	if c.Query("active") == "true" {
+		query = query.Where("active = true")
+	}
+
+	if err := query.Find(&stages).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(stages)
+}
+
+func GetLeadStage(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var stage models.LeadStage
+
+	if err := leadStageDB.First(&stage, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead stage not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(stage)
+}
+
+func UpdateLeadStage(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body UpdateLeadStageRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var stage models.LeadStage
+	if err := leadStageDB.First(&stage, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead stage not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if body.Code != nil {
+		stage.Code = *body.Code
+	}
+	if body.Name != nil {
+		stage.Name = *body.Name
+	}
+	if body.Description != nil {
+		stage.Description = *body.Description
+	}
+	if body.SortOrder != nil {
+		stage.SortOrder = *body.SortOrder
+	}
+	if body.Probability != nil {
+		stage.Probability = *body.Probability
+	}
+	if body.IsWon != nil {
+		stage.IsWon = *body.IsWon
+	}
+	if body.IsLost != nil {
+		stage.IsLost = *body.IsLost
+	}
+	if body.AllowedNext != nil {
+		stage.AllowedNext = body.AllowedNext
+	}
+	if body.Active != nil {
+		stage.Active = *body.Active
+	}
+
+	if err := validateLeadStage(&stage); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx := leadStageDB.Begin()
+	if err := tx.Save(&stage).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	// Leads carry the stage name as text; keep it in step with a rename
+	if err := tx.Model(&models.Lead{}).Where("stage_id = ?", stage.ID).Update("stage", stage.Name).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	tx.Commit()
+
+	return c.JSON(stage)
+}
+
+func DeleteLeadStage(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var inUse int64
+	if err := leadStageDB.Model(&models.Lead{}).Where("stage_id = ?", id).Count(&inUse).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if inUse > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Stage is used by leads; deactivate it instead"})
+	}
+
+	if err := leadStageDB.Delete(&models.LeadStage{}, id).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Lead stage deleted successfully"})
+}
+
+// ChangeLeadStageHandler moves a lead to another stage, enforcing the transition rules
+func ChangeLeadStageHandler(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body ChangeLeadStageRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var target *models.LeadStage
+	if body.StageID != nil {
+		var stage models.LeadStage
+		if err := leadStageDB.First(&stage, *body.StageID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(400).JSON(fiber.Map{"error": "Lead stage not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		target = &stage
+	} else {
+		stage, err := resolveLeadStage(leadStageDB, body.Stage)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if stage == nil {
+			return c.Status(400).JSON(fiber.Map{"error": "stage_id or a known stage is required"})
+		}
+		target = stage
+	}
+
+	tx := leadStageDB.Begin()
+
+	var lead models.Lead
+	if err := tx.First(&lead, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := changeLeadStage(tx, &lead, target, body.RejectionReasonID, body.Remarks, body.ChangedByID); err != nil {
+		tx.Rollback()
+		if he, ok := err.(*httpError); ok {
+			return c.Status(he.Status).JSON(fiber.Map{"error": he.Msg})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx.Commit()
+
+	return c.JSON(lead)
+}
+
+// GetLeadStageHistory lists the stage changes of a lead, oldest first
+func GetLeadStageHistory(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var history []models.LeadStageHistory
+	if err := leadStageDB.Preload("RejectionReason").Where("lead_id = ?", id).
+		Order("changed_at asc, id asc").Find(&history).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(history)
+}
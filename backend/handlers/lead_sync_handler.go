@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var leadSyncDB *gorm.DB
+
+func SetLeadSyncDB(db *gorm.DB) {
+	leadSyncDB = db
+}
+
+const (
+	// Re-read a little before the cursor so late indexed leads are not missed; upserts make this safe
+	leadSyncOverlap = 10 * time.Minute
+	// First run without a cursor pulls the last day
+	leadSyncInitialLookback = 24 * time.Hour
+)
+
+// Only one sync per integration at a time (schedule and manual trigger share this)
+var leadSyncRunning sync.Map
+
+/* ========== SCHEDULER ========== */
+
+// StartLeadSyncScheduler pulls leads for every active lead platform integration that has a
+// connector, each on its own interval (see leadSyncInterval).
+func StartLeadSyncScheduler() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			pollLeadIntegrations()
+			<-ticker.C
+		}
+	}()
+}
+
+func pollLeadIntegrations() {
+	var integrations []models.Integration
+	if err := leadSyncDB.Where("type = ? AND is_active = true", "lead_platform").Find(&integrations).Error; err != nil {
+		log.Printf("lead sync: failed to load integrations: %v", err)
+		return
+	}
+
+	for _, integration := range integrations {
+		if _, ok := leadConnectors[integration.Provider]; !ok {
+			continue
+		}
+
+		var state models.LeadSyncState
+		if err := leadSyncDB.Where("integration_id = ?", integration.ID).First(&state).Error; err == nil &&
+			state.LastRunAt != nil && time.Since(*state.LastRunAt) < leadSyncInterval(integration) {
+			continue
+		}
+
+		// Platforms are independent; a slow one must not hold up the rest
+		go func(integration models.Integration) {
+			run, err := runLeadSync(integration, "schedule")
+			if err != nil {
+				log.Printf("lead sync: %s integration %d failed: %v", integration.Provider, integration.ID, err)
+				return
+			}
+			log.Printf("lead sync: %s integration %d fetched %d, created %d, updated %d", integration.Provider, integration.ID, run.Fetched, run.Created, run.Updated)
+		}(integration)
+	}
+}
+
+/* ========== SYNC ========== */
+
+// integrationConfigString returns the first non-empty value among keys in an integration config
+func integrationConfigString(raw json.RawMessage, keys ...string) string {
+	var cfg map[string]interface{}
+	if len(raw) == 0 || json.Unmarshal(raw, &cfg) != nil {
+		return ""
+	}
+	return mapString(cfg, keys...)
+}
+
+// mapString returns the first non-empty value among keys of a decoded JSON object as a string
+func mapString(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		switch v := m[k].(type) {
+		case string:
+			if s := strings.TrimSpace(v); s != "" {
+				return s
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	}
+	return ""
+}
+
+// withQuery appends query parameters to an endpoint that may already carry some
+func withQuery(endpoint string, params url.Values) string {
+	if len(params) == 0 {
+		return endpoint
+	}
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + params.Encode()
+	}
+	return endpoint + "?" + params.Encode()
+}
+
+// leadSyncWindowStart is where a pull starts: slightly before the cursor, or a day back on the first run
+func leadSyncWindowStart(cursor, layout string, now time.Time) time.Time {
+	if cursor != "" {
+		if t, err := time.ParseInLocation(layout, cursor, istLocation); err == nil {
+			return t.Add(-leadSyncOverlap)
+		}
+	}
+	return now.Add(-leadSyncInitialLookback)
+}
+
+// runLeadSync pulls records newer than the stored cursor through the provider's connector,
+// upserts them as leads and records the run
+func runLeadSync(integration models.Integration, trigger string) (models.LeadSyncRun, error) {
+	if _, busy := leadSyncRunning.LoadOrStore(integration.ID, true); busy {
+		return models.LeadSyncRun{}, fmt.Errorf("a sync for integration %d is already running", integration.ID)
+	}
+	defer leadSyncRunning.Delete(integration.ID)
+
+	run := models.LeadSyncRun{
+		IntegrationID: integration.ID,
+		Provider:      integration.Provider,
+		Trigger:       trigger,
+		StartedAt:     time.Now(),
+		Status:        "running",
+	}
+	if err := leadSyncDB.Create(&run).Error; err != nil {
+		return run, err
+	}
+
+	state := models.LeadSyncState{IntegrationID: integration.ID}
+	if err := leadSyncDB.Where("integration_id = ?", integration.ID).
+		Attrs(models.LeadSyncState{Provider: integration.Provider}).
+		FirstOrCreate(&state).Error; err != nil {
+		return finishLeadSyncRun(&run, &state, err)
+	}
+	run.CursorFrom = state.Cursor
+
+	connector, err := newLeadConnector(integration)
+	if err != nil {
+		return finishLeadSyncRun(&run, &state, err)
+	}
+
+	records, next, err := connector.FetchSince(state.Cursor)
+	if err != nil {
+		return finishLeadSyncRun(&run, &state, err)
+	}
+	run.Fetched = len(records)
+
+	var saved []ExternalLeadRecord
+	saveFailed := false
+	for _, rec := range records {
+		if rec.ExternalID == "" {
+			run.Failed++
+			continue
+		}
+
+		created, err := upsertExternalLead(leadSyncDB, integration.Provider, rec.ExternalID, connector.MapLead(rec))
+		if err != nil {
+			run.Failed++
+			saveFailed = true
+			log.Printf("lead sync: failed to save %s lead %s: %v", integration.Provider, rec.ExternalID, err)
+			continue
+		}
+		if created {
+			run.Created++
+		} else {
+			run.Updated++
+		}
+		saved = append(saved, rec)
+	}
+
+	if err := connector.Ack(saved); err != nil {
+		log.Printf("lead sync: %s ack failed: %v", integration.Provider, err)
+	}
+
+	// Records that failed to save are fetched again next run: the cursor stays where it was and
+	// the saved ones are simply upserted again. Records without an id can never be saved.
+	if saveFailed {
+		log.Printf("lead sync: %s cursor kept at %q after %d failed records", integration.Provider, state.Cursor, run.Failed)
+	} else {
+		state.Cursor = next
+	}
+	run.CursorTo = state.Cursor
+
+	return finishLeadSyncRun(&run, &state, nil)
+}
+
+// finishLeadSyncRun stores the outcome of a run on the run row and the integration state
+func finishLeadSyncRun(run *models.LeadSyncRun, state *models.LeadSyncState, runErr error) (models.LeadSyncRun, error) {
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Status = "success"
+	if runErr != nil {
+		run.Status = "failed"
+		run.Error = runErr.Error()
+	}
+	if err := leadSyncDB.Save(run).Error; err != nil {
+		log.Printf("lead sync: failed to record run %d: %v", run.ID, err)
+	}
+
+	if state.ID != 0 {
+		state.LastRunAt = &finished
+		state.LastStatus = run.Status
+		if err := leadSyncDB.Save(state).Error; err != nil {
+			log.Printf("lead sync: failed to save state for integration %d: %v", state.IntegrationID, err)
+		}
+	}
+
+	return *run, runErr
+}
+
+// upsertExternalLead creates a lead for an external record or refreshes the platform supplied
+// fields of the lead already pulled for it. Stage, assignment and notes are left to the CRM.
+func upsertExternalLead(db *gorm.DB, source, externalID string, lead models.Lead) (bool, error) {
+	var existing models.Lead
+	err := db.Where("external_source = ? AND external_id = ?", source, externalID).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		lead.ExternalSource = &source
+		lead.ExternalID = &externalID
+		if _, err := insertLead(db, &lead); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	updates := map[string]interface{}{}
+	set := func(column, value string) {
+		if value != "" {
+			updates[column] = value
+		}
+	}
+	set("business", lead.Business)
+	set("contact", lead.Name)
+	set("mobile", lead.Mobile)
+	set("email", lead.Email)
+	set("address_line1", lead.AddressLine1)
+	set("city", lead.City)
+	set("state", lead.State)
+	set("country", lead.Country)
+	set("category", lead.Category)
+	set("requirements", lead.Requirements)
+	set("product_name", lead.ProductName)
+	if len(updates) == 0 {
+		return false, nil
+	}
+
+	if err := db.Model(&existing).Updates(updates).Error; err != nil {
+		return false, err
+	}
+	touchLeadScore(existing.ID)
+	return false, nil
+}
+
+/* ========== HANDLERS ========== */
+
+// SyncIntegrationLeads runs a lead pull for one integration immediately
+func SyncIntegrationLeads(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var integration models.Integration
+	if err := leadSyncDB.First(&integration, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Integration not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if _, ok := leadConnectors[integration.Provider]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Lead sync is not supported for provider " + integration.Provider})
+	}
+	if !integration.IsActive {
+		return c.Status(400).JSON(fiber.Map{"error": "Integration is not active"})
+	}
+
+	run, err := runLeadSync(integration, "manual")
+	if err != nil {
+		if run.ID == 0 {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(502).JSON(fiber.Map{"error": err.Error(), "run": run})
+	}
+
+	return c.JSON(run)
+}
+
+// GetLeadSyncRuns lists recent sync runs. Query: integration_id, status, limit
+func GetLeadSyncRuns(c *fiber.Ctx) error {
+	var runs []models.LeadSyncRun
+
+	query := leadSyncDB.Order("started_at desc")
+	if integrationID := c.Query("integration_id"); integrationID != "" {
+		query = query.Where("integration_id = ?", integrationID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Limit(c.QueryInt("limit", 50)).Find(&runs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(runs)
+}
+
+// GetLeadSyncState returns the stored cursor of an integration
+func GetLeadSyncState(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var state models.LeadSyncState
+	if err := leadSyncDB.Where("integration_id = ?", id).First(&state).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Integration has not been synced yet"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(state)
+}
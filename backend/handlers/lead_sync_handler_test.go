@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"erp.local/backend/models"
+)
+
+// stubLeadConnector hands out fixed records and remembers what it was asked to ack
+type stubLeadConnector struct {
+	records []ExternalLeadRecord
+	next    string
+	acked   []ExternalLeadRecord
+}
+
+func (s *stubLeadConnector) FetchSince(cursor string) ([]ExternalLeadRecord, string, error) {
+	return s.records, s.next, nil
+}
+
+func (s *stubLeadConnector) MapLead(rec ExternalLeadRecord) models.Lead {
+	return models.Lead{Name: "Enquiry " + rec.ExternalID, Business: "Enquiry " + rec.ExternalID, Source: "Stub"}
+}
+
+func (s *stubLeadConnector) Ack(records []ExternalLeadRecord) error {
+	s.acked = append(s.acked, records...)
+	return nil
+}
+
+// useFakeLeadSyncDB points lead sync at a fake database for the length of the test
+func useFakeLeadSyncDB(t *testing.T) *fakeSQL {
+	t.Helper()
+
+	db, fake := openFakeDB(t)
+	prev := leadSyncDB
+	leadSyncDB = db
+	t.Cleanup(func() { leadSyncDB = prev })
+	return fake
+}
+
+// useStubLeadConnector registers a provider served by conn for the length of the test
+func useStubLeadConnector(t *testing.T, provider string, conn *stubLeadConnector) {
+	t.Helper()
+
+	leadConnectors[provider] = leadConnectorSpec{
+		New: func(models.Integration, *leadPlatformClient) (LeadConnector, error) { return conn, nil },
+	}
+	t.Cleanup(func() { delete(leadConnectors, provider) })
+}
+
+// leadSyncStateRows answers the state lookup with a stored cursor
+func leadSyncStateRows(cursor string) func(query string) ([]string, [][]driver.Value) {
+	return func(query string) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT") && strings.Contains(query, `FROM "lead_sync_states"`) {
+			return []string{"id", "integration_id", "provider", "cursor"}, [][]driver.Value{{int64(5), int64(9), "stub", cursor}}
+		}
+		return nil, nil
+	}
+}
+
+func TestUpsertExternalLeadCreatesLead(t *testing.T) {
+	db, fake := openFakeDB(t)
+
+	created, err := upsertExternalLead(db, "indiamart", "Q1", models.Lead{Name: "Ravi Kumar", Business: "Kumar Packaging", Mobile: "9876543210"})
+	if err != nil {
+		t.Fatalf("upsertExternalLead: %v", err)
+	}
+	if !created {
+		t.Error("created = false for a new external id")
+	}
+
+	inserts := fake.statements("INSERT", "leads")
+	if len(inserts) != 1 {
+		t.Fatalf("got %d lead inserts, want 1", len(inserts))
+	}
+	if !fakeArgsContain(inserts[0].Args, "indiamart") || !fakeArgsContain(inserts[0].Args, "Q1") {
+		t.Errorf("insert args %v lack the external source and id", inserts[0].Args)
+	}
+}
+
+func TestUpsertExternalLeadRefreshesExistingLead(t *testing.T) {
+	db, fake := openFakeDB(t)
+	fake.rowsFor = func(query string) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "SELECT") && strings.Contains(query, `FROM "leads"`) {
+			return []string{"id", "business", "stage"}, [][]driver.Value{{int64(42), "Kumar Packaging", "Qualified"}}
+		}
+		return nil, nil
+	}
+
+	created, err := upsertExternalLead(db, "indiamart", "Q1", models.Lead{Name: "Ravi Kumar", Mobile: "9876543210", Stage: "New"})
+	if err != nil {
+		t.Fatalf("upsertExternalLead: %v", err)
+	}
+	if created {
+		t.Error("created = true for an external id already pulled")
+	}
+	if len(fake.statements("INSERT", "leads")) != 0 {
+		t.Error("an existing external lead was inserted again")
+	}
+
+	updates := fake.statements("UPDATE", "leads")
+	if len(updates) != 1 {
+		t.Fatalf("got %d lead updates, want 1", len(updates))
+	}
+	if !fakeArgsContain(updates[0].Args, "9876543210") || !fakeArgsContain(updates[0].Args, "Ravi Kumar") {
+		t.Errorf("update args %v lack the platform fields", updates[0].Args)
+	}
+	// Blank platform fields and CRM owned fields are left alone
+	for _, column := range []string{`"business"`, `"stage"`, `"email"`} {
+		if strings.Contains(updates[0].Query, column) {
+			t.Errorf("update %q touches %s", updates[0].Query, column)
+		}
+	}
+}
+
+func TestRunLeadSyncKeepsCursorWhenASaveFails(t *testing.T) {
+	fake := useFakeLeadSyncDB(t)
+	fake.rowsFor = leadSyncStateRows("2026-10-18 09:00:00")
+	fake.failOn = func(query string, args []driver.Value) error {
+		if strings.HasPrefix(query, "INSERT") && strings.Contains(query, `"leads"`) && fakeArgsContain(args, "Q2") {
+			return errors.New("value too long for type character varying(20)")
+		}
+		return nil
+	}
+	conn := &stubLeadConnector{
+		records: []ExternalLeadRecord{{ExternalID: "Q1", ReceivedAt: time.Now()}, {ExternalID: "Q2", ReceivedAt: time.Now()}},
+		next:    "2026-10-18 10:00:00",
+	}
+	useStubLeadConnector(t, "stub", conn)
+
+	run, err := runLeadSync(models.Integration{ID: 9, Provider: "stub"}, "manual")
+	if err != nil {
+		t.Fatalf("runLeadSync: %v", err)
+	}
+	if run.Created != 1 || run.Failed != 1 {
+		t.Errorf("created %d and failed %d, want 1 and 1", run.Created, run.Failed)
+	}
+	if run.CursorFrom != "2026-10-18 09:00:00" || run.CursorTo != "2026-10-18 09:00:00" {
+		t.Errorf("cursor moved from %q to %q, want it held at the stored cursor", run.CursorFrom, run.CursorTo)
+	}
+	if len(conn.acked) != 1 || conn.acked[0].ExternalID != "Q1" {
+		t.Errorf("acked %v, want only the saved record", conn.acked)
+	}
+
+	states := fake.statements("UPDATE", "lead_sync_states")
+	if len(states) == 0 || fakeArgsContain(states[len(states)-1].Args, "2026-10-18 10:00:00") {
+		t.Errorf("stored state %v, want the cursor left at the stored value", states)
+	}
+}
+
+func TestRunLeadSyncAdvancesCursorWhenAllSaved(t *testing.T) {
+	fake := useFakeLeadSyncDB(t)
+	fake.rowsFor = leadSyncStateRows("2026-10-18 09:00:00")
+	conn := &stubLeadConnector{
+		records: []ExternalLeadRecord{{ExternalID: "Q1", ReceivedAt: time.Now()}},
+		next:    "2026-10-18 10:00:00",
+	}
+	useStubLeadConnector(t, "stub", conn)
+
+	run, err := runLeadSync(models.Integration{ID: 9, Provider: "stub"}, "manual")
+	if err != nil {
+		t.Fatalf("runLeadSync: %v", err)
+	}
+	if run.CursorTo != "2026-10-18 10:00:00" {
+		t.Errorf("cursor to = %q, want the connector's next cursor", run.CursorTo)
+	}
+
+	states := fake.statements("UPDATE", "lead_sync_states")
+	if len(states) == 0 || !fakeArgsContain(states[len(states)-1].Args, "2026-10-18 10:00:00") {
+		t.Errorf("stored state %v, want the new cursor", states)
+	}
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"regexp"
+	"strings"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	leadTagSeparators = regexp.MustCompile(`[,;|]`)
+	tagCodeSpaces     = regexp.MustCompile(`\s+`)
+	tagCodeInvalid    = regexp.MustCompile(`[^a-z0-9-]`)
+)
+
+/* ========== DTOs ========== */
+
+type SetLeadTagsRequest struct {
+	TagIDs []uint   `json:"tag_ids"`
+	Tags   []string `json:"tags"` // titles or codes; unknown ones are created
+}
+
+/* ========== HELPERS ========== */
+
+// splitLeadTags splits a free text tag list on , ; or | and drops blanks and repeats
+func splitLeadTags(s string) []string {
+	seen := map[string]bool{}
+	var titles []string
+	for _, part := range leadTagSeparators.Split(s, -1) {
+		title := strings.TrimSpace(part)
+		key := strings.ToLower(title)
+		if title == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		titles = append(titles, title)
+	}
+	return titles
+}
+
+// crmTagCode derives a tag code from its title; the tag migration uses the same rule in SQL
+func crmTagCode(title string) string {
+	code := strings.ToLower(strings.TrimSpace(title))
+	code = tagCodeSpaces.ReplaceAllString(code, "-")
+	code = tagCodeInvalid.ReplaceAllString(code, "")
+	if len(code) > 50 {
+		code = code[:50]
+	}
+	return code
+}
+
+// resolveCRMTags finds tags by title or code, creating the missing ones
+func resolveCRMTags(db *gorm.DB, titles []string) ([]models.CRMTag, error) {
+	var tags []models.CRMTag
+	for _, title := range titles {
+		if r := []rune(title); len(r) > 100 {
+			title = string(r[:100])
+		}
+		code := crmTagCode(title)
+		if code == "" {
+			continue
+		}
+
+		var tag models.CRMTag
+		err := db.Where("LOWER(title) = LOWER(?) OR code = ?", title, code).Order("id").First(&tag).Error
+		if err == gorm.ErrRecordNotFound {
+			tag = models.CRMTag{Code: code, Title: title, Active: true}
+			if err := db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "code"}}, DoNothing: true}).Create(&tag).Error; err != nil {
+				return nil, err
+			}
+			if tag.ID == 0 {
+				// Created concurrently under the same code
+				if err := db.Where("code = ?", code).First(&tag).Error; err != nil {
+					return nil, err
+				}
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// setLeadTags replaces the lead's tags and rewrites Lead.Tags as the list of their titles
+func setLeadTags(db *gorm.DB, lead *models.Lead, tags []models.CRMTag) error {
+	if err := db.Model(lead).Association("CRMTags").Replace(tags); err != nil {
+		return err
+	}
+	titles := make([]string, len(tags))
+	for i, t := range tags {
+		titles[i] = t.Title
+	}
+	lead.Tags = strings.Join(titles, ", ")
+	lead.CRMTags = tags
+	return db.Model(lead).UpdateColumn("tags", lead.Tags).Error
+}
+
+// applyLeadTagText maps the lead's free text Tags onto CRM tags
+func applyLeadTagText(db *gorm.DB, lead *models.Lead) error {
+	tags, err := resolveCRMTags(db, splitLeadTags(lead.Tags))
+	if err != nil {
+		return err
+	}
+	return setLeadTags(db, lead, tags)
+}
+
+// rewriteTaggedLeadsText renames a tag in the Tags text of every lead carrying it, or drops it
+// when newTitle is empty, so the text stays in step with the relation
+func rewriteTaggedLeadsText(db *gorm.DB, tagID uint, oldTitle, newTitle string) error {
+	var leads []models.Lead
+	if err := db.Select("id", "tags").
+		Where("id IN (SELECT lead_id FROM lead_crm_tags WHERE crm_tag_id = ?)", tagID).
+		Find(&leads).Error; err != nil {
+		return err
+	}
+	for _, lead := range leads {
+		var titles []string
+		for _, title := range splitLeadTags(lead.Tags) {
+			if strings.EqualFold(title, oldTitle) {
+				if newTitle == "" {
+					continue
+				}
+				title = newTitle
+			}
+			titles = append(titles, title)
+		}
+		if err := db.Model(&lead).UpdateColumn("tags", strings.Join(titles, ", ")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// leadTagFilter restricts a leads query to leads carrying the given tags (IDs, codes or titles).
+// With matchAll every tag must be present, otherwise any of them.
+func leadTagFilter(query *gorm.DB, values []string, matchAll bool) *gorm.DB {
+	var ids []string
+	var names []string
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.Trim(v, "0123456789") == "" {
+			ids = append(ids, v)
+		}
+		names = append(names, strings.ToLower(v))
+	}
+	if len(names) == 0 {
+		return query
+	}
+	if len(ids) == 0 {
+		ids = []string{"0"}
+	}
+
+	sub := "SELECT lct.lead_id FROM lead_crm_tags lct JOIN crm_tags t ON t.id = lct.crm_tag_id " +
+		"WHERE t.id::text IN ? OR t.code IN ? OR LOWER(t.title) IN ?"
+	if matchAll {
+		sub += " GROUP BY lct.lead_id HAVING COUNT(DISTINCT lct.crm_tag_id) >= ?"
+		return query.Where("leads.id IN ("+sub+")", ids, names, names, len(names))
+	}
+	return query.Where("leads.id IN ("+sub+")", ids, names, names)
+}
+
+/* ========== HANDLERS ========== */
+
+// GetLeadTags lists the CRM tags of a lead
+func GetLeadTags(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var lead models.Lead
+	if err := leadsDB.Preload("CRMTags").First(&lead, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(lead.CRMTags)
+}
+
+// SetLeadTags replaces a lead's tags with the given tag IDs and/or titles
+func SetLeadTags(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body SetLeadTagsRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	tx := leadsDB.Begin()
+
+	var lead models.Lead
+	if err := tx.First(&lead, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var tags []models.CRMTag
+	if len(body.TagIDs) > 0 {
+		if err := tx.Where("id IN ?", body.TagIDs).Find(&tags).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if len(tags) != len(body.TagIDs) {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": "One or more tag_ids not found"})
+		}
+	}
+	named, err := resolveCRMTags(tx, body.Tags)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, t := range named {
+		duplicate := false
+		for _, existing := range tags {
+			if existing.ID == t.ID {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			tags = append(tags, t)
+		}
+	}
+
+	if err := setLeadTags(tx, &lead, tags); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx.Commit()
+
+	return c.JSON(lead)
+}
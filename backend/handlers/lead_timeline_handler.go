@@ -0,0 +1,446 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	leadTimelineDefaultLimit = 50
+	leadTimelineMaxLimit     = 200
+)
+
+/* ========== DTOs ========== */
+
+// leadTimelineItem is one entry of a lead's activity feed. Item carries the underlying record.
+type leadTimelineItem struct {
+	Type      string      `json:"type"`
+	ID        uint        `json:"id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Title     string      `json:"title"`
+	UserID    *uint       `json:"user_id,omitempty"`
+	Item      interface{} `json:"item"`
+}
+
+// leadTimelineCursor is the position of the last item of a page. The feed is ordered by
+// timestamp, then type, then id, all descending, so every item has a unique position.
+type leadTimelineCursor struct {
+	At   time.Time
+	Type string
+	ID   uint
+}
+
+func (c leadTimelineCursor) encode() string {
+	raw := fmt.Sprintf("%d:%s:%d", c.At.UnixNano(), c.Type, c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseLeadTimelineCursor(s string) (*leadTimelineCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &leadTimelineCursor{At: time.Unix(0, nanos), Type: parts[1], ID: uint(id)}, nil
+}
+
+/* ========== SOURCES ========== */
+
+// leadTimelineSource reads one type of feed entry. query scopes the table to the lead; the
+// handler adds the cursor, order and limit on TimeColumn/IDColumn before load runs it.
+type leadTimelineSource struct {
+	Type       string
+	TimeColumn string
+	IDColumn   string
+	query      func(db *gorm.DB, lead *models.Lead) *gorm.DB
+	load       func(q *gorm.DB) ([]leadTimelineItem, error)
+}
+
+// leadQuotationScope matches quotations opened from the lead or made for its converted customer
+func leadQuotationScope(db *gorm.DB, lead *models.Lead) *gorm.DB {
+	if lead.CustomerID != nil {
+		return db.Where("lead_id = ? OR customer_id = ?", lead.ID, *lead.CustomerID)
+	}
+	return db.Where("lead_id = ?", lead.ID)
+}
+
+func leadQuotationIDs(db *gorm.DB, lead *models.Lead) *gorm.DB {
+	return leadQuotationScope(db.Model(&models.QuotationTable{}), lead).Select("quotation_id")
+}
+
+// Quotation entries carry a summary instead of the full quotation with its relations
+func timelineQuotation(q models.QuotationTable) fiber.Map {
+	return fiber.Map{
+		"quotation_id":     q.QuotationID,
+		"quotation_number": q.QuotationNumber,
+		"quotation_date":   q.QuotationDate,
+		"status":           q.Status,
+		"grand_total":      q.GrandTotal,
+		"currency":         q.Currency,
+		"lead_id":          q.LeadID,
+		"customer_id":      q.CustomerID,
+		"confirmed_at":     q.ConfirmedAt,
+	}
+}
+
+var quotationTimelineColumns = []string{"quotation_id", "quotation_number", "quotation_date", "status",
+	"grand_total", "currency", "lead_id", "customer_id", "confirmed_at", "created_by", "created_at"}
+
+// Every source of the lead timeline; ?types= picks a subset by Type
+var leadTimelineSources = []leadTimelineSource{
+	{
+		// Interactions logged for inbound mail and WhatsApp show up as email/whatsapp entries
+		Type: "interaction", TimeColumn: `"timestamp"`, IDColumn: "id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return db.Model(&models.LeadInteraction{}).Where("lead_id = ?", lead.ID).
+				Where("id NOT IN (SELECT interaction_id FROM inbound_emails WHERE interaction_id IS NOT NULL)").
+				Where("id NOT IN (SELECT interaction_id FROM whatsapp_messages WHERE interaction_id IS NOT NULL)")
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.LeadInteraction
+			if err := q.Preload("AssignedTo").Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, it := range rows {
+				items[i] = leadTimelineItem{ID: it.ID, Timestamp: it.Timestamp, UserID: it.AssignedToID, Item: it,
+					Title: strings.TrimSpace(it.Type + ": " + it.Summary)}
+			}
+			return items, nil
+		},
+	},
+	{
+		Type: "followup", TimeColumn: "follow_up_on", IDColumn: "id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return db.Model(&models.LeadFollowUp{}).Where("lead_id = ?", lead.ID)
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.LeadFollowUp
+			if err := q.Preload("AssignedTo").Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, f := range rows {
+				title := "Follow-up (" + f.Status + ")"
+				if f.Title != "" {
+					title += ": " + f.Title
+				}
+				items[i] = leadTimelineItem{ID: f.ID, Timestamp: f.FollowUpOn, UserID: f.AssignedToID, Item: f, Title: title}
+			}
+			return items, nil
+		},
+	},
+	{
+		Type: "stage_change", TimeColumn: "changed_at", IDColumn: "id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return db.Model(&models.LeadStageHistory{}).Where("lead_id = ?", lead.ID)
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.LeadStageHistory
+			if err := q.Preload("RejectionReason").Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, h := range rows {
+				title := "Stage set to " + h.ToStage
+				if h.FromStage != "" {
+					title = "Stage changed from " + h.FromStage + " to " + h.ToStage
+				}
+				items[i] = leadTimelineItem{ID: h.ID, Timestamp: h.ChangedAt, UserID: h.ChangedByID, Item: h, Title: title}
+			}
+			return items, nil
+		},
+	},
+	{
+		Type: "assignment", TimeColumn: "created_at", IDColumn: "id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return db.Model(&models.LeadAssignmentLog{}).Where("lead_id = ?", lead.ID)
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.LeadAssignmentLog
+			if err := q.Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			ids := []uint{}
+			for _, a := range rows {
+				if a.AssignedToID != nil {
+					ids = append(ids, *a.AssignedToID)
+				}
+			}
+			names := map[uint]string{}
+			if len(ids) > 0 {
+				var users []models.User
+				if err := leadsDB.Select("id", "firstname", "lastname").
+					Where("id IN ?", ids).Find(&users).Error; err != nil {
+					return nil, err
+				}
+				for _, u := range users {
+					names[u.ID] = strings.TrimSpace(u.Firstname + " " + u.Lastname)
+				}
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, a := range rows {
+				title := "Unassigned"
+				if a.AssignedToID != nil {
+					name := names[*a.AssignedToID]
+					if name == "" {
+						name = fmt.Sprintf("user %d", *a.AssignedToID)
+					}
+					title = "Assigned to " + name
+				}
+				if a.Method == "rule" {
+					title += " by rule"
+				}
+				items[i] = leadTimelineItem{ID: a.ID, Timestamp: a.CreatedAt, Item: a, Title: title}
+			}
+			return items, nil
+		},
+	},
+	{
+		Type: "edit", TimeColumn: "created_at", IDColumn: "id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return db.Model(&models.AuditLog{}).
+				Where("entity_type = ? AND entity_id = ? AND action = ?", "lead", lead.ID, "lead.update")
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.AuditLog
+			if err := q.Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, e := range rows {
+				var details struct {
+					Changes map[string]interface{} `json:"changes"`
+				}
+				_ = json.Unmarshal(e.Details, &details)
+				fields := make([]string, 0, len(details.Changes))
+				for key := range details.Changes {
+					fields = append(fields, key)
+				}
+				sort.Strings(fields)
+				items[i] = leadTimelineItem{ID: e.ID, Timestamp: e.CreatedAt, UserID: e.UserID, Item: e,
+					Title: "Edited " + strings.Join(fields, ", ")}
+			}
+			return items, nil
+		},
+	},
+	{
+		Type: "quotation", TimeColumn: "created_at", IDColumn: "quotation_id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return leadQuotationScope(db.Model(&models.QuotationTable{}), lead)
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.QuotationTable
+			if err := q.Select(quotationTimelineColumns).Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, qt := range rows {
+				createdBy := qt.CreatedBy
+				items[i] = leadTimelineItem{ID: qt.QuotationID, Timestamp: qt.CreatedAt, UserID: &createdBy,
+					Item: timelineQuotation(qt), Title: "Quotation " + qt.QuotationNumber + " created"}
+			}
+			return items, nil
+		},
+	},
+	{
+		Type: "quotation_confirmed", TimeColumn: "confirmed_at", IDColumn: "quotation_id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return leadQuotationScope(db.Model(&models.QuotationTable{}), lead).Where("confirmed_at IS NOT NULL")
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.QuotationTable
+			if err := q.Select(quotationTimelineColumns).Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, qt := range rows {
+				items[i] = leadTimelineItem{ID: qt.QuotationID, Timestamp: *qt.ConfirmedAt,
+					Item: timelineQuotation(qt), Title: "Quotation " + qt.QuotationNumber + " confirmed"}
+			}
+			return items, nil
+		},
+	},
+	{
+		Type: "email", TimeColumn: "received_at", IDColumn: "id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return db.Model(&models.InboundEmail{}).
+				Where("lead_id = ? OR quotation_id IN (?)", lead.ID, leadQuotationIDs(db, lead))
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.InboundEmail
+			if err := q.Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, e := range rows {
+				from := e.FromName
+				if from == "" {
+					from = e.FromAddress
+				}
+				items[i] = leadTimelineItem{ID: e.ID, Timestamp: e.ReceivedAt, Item: e,
+					Title: "Email from " + from + ": " + e.Subject}
+			}
+			return items, nil
+		},
+	},
+	{
+		// Outbound quotations sent over WhatsApp are linked by quotation_id
+		Type: "whatsapp", TimeColumn: "created_at", IDColumn: "id",
+		query: func(db *gorm.DB, lead *models.Lead) *gorm.DB {
+			return db.Model(&models.WhatsappMessage{}).
+				Where("lead_id = ? OR quotation_id IN (?)", lead.ID, leadQuotationIDs(db, lead))
+		},
+		load: func(q *gorm.DB) ([]leadTimelineItem, error) {
+			var rows []models.WhatsappMessage
+			if err := q.Find(&rows).Error; err != nil {
+				return nil, err
+			}
+			items := make([]leadTimelineItem, len(rows))
+			for i, m := range rows {
+				title := "WhatsApp to " + m.Number + " (" + m.Status + ")"
+				if m.Direction == "inbound" {
+					title = "WhatsApp from " + m.Number
+				}
+				if body := truncateRunes(m.Body, 80); body != "" {
+					title += ": " + body
+				}
+				items[i] = leadTimelineItem{ID: m.ID, Timestamp: m.CreatedAt, UserID: m.SentByID, Item: m, Title: title}
+			}
+			return items, nil
+		},
+	},
+}
+
+// afterLeadTimelineCursor keeps the rows of a source that come after the cursor in feed order
+func afterLeadTimelineCursor(q *gorm.DB, src leadTimelineSource, cur *leadTimelineCursor) *gorm.DB {
+	col := src.TimeColumn
+	switch {
+	case src.Type < cur.Type:
+		return q.Where(col+" <= ?", cur.At)
+	case src.Type == cur.Type:
+		return q.Where(col+" < ? OR ("+col+" = ? AND "+src.IDColumn+" < ?)", cur.At, cur.At, cur.ID)
+	default:
+		return q.Where(col+" < ?", cur.At)
+	}
+}
+
+/* ========== HANDLERS ========== */
+
+// GetLeadTimeline returns the activity feed of a lead, newest first: interactions, follow-ups,
+// stage changes, assignments, edits, quotations of the lead or its converted customer, inbound
+// emails and WhatsApp messages.
+// Query: types=interaction,email,... (default all), limit (default 50, max 200), cursor (the
+// next_cursor of the previous page).
+func GetLeadTimeline(c *fiber.Ctx) error {
+	var lead models.Lead
+	if err := leadsDB.Select("id", "customer_id").First(&lead, c.Params("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sources := leadTimelineSources
+	if list := strings.TrimSpace(c.Query("types")); list != "" {
+		byType := make(map[string]leadTimelineSource, len(leadTimelineSources))
+		for _, src := range leadTimelineSources {
+			byType[src.Type] = src
+		}
+		sources = nil
+		seen := map[string]bool{}
+		for _, t := range strings.Split(list, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if t == "" || seen[t] {
+				continue
+			}
+			seen[t] = true
+			src, ok := byType[t]
+			if !ok {
+				return c.Status(400).JSON(fiber.Map{"error": "Unknown timeline type: " + t})
+			}
+			sources = append(sources, src)
+		}
+	}
+
+	limit := c.QueryInt("limit", leadTimelineDefaultLimit)
+	if limit <= 0 {
+		limit = leadTimelineDefaultLimit
+	}
+	if limit > leadTimelineMaxLimit {
+		limit = leadTimelineMaxLimit
+	}
+
+	var cursor *leadTimelineCursor
+	if s := c.Query("cursor"); s != "" {
+		cur, err := parseLeadTimelineCursor(s)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid cursor"})
+		}
+		cursor = cur
+	}
+
+	// Each source contributes at most limit+1 rows past the cursor; the merged head is the page
+	var timeline []leadTimelineItem
+	for _, src := range sources {
+		q := src.query(leadsDB, &lead)
+		if cursor != nil {
+			q = afterLeadTimelineCursor(q, src, cursor)
+		}
+		q = q.Order(src.TimeColumn + " desc").Order(src.IDColumn + " desc").Limit(limit + 1)
+		items, err := src.load(q)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		for i := range items {
+			items[i].Type = src.Type
+		}
+		timeline = append(timeline, items...)
+	}
+
+	sort.Slice(timeline, func(i, j int) bool {
+		a, b := timeline[i], timeline[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.After(b.Timestamp)
+		}
+		if a.Type != b.Type {
+			return a.Type > b.Type
+		}
+		return a.ID > b.ID
+	})
+
+	var next interface{}
+	if len(timeline) > limit {
+		timeline = timeline[:limit]
+		last := timeline[limit-1]
+		next = leadTimelineCursor{At: last.Timestamp, Type: last.Type, ID: last.ID}.encode()
+	}
+	if timeline == nil {
+		timeline = []leadTimelineItem{}
+	}
+
+	return c.JSON(fiber.Map{
+		"data":        timeline,
+		"next_cursor": next,
+	})
+}
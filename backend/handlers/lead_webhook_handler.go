@@ -0,0 +1,379 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var leadWebhookDB *gorm.DB
+
+func SetLeadWebhookDB(db *gorm.DB) {
+	leadWebhookDB = db
+}
+
+// leadWebhookFields are the lead fields a payload can fill, with the payload keys tried
+// when the source's field map has no entry for the field
+var leadWebhookFields = []struct {
+	Field string
+	Keys  []string
+}{
+	{"external_id", []string{"external_id", "id", "lead_id", "leadid", "UNIQUE_QUERY_ID"}},
+	{"business", []string{"business", "company", "company_name", "SENDER_COMPANY"}},
+	{"name", []string{"name", "contact", "full_name", "SENDER_NAME"}},
+	{"designation", []string{"designation"}},
+	{"mobile", []string{"mobile", "phone", "phone_number", "SENDER_MOBILE"}},
+	{"email", []string{"email", "SENDER_EMAIL"}},
+	{"addressLine1", []string{"addressLine1", "address", "SENDER_ADDRESS"}},
+	{"addressLine2", []string{"addressLine2", "address2"}},
+	{"city", []string{"city", "SENDER_CITY"}},
+	{"state", []string{"state", "SENDER_STATE"}},
+	{"country", []string{"country", "SENDER_COUNTRY_ISO"}},
+	{"potential", []string{"potential", "budget"}},
+	{"gstin", []string{"gstin"}},
+	{"category", []string{"category", "QUERY_CATEGORY_NAME"}},
+	{"website", []string{"website"}},
+	{"requirements", []string{"requirements", "requirement", "message", "QUERY_MESSAGE"}},
+	{"notes", []string{"notes"}},
+	{"tags", []string{"tags"}},
+	{"productName", []string{"product", "product_name", "QUERY_PRODUCT_NAME"}},
+}
+
+// leadWebhookSource is the receiving configuration resolved from a LeadSource or an Integration
+type leadWebhookSource struct {
+	Key      string // external_source of the created leads
+	Name     string
+	Secret   string
+	FieldMap map[string]string
+}
+
+// validateWebhookFieldMap checks a field map is an object of lead field -> payload path
+func validateWebhookFieldMap(raw []byte) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var fieldMap map[string]string
+	if err := json.Unmarshal(raw, &fieldMap); err != nil {
+		return fmt.Errorf("field_map must be an object of lead field to payload path")
+	}
+	for field := range fieldMap {
+		known := false
+		for _, f := range leadWebhookFields {
+			if f.Field == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("field_map: unknown lead field %q", field)
+		}
+	}
+	return nil
+}
+
+// resolveLeadWebhookSource finds the source by LeadSource code, then by lead platform Integration provider
+func resolveLeadWebhookSource(code string) (*leadWebhookSource, error) {
+	var source models.LeadSource
+	err := leadWebhookDB.Where("LOWER(code) = ? AND active = true", code).First(&source).Error
+	if err == nil {
+		cfg := &leadWebhookSource{Key: code, Name: source.Name, Secret: source.WebhookSecret}
+		if len(source.FieldMap) > 0 {
+			_ = json.Unmarshal(source.FieldMap, &cfg.FieldMap)
+		}
+		return cfg, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var integration models.Integration
+	if err := leadWebhookDB.Where("LOWER(provider) = ? AND type = ? AND is_active = true", code, "lead_platform").First(&integration).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var config struct {
+		WebhookSecret string            `json:"webhook_secret"`
+		FieldMap      map[string]string `json:"field_map"`
+	}
+	_ = json.Unmarshal(integration.Config, &config)
+
+	// Share the provider key with the pull connectors so pushed and pulled copies dedupe
+	return &leadWebhookSource{Key: integration.Provider, Name: integration.Name, Secret: config.WebhookSecret, FieldMap: config.FieldMap}, nil
+}
+
+// verifyLeadWebhookSignature checks an HMAC-SHA256 of the raw body, sent as hex or base64
+// (optionally prefixed "sha256=")
+func verifyLeadWebhookSignature(secret string, body []byte, signature string) bool {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	if signature == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	if got, err := hex.DecodeString(signature); err == nil && hmac.Equal(got, expected) {
+		return true
+	}
+	if got, err := base64.StdEncoding.DecodeString(signature); err == nil && hmac.Equal(got, expected) {
+		return true
+	}
+	return false
+}
+
+// payloadValue reads a dot separated path from a decoded JSON object
+func payloadValue(payload map[string]interface{}, path string) interface{} {
+	var cur interface{} = payload
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[part]
+	}
+	return cur
+}
+
+func payloadString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, 0, len(t))
+		for _, it := range t {
+			if s := payloadString(it); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ",")
+	}
+	return ""
+}
+
+// mapWebhookLead builds a lead from a payload through the source's field map
+func mapWebhookLead(cfg *leadWebhookSource, payload map[string]interface{}) (string, models.Lead, error) {
+	values := map[string]string{}
+	for _, f := range leadWebhookFields {
+		if path, ok := cfg.FieldMap[f.Field]; ok && path != "" {
+			values[f.Field] = payloadString(payloadValue(payload, path))
+			continue
+		}
+		for _, k := range f.Keys {
+			if s := payloadString(payload[k]); s != "" {
+				values[f.Field] = s
+				break
+			}
+		}
+	}
+
+	lead := models.Lead{
+		Business:     values["business"],
+		Name:         values["name"],
+		Designation:  values["designation"],
+		Mobile:       values["mobile"],
+		Email:        values["email"],
+		AddressLine1: values["addressLine1"],
+		AddressLine2: values["addressLine2"],
+		City:         values["city"],
+		State:        values["state"],
+		Country:      values["country"],
+		GSTIN:        values["gstin"],
+		Category:     values["category"],
+		Website:      values["website"],
+		Requirements: values["requirements"],
+		Notes:        values["notes"],
+		Tags:         values["tags"],
+		ProductName:  values["productName"],
+		Source:       cfg.Name,
+	}
+	if p, err := strconv.ParseFloat(values["potential"], 64); err == nil {
+		lead.Potential = p
+	}
+	if lead.Business == "" {
+		lead.Business = lead.Name
+	}
+
+	if lead.Name == "" && lead.Mobile == "" && lead.Email == "" {
+		return "", lead, fmt.Errorf("payload has no name, mobile or email")
+	}
+	return values["external_id"], lead, nil
+}
+
+// leadWebhookPayloadLimit caps the part of a refused body kept for inspection
+const leadWebhookPayloadLimit = 16 * 1024
+
+// logLeadWebhookRejection stores a refused payload, cut to fit the rejection columns
+func logLeadWebhookRejection(c *fiber.Ctx, source, reason string) {
+	rejection := models.LeadWebhookRejection{
+		Source:    truncateRunes(source, 50),
+		Reason:    truncateRunes(reason, 255),
+		Signature: truncateRunes(leadWebhookSignatureHeader(c), 255),
+		RemoteIP:  c.IP(),
+		Payload:   truncateRunes(string(c.Body()), leadWebhookPayloadLimit),
+	}
+	if err := leadWebhookDB.Create(&rejection).Error; err != nil {
+		log.Printf("lead webhook: could not log rejection for %s: %v", source, err)
+	}
+}
+
+// rejectLeadWebhook logs a refused payload and answers with the given status
+func rejectLeadWebhook(c *fiber.Ctx, source string, status int, reason string) error {
+	logLeadWebhookRejection(c, source, reason)
+	return c.Status(status).JSON(fiber.Map{"error": reason})
+}
+
+func leadWebhookSignatureHeader(c *fiber.Ctx) string {
+	for _, h := range []string{"X-Signature", "X-Webhook-Signature", "X-Hub-Signature-256"} {
+		if v := c.Get(h); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+/* ========== HANDLERS ========== */
+
+// ReceiveLeadWebhook creates leads pushed by a platform or website form. The body is a JSON
+// object or an array of objects, signed with the source's secret in X-Signature. Deliveries
+// repeating an external ID return the lead created the first time. In a batch each item gets
+// its own result, so an item that could not be stored does not hide the ones that were.
+func ReceiveLeadWebhook(c *fiber.Ctx) error {
+	code := strings.ToLower(c.Params("source"))
+
+	cfg, err := resolveLeadWebhookSource(code)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if cfg == nil {
+		return rejectLeadWebhook(c, code, 404, "Unknown lead source")
+	}
+	if cfg.Secret == "" {
+		return rejectLeadWebhook(c, code, 403, "Webhook secret is not configured for this source")
+	}
+	if !verifyLeadWebhookSignature(cfg.Secret, c.Body(), leadWebhookSignatureHeader(c)) {
+		return rejectLeadWebhook(c, code, 401, "Invalid signature")
+	}
+
+	var payloads []map[string]interface{}
+	batch := strings.HasPrefix(strings.TrimSpace(string(c.Body())), "[")
+	if batch {
+		if err := json.Unmarshal(c.Body(), &payloads); err != nil {
+			return rejectLeadWebhook(c, code, 400, "Invalid JSON: "+err.Error())
+		}
+	} else {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &payload); err != nil {
+			return rejectLeadWebhook(c, code, 400, "Invalid JSON: "+err.Error())
+		}
+		payloads = append(payloads, payload)
+	}
+
+	var results []fiber.Map
+	var rejected []string
+	created := false
+	stored := 0
+	for i, payload := range payloads {
+		externalID, lead, err := mapWebhookLead(cfg, payload)
+		if err != nil {
+			rejected = append(rejected, fmt.Sprintf("item %d: %s", i, err.Error()))
+			results = append(results, fiber.Map{"index": i, "error": err.Error()})
+			continue
+		}
+
+		leadID, isNew, err := createWebhookLead(cfg.Key, externalID, lead)
+		if err != nil {
+			if !batch {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			log.Printf("lead webhook: could not store item %d for %s: %v", i, code, err)
+			results = append(results, fiber.Map{"index": i, "external_id": externalID, "error": err.Error()})
+			continue
+		}
+		stored++
+		created = created || isNew
+		results = append(results, fiber.Map{"index": i, "lead_id": leadID, "external_id": externalID, "duplicate": !isNew})
+	}
+
+	if len(rejected) > 0 {
+		if len(rejected) == len(payloads) {
+			return rejectLeadWebhook(c, code, 422, strings.Join(rejected, "; "))
+		}
+		logLeadWebhookRejection(c, code, strings.Join(rejected, "; "))
+	}
+
+	status := 200
+	if created {
+		status = 201
+	}
+	if stored == 0 && len(rejected) < len(payloads) {
+		// Nothing was stored and at least one item hit the database: let the sender retry
+		status = 500
+	}
+	if !batch {
+		return c.Status(status).JSON(results[0])
+	}
+	return c.Status(status).JSON(fiber.Map{"results": results})
+}
+
+// createWebhookLead stores a lead once per external ID; without an ID every delivery creates a lead
+func createWebhookLead(source, externalID string, lead models.Lead) (uint, bool, error) {
+	if externalID == "" {
+		if _, err := insertLead(leadWebhookDB, &lead); err != nil {
+			return 0, false, err
+		}
+		return lead.ID, true, nil
+	}
+
+	var existing models.Lead
+	err := leadWebhookDB.Where("external_source = ? AND external_id = ?", source, externalID).First(&existing).Error
+	if err == nil {
+		return existing.ID, false, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return 0, false, err
+	}
+
+	lead.ExternalSource = &source
+	lead.ExternalID = &externalID
+	if _, err := insertLead(leadWebhookDB, &lead); err != nil {
+		// A concurrent delivery of the same ID won the unique index
+		if leadWebhookDB.Where("external_source = ? AND external_id = ?", source, externalID).First(&existing).Error == nil {
+			return existing.ID, false, nil
+		}
+		return 0, false, err
+	}
+	return lead.ID, true, nil
+}
+
+// GetLeadWebhookRejections lists refused payloads. Query: source, limit
+func GetLeadWebhookRejections(c *fiber.Ctx) error {
+	var rejections []models.LeadWebhookRejection
+
+	query := leadWebhookDB.Order("created_at desc")
+	if source := c.Query("source"); source != "" {
+		query = query.Where("source = ?", strings.ToLower(source))
+	}
+
+	if err := query.Limit(c.QueryInt("limit", 100)).Find(&rejections).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(rejections)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var notificationDB *gorm.DB
+
+func SetNotificationDB(db *gorm.DB) {
+	notificationDB = db
+}
+
+// notifyUser queues an in-app notification for a user within db (which may be a transaction)
+func notifyUser(db *gorm.DB, userID uint, kind, title, message, entityType string, entityID *uint) error {
+	notification := models.Notification{
+		UserID:     userID,
+		Type:       kind,
+		Title:      title,
+		Message:    message,
+		EntityType: entityType,
+		EntityID:   entityID,
+	}
+	return db.Create(&notification).Error
+}
+
+/* ========== HANDLERS ========== */
+
+// GetNotifications lists a user's notifications, newest first. Query: user_id (required), unread, limit
+func GetNotifications(c *fiber.Ctx) error {
+	userID := c.QueryInt("user_id", 0)
+	if userID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "user_id is required"})
+	}
+
+	query := notificationDB.Where("user_id = ?", userID).Order("created_at desc")
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Limit(c.QueryInt("limit", 50)).Find(&notifications).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var unread int64
+	if err := notificationDB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   notifications,
+		"unread": unread,
+	})
+}
+
+// MarkNotificationRead marks one notification read
+func MarkNotificationRead(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var notification models.Notification
+	if err := notificationDB.First(&notification, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Notification not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if notification.ReadAt == nil {
+		now := time.Now()
+		notification.ReadAt = &now
+		if err := notificationDB.Model(&notification).Update("read_at", now).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(notification)
+}
+
+// MarkAllNotificationsRead marks every unread notification of a user read. Query: user_id
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	userID := c.QueryInt("user_id", 0)
+	if userID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "user_id is required"})
+	}
+
+	result := notificationDB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": result.Error.Error()})
+	}
+
+	return c.JSON(fiber.Map{"updated": result.RowsAffected})
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"gorm.io/gorm"
+)
+
+// Channels a user can be reached on outside the app
+const (
+	channelInApp    = "in_app"
+	channelEmail    = "email"
+	channelWhatsApp = "whatsapp"
+)
+
+// activeIntegration returns the most recently updated active integration of a type, or nil
+func activeIntegration(db *gorm.DB, kind string) (*models.Integration, error) {
+	var integration models.Integration
+	err := db.Where("type = ? AND is_active = true", kind).Order("updated_at desc").First(&integration).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &integration, nil
+}
+
+// sendIntegrationEmail sends a plain text mail through the SMTP settings of the active email
+// integration (config: host, port, username, password, from). Port 465 uses implicit TLS;
+// other ports upgrade with STARTTLS when the server offers it.
+func sendIntegrationEmail(db *gorm.DB, to, subject, body string) error {
+	integration, err := activeIntegration(db, "email")
+	if err != nil {
+		return err
+	}
+	if integration == nil {
+		return fmt.Errorf("no active email integration")
+	}
+
+	host := integrationConfigString(integration.Config, "host", "smtp_host")
+	port := integrationConfigString(integration.Config, "port", "smtp_port")
+	username := integrationConfigString(integration.Config, "username", "user")
+	password := integrationConfigString(integration.Config, "password", "app_password")
+	from := integrationConfigString(integration.Config, "from", "from_email")
+	if from == "" {
+		from = username
+	}
+	if host == "" || from == "" {
+		return fmt.Errorf("email integration %d has no host or sender", integration.ID)
+	}
+	if port == "" {
+		port = "587"
+	}
+
+	msg := strings.Join([]string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	addr := net.JoinHostPort(host, port)
+
+	if port != "465" {
+		return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// sendIntegrationWhatsApp sends a plain text message through the active whatsapp integration
+// (see sendWhatsApp); the message is logged but not tied to a lead
+func sendIntegrationWhatsApp(db *gorm.DB, to, text string) error {
+	_, err := sendWhatsApp(db, whatsAppOutgoing{To: to, Text: text})
+	return err
+}
+
+// userWhatsAppNumber prefers the user's WhatsApp number over the mobile number
+func userWhatsAppNumber(user *models.User) string {
+	if user.WhatsappNumber != nil && strings.TrimSpace(*user.WhatsappNumber) != "" {
+		return strings.TrimSpace(*user.WhatsappNumber)
+	}
+	return strings.TrimSpace(user.MobileNumber)
+}
+
+// managerUserID follows EmployeeHierarchy from a user to the user of their manager, preferring a
+// reports_to relation. It returns nil when the user is not an employee or has no manager.
+func managerUserID(db *gorm.DB, userID uint) (*uint, error) {
+	var ids []uint
+	err := db.Table("employee_hierarchies AS h").
+		Joins("JOIN employees e ON e.id = h.employee_id").
+		Joins("JOIN employees m ON m.id = h.manager_id").
+		Where("e.user_id = ? AND m.user_id <> 0 AND m.user_id <> ?", userID, userID).
+		Where("(m.exit_date IS NULL OR m.exit_date > NOW())").
+		Order("CASE WHEN h.relation_type = 'reports_to' THEN 0 ELSE 1 END, h.id").
+		Limit(1).Pluck("m.user_id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return &ids[0], nil
+}
@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Document dates are numbered in Indian Standard Time so the April 1 boundary is local
+var istLocation = time.FixedZone("IST", 5*60*60+30*60)
+
+// Supported tokens: {prefix} {postfix} {branch} {FY} (2025-26) {FY2} (25-26) {YYYY} {YY} {MM} {seq} {seq:05}
+var seriesTokenRe = regexp.MustCompile(`\{(prefix|postfix|branch|FY2|FY|YYYY|YY|MM|seq(?::(\d+))?)\}`)
+
+var financialYearRe = regexp.MustCompile(`^(\d{4})-(\d{2})$`)
+
+// seriesPeriod identifies the counter row a document number is drawn from
+type seriesPeriod struct {
+	CompanyBranchID uint
+	FinancialYear   string
+	Period          string
+}
+
+// financialYearOf returns the Indian financial year (April–March) a date falls in, e.g. 2025-26
+func financialYearOf(t time.Time) string {
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// financialYearEnd returns the first instant after the given financial year (April 1, IST)
+func financialYearEnd(fy string) (time.Time, error) {
+	m := financialYearRe.FindStringSubmatch(fy)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("financial_year must look like 2025-26")
+	}
+	start, _ := strconv.Atoi(m[1])
+	if fmt.Sprintf("%d-%02d", start, (start+1)%100) != fy {
+		return time.Time{}, fmt.Errorf("financial_year %s is not a valid year range", fy)
+	}
+	return time.Date(start+1, time.April, 1, 0, 0, 0, 0, istLocation), nil
+}
+
+// defaultSeriesPattern returns the pattern used when a series has none of its own
+func defaultSeriesPattern(series *models.Series) string {
+	pattern := "{prefix}/{FY}/{seq:05}{postfix}"
+	switch series.ResetPolicy {
+	case models.SeriesResetNever:
+		pattern = "{prefix}{seq:05}{postfix}"
+	case models.SeriesResetMonthly:
+		pattern = "{prefix}/{FY}/{MM}/{seq:05}{postfix}"
+	}
+	if series.BranchScoped {
+		pattern = "{branch}/" + pattern
+	}
+	return pattern
+}
+
+// validateSeriesConfig checks the pattern tokens and that the pattern keeps numbers unique
+// across resets: yearly series need the financial year, monthly series also the month,
+// and branch scoped series the branch code.
+func validateSeriesConfig(pattern, resetPolicy string, branchScoped bool) error {
+	switch resetPolicy {
+	case models.SeriesResetNever, models.SeriesResetYearly, models.SeriesResetMonthly:
+	default:
+		return fmt.Errorf("reset_policy must be one of never, yearly, monthly")
+	}
+	if pattern == "" {
+		return nil
+	}
+	if !strings.Contains(pattern, "{seq") {
+		return fmt.Errorf("pattern must contain {seq} or {seq:NN}")
+	}
+	rest := seriesTokenRe.ReplaceAllString(pattern, "")
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("pattern contains unknown tokens")
+	}
+
+	hasFY := strings.Contains(pattern, "{FY}") || strings.Contains(pattern, "{FY2}")
+	if resetPolicy == models.SeriesResetYearly && !hasFY {
+		return fmt.Errorf("yearly series pattern must contain {FY} or {FY2}")
+	}
+	if resetPolicy == models.SeriesResetMonthly {
+		hasYear := hasFY || strings.Contains(pattern, "{YYYY}") || strings.Contains(pattern, "{YY}")
+		if !hasYear || !strings.Contains(pattern, "{MM}") {
+			return fmt.Errorf("monthly series pattern must contain a year token and {MM}")
+		}
+	}
+	if branchScoped && !strings.Contains(pattern, "{branch}") {
+		return fmt.Errorf("branch scoped series pattern must contain {branch}")
+	}
+	return nil
+}
+
+// seriesCoversBranch reports whether a document of the given branch may use the series
+func seriesCoversBranch(series *models.Series, branchID uint) bool {
+	var branchIDs []uint
+	if len(series.CompanyBranchIDs) > 0 {
+		_ = json.Unmarshal(series.CompanyBranchIDs, &branchIDs)
+	}
+	if len(branchIDs) == 0 && series.CompanyBranchID == nil {
+		return true
+	}
+	if series.CompanyBranchID != nil && *series.CompanyBranchID == branchID {
+		return true
+	}
+	for _, id := range branchIDs {
+		if id == branchID {
+			return true
+		}
+	}
+	return false
+}
+
+// seriesPeriodOf returns the counter key for a document date according to the reset policy
+func seriesPeriodOf(series *models.Series, docDate time.Time, branchID uint) seriesPeriod {
+	p := seriesPeriod{}
+	if series.BranchScoped {
+		p.CompanyBranchID = branchID
+	}
+	switch series.ResetPolicy {
+	case models.SeriesResetNever:
+	case models.SeriesResetMonthly:
+		p.FinancialYear = financialYearOf(docDate)
+		p.Period = docDate.Format("2006-01")
+	default:
+		p.FinancialYear = financialYearOf(docDate)
+	}
+	return p
+}
+
+// formatSeriesNumber renders a document number for the given sequence using the series pattern
+func formatSeriesNumber(series *models.Series, seq uint, docDate time.Time, branchCode string) string {
+	pattern := series.Pattern
+	if pattern == "" {
+		pattern = defaultSeriesPattern(series)
+	}
+	fy := financialYearOf(docDate)
+
+	return seriesTokenRe.ReplaceAllStringFunc(pattern, func(token string) string {
+		m := seriesTokenRe.FindStringSubmatch(token)
+		switch {
+		case m[1] == "prefix":
+			return series.Prefix
+		case m[1] == "postfix":
+			return series.Postfix
+		case m[1] == "branch":
+			return branchCode
+		case m[1] == "FY":
+			return fy
+		case m[1] == "FY2":
+			return fy[2:]
+		case m[1] == "YYYY":
+			return docDate.Format("2006")
+		case m[1] == "YY":
+			return docDate.Format("06")
+		case m[1] == "MM":
+			return docDate.Format("01")
+		default:
+			width, _ := strconv.Atoi(m[2])
+			return fmt.Sprintf("%0*d", width, seq)
+		}
+	})
+}
+
+// prepareSeriesNumbering validates a series for a document and returns its counter key and branch
+func prepareSeriesNumbering(db *gorm.DB, series *models.Series, docDate time.Time, branchID uint) (seriesPeriod, models.CompanyBranch, error) {
+	var branch models.CompanyBranch
+
+	if series == nil || series.ID == 0 {
+		return seriesPeriod{}, branch, fmt.Errorf("series is required for numbering")
+	}
+	if !series.IsActive {
+		return seriesPeriod{}, branch, fmt.Errorf("series %q is inactive", series.Name)
+	}
+	if branchID != 0 {
+		if !seriesCoversBranch(series, branchID) {
+			return seriesPeriod{}, branch, fmt.Errorf("series %q is not available for branch %d", series.Name, branchID)
+		}
+		if err := db.First(&branch, branchID).Error; err != nil {
+			return seriesPeriod{}, branch, fmt.Errorf("Invalid company branch")
+		}
+	} else if series.BranchScoped {
+		return seriesPeriod{}, branch, fmt.Errorf("company branch is required for branch scoped series %q", series.Name)
+	}
+
+	var closed int64
+	fy := financialYearOf(docDate)
+	if err := db.Model(&models.SeriesYearClosure{}).
+		Where("series_id = ? AND financial_year = ?", series.ID, fy).
+		Count(&closed).Error; err != nil {
+		return seriesPeriod{}, branch, err
+	}
+	if closed > 0 {
+		return seriesPeriod{}, branch, fmt.Errorf("financial year %s is closed for series %q", fy, series.Name)
+	}
+
+	return seriesPeriodOf(series, docDate, branchID), branch, nil
+}
+
+// nextSeriesNumber draws the next document number of a series. It must run inside the
+// transaction that inserts the document: the counter row stays locked until commit and a
+// rollback returns the number, so numbers are sequential per series and period without gaps.
+func nextSeriesNumber(tx *gorm.DB, series *models.Series, docDate time.Time, branchID uint, documentType string) (string, error) {
+	docDate = docDate.In(istLocation)
+
+	period, branch, err := prepareSeriesNumbering(tx, series, docDate, branchID)
+	if err != nil {
+		return "", err
+	}
+
+	start := series.StartNumber
+	if start == 0 {
+		start = 1
+	}
+	counter := models.SeriesCounter{
+		SeriesID:        series.ID,
+		CompanyBranchID: period.CompanyBranchID,
+		FinancialYear:   period.FinancialYear,
+		Period:          period.Period,
+		LastNumber:      start - 1,
+	}
+
+	// Make sure the counter row exists, then lock it
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("series_id = ? AND company_branch_id = ? AND financial_year = ? AND period = ?",
+			counter.SeriesID, counter.CompanyBranchID, counter.FinancialYear, counter.Period).
+		First(&counter).Error; err != nil {
+		return "", err
+	}
+
+	counter.LastNumber++
+	if err := tx.Model(&counter).Update("last_number", counter.LastNumber).Error; err != nil {
+		return "", err
+	}
+
+	number := formatSeriesNumber(series, counter.LastNumber, docDate, branch.Code)
+
+	// Register the number under the branch GSTIN; the unique index rejects a repeat in the same year
+	if gstin := strings.TrimSpace(branch.GSTNumber); gstin != "" {
+		issued := models.IssuedDocumentNumber{
+			GSTIN:           strings.ToUpper(gstin),
+			FinancialYear:   financialYearOf(docDate),
+			DocumentNumber:  number,
+			SeriesID:        series.ID,
+			CompanyBranchID: branch.ID,
+			DocumentType:    documentType,
+		}
+		if err := tx.Create(&issued).Error; err != nil {
+			return "", fmt.Errorf("document number %s is already used for GSTIN %s in %s", number, issued.GSTIN, issued.FinancialYear)
+		}
+	}
+
+	return number, nil
+}
+
+// previewSeriesNumbers returns the next count numbers of a series without issuing them
+func previewSeriesNumbers(db *gorm.DB, series *models.Series, docDate time.Time, branchID uint, count int) ([]string, error) {
+	docDate = docDate.In(istLocation)
+
+	period, branch, err := prepareSeriesNumbering(db, series, docDate, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	last := uint(0)
+	if series.StartNumber > 0 {
+		last = series.StartNumber - 1
+	}
+	var counter models.SeriesCounter
+	err = db.Where("series_id = ? AND company_branch_id = ? AND financial_year = ? AND period = ?",
+		series.ID, period.CompanyBranchID, period.FinancialYear, period.Period).
+		First(&counter).Error
+	if err == nil {
+		last = counter.LastNumber
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	numbers := make([]string, 0, count)
+	for i := 1; i <= count; i++ {
+		numbers = append(numbers, formatSeriesNumber(series, last+uint(i), docDate, branch.Code))
+	}
+	return numbers, nil
+}
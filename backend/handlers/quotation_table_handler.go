@@ -303,9 +303,11 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"erp.local/backend/models"
 
@@ -331,11 +333,32 @@ type QuotationRequest struct {
 }
 
 // ================================
-// Helper: Generate Quotation Number
-// PREFIX + QUOTATION_ID + POSTFIX
+// Helper: Resolve Numbering Series
+// Explicit series_id, else the active series for the document type and branch
 // ================================
-func generateQuotationNumber(series *models.Series, quotationID uint) string {
-	return fmt.Sprintf("%s%d%s", series.Prefix, quotationID, series.Postfix)
+func resolveQuotationSeries(tx *gorm.DB, q *models.QuotationTable) (models.Series, error) {
+	var series models.Series
+	if q.SeriesID != nil && *q.SeriesID != 0 {
+		if err := tx.First(&series, *q.SeriesID).Error; err != nil {
+			return series, fmt.Errorf("Invalid series")
+		}
+		return series, nil
+	}
+
+	docType := strings.TrimSpace(q.DocumentType)
+	if docType == "" {
+		docType = "Quotation"
+	}
+
+	query := tx.Where("is_active = true AND document_type ILIKE ?", docType)
+	if q.CompanyBranchID != 0 {
+		query = query.Where("company_branch_id = ? OR company_branch_ids @> ? OR (company_branch_id IS NULL AND company_branch_ids IS NULL)",
+			q.CompanyBranchID, fmt.Sprintf("[%d]", q.CompanyBranchID))
+	}
+	if err := query.Order("id asc").First(&series).Error; err != nil {
+		return series, fmt.Errorf("No active series configured for %s", docType)
+	}
+	return series, nil
 }
 
 // ================================
@@ -407,51 +430,38 @@ func CreateQuotationTable(c *fiber.Ctx) error {
 	// ---------------------------
 	tx := quotationTableDB.Begin()
 
-	// Validate Series (optional)
-	var series models.Series
-	if req.Quotation.SeriesID != nil {
-		if err := tx.First(&series, *req.Quotation.SeriesID).Error; err != nil {
-			tx.Rollback()
-			return c.Status(400).JSON(fiber.Map{"error": "Invalid series"})
-		}
+	// Resolve the numbering series
+	series, err := resolveQuotationSeries(tx, &req.Quotation)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
+	req.Quotation.SeriesID = &series.ID
 
 	// Set defaults
 	req.Quotation.Status = models.Qt_Open
+	if req.Quotation.QuotationDate.IsZero() {
+		req.Quotation.QuotationDate = time.Now()
+	}
 
-	// If client provided a quotation number, validate uniqueness and use it.
-	providedQNo := strings.TrimSpace(req.Quotation.QuotationNumber)
-	if providedQNo != "" {
-		// ensure uniqueness
-		var exists int64
-		if err := tx.Model(&models.QuotationTable{}).Where("quotation_number = ?", providedQNo).Count(&exists).Error; err != nil {
-			tx.Rollback()
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		if exists > 0 {
-			tx.Rollback()
-			return c.Status(400).JSON(fiber.Map{"error": "quotation_number already exists"})
-		}
+	// Quotation numbers are always issued by the series; a client supplied number is ignored
+	quotationNo, err := nextSeriesNumber(tx, &series, req.Quotation.QuotationDate, req.Quotation.CompanyBranchID, req.Quotation.DocumentType)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	req.Quotation.QuotationNumber = quotationNo
 
-		// Keep the provided quotation number and create the record
-		if err := tx.Create(&req.Quotation).Error; err != nil {
-			tx.Rollback()
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-	} else {
-		// No quotation number provided — generate one based on series and created ID
-		req.Quotation.QuotationNumber = "" // temporary
-		if err := tx.Create(&req.Quotation).Error; err != nil {
-			tx.Rollback()
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
+	// Fix the exchange rate for the quotation date and store INR totals
+	if err := resolveQuotationExchangeRate(tx, &req.Quotation); err != nil {
+		tx.Rollback()
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	applyBaseCurrencyTotals(&req.Quotation)
 
-		quotationNo := generateQuotationNumber(&series, req.Quotation.QuotationID)
-		if err := tx.Model(&req.Quotation).
-			Update("quotation_number", quotationNo).Error; err != nil {
-			tx.Rollback()
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
+	if err := tx.Create(&req.Quotation).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	// STEP 4: Insert quotation items
@@ -468,6 +478,10 @@ func CreateQuotationTable(c *fiber.Ctx) error {
 
 	tx.Commit()
 
+	if req.Quotation.LeadID != nil {
+		touchLeadScore(*req.Quotation.LeadID)
+	}
+
 	return c.Status(201).JSON(fiber.Map{
 		"quotation":       req.Quotation,
 		"quotation_items": req.QuotationItems,
@@ -525,6 +539,7 @@ func GetQuotationTable(c *fiber.Ctx) error {
 		Preload("SalesCreditPerson").
 		Preload("BillingAddress").
 		Preload("ShippingAddress").
+		Preload("RejectionReason").
 		Preload("QuotationTableItems.Product.Variants").
 		Preload("QuotationTableItems.Product").
 		First(&quotation, id).Error; err != nil {
@@ -629,8 +644,43 @@ func UpdateQuotationTable(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Quotation not found"})
 	}
 
-	// Update main quotation fields (avoid changing primary key)
-	if err := tx.Model(&existing).Updates(req.Quotation).Error; err != nil {
+	// Stamp the confirmation time the first time the quotation is confirmed
+	if strings.EqualFold(string(req.Quotation.Status), string(models.Qt_Confirmed)) && existing.ConfirmedAt == nil {
+		now := time.Now()
+		req.Quotation.ConfirmedAt = &now
+	}
+
+	// A new currency without an explicit rate takes the rate for the quotation date
+	currencyChanged := req.Quotation.Currency != nil &&
+		(existing.Currency == nil || !strings.EqualFold(*existing.Currency, *req.Quotation.Currency))
+	resetRate := currencyChanged && req.Quotation.ExchangeRate == nil
+
+	// Update main quotation fields (avoid changing primary key and the issued number)
+	if err := tx.Model(&existing).Omit("quotation_number", "series_id").Updates(req.Quotation).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Recompute the INR totals from the stored amounts
+	if err := tx.First(&existing, existing.QuotationID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if resetRate {
+		existing.ExchangeRate = nil
+	}
+	if err := resolveQuotationExchangeRate(tx, &existing); err != nil {
+		tx.Rollback()
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	applyBaseCurrencyTotals(&existing)
+	if err := tx.Model(&existing).UpdateColumns(map[string]interface{}{
+		"currency":          existing.Currency,
+		"exchange_rate":     existing.ExchangeRate,
+		"base_total_amount": existing.BaseTotalAmount,
+		"base_tax_amount":   existing.BaseTaxAmount,
+		"base_grand_total":  existing.BaseGrandTotal,
+	}).Error; err != nil {
 		tx.Rollback()
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -654,6 +704,10 @@ func UpdateQuotationTable(c *fiber.Ctx) error {
 
 	tx.Commit()
 
+	if existing.LeadID != nil {
+		touchLeadScore(*existing.LeadID)
+	}
+
 	return c.JSON(fiber.Map{"message": "Quotation updated successfully"})
 }
 
@@ -682,3 +736,66 @@ func GetScpCountBySeriesID(c *fiber.Ctx) error {
 		"max_quotation_scp_count": maxScpCount,
 	})
 }
+
+// ================================
+// Helper: Recalculate Totals
+// Mirrors the quotation screen: taxable = rate*qty - discount,
+// line_total = taxable + tax, header charges/discounts applied on the sum.
+// ================================
+func recalculateQuotationItem(item *models.QuotationTableItems) {
+	gross := item.Rate * item.Quantity
+	if item.DiscountPercentage > 0 {
+		item.DiscountAmount = round2(gross * item.DiscountPercentage / 100)
+	}
+	taxable := gross - item.DiscountAmount
+	item.TaxAmount = round2(taxable * item.Gst / 100)
+	item.LineTotal = round2(taxable + item.TaxAmount)
+}
+
+func recalculateQuotationTotals(q *models.QuotationTable, items []models.QuotationTableItems) {
+	var total, tax float64
+	for _, it := range items {
+		total += it.LineTotal
+		tax += it.TaxAmount
+	}
+
+	percentCharges, fixedCharges := sumAdjustments(q.ExtraCharges)
+	percentDiscounts, fixedDiscounts := sumAdjustments(q.Discounts)
+	computed := total + total*percentCharges/100 + fixedCharges - total*percentDiscounts/100 - fixedDiscounts
+
+	q.TotalAmount = round2(total)
+	q.TaxAmount = round2(tax)
+
+	// Keep the round-off behaviour of the source document: only round when it was rounded before
+	if q.RoundoffAmount != 0 {
+		q.RoundoffAmount = round2(math.Round(computed) - computed)
+		q.GrandTotal = math.Round(computed)
+	} else {
+		q.GrandTotal = round2(computed)
+	}
+}
+
+// sumAdjustments totals a JSON array of {type, value} charges or discounts
+// into percent and fixed parts.
+func sumAdjustments(raw []byte) (percent float64, fixed float64) {
+	if len(raw) == 0 {
+		return 0, 0
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return 0, 0
+	}
+	for _, e := range entries {
+		value := getFloatValue(e["value"])
+		if t, _ := e["type"].(string); t == "percent" {
+			percent += value
+		} else {
+			fixed += value
+		}
+	}
+	return percent, fixed
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
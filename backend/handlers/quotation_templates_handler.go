@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"erp.local/backend/models"
@@ -24,6 +25,47 @@ type TemplateRequest struct {
 	QuotationItems []models.QuotationTableItems `json:"quotation_items"`
 }
 
+// UpdateTemplateRequest defines the structure for updating a quotation template.
+// Quotation and QuotationItems are optional; when items are sent they replace the existing ones.
+type UpdateTemplateRequest struct {
+	TemplateName   *string                      `json:"template_name"`
+	TemplateStatus *string                      `json:"template_status"`
+	Quotation      *models.QuotationTable       `json:"quotation"`
+	QuotationItems []models.QuotationTableItems `json:"quotation_items"`
+}
+
+// TemplateItemOverride overrides values of a single template line when instantiating
+type TemplateItemOverride struct {
+	ItemID             uint     `json:"item_id"`
+	Quantity           *float64 `json:"quantity"`
+	Rate               *float64 `json:"rate"`
+	DiscountPercentage *float64 `json:"discount_percentage"`
+	Remove             bool     `json:"remove"`
+}
+
+// InstantiateTemplateRequest defines the parameters for creating a quotation from a template
+type InstantiateTemplateRequest struct {
+	CustomerID          uint       `json:"customer_id"`
+	BillingAddressID    uint       `json:"billing_address_id"`
+	ShippingAddressID   uint       `json:"shipping_address_id"`
+	SeriesID            *uint      `json:"series_id"`
+	CompanyID           *uint      `json:"company_id"`
+	CompanyBranchID     *uint      `json:"company_branch_id"`
+	CompanyBranchBankID *uint      `json:"company_branch_bank_id"`
+	SalesCreditPersonID *uint      `json:"sales_credit_person_id"`
+	CreatedBy           *uint      `json:"created_by"`
+	QuotationDate       *time.Time `json:"quotation_date"`
+	ValidUntil          *time.Time `json:"valid_until"`
+	ContactPerson       *string    `json:"contact_person"`
+	References          *string    `json:"references"`
+	Note                *string    `json:"note"`
+	Currency            *string    `json:"currency"`
+	ExchangeRate        *float64   `json:"exchange_rate"`
+	// Reprice defaults to true: product lines take the current sales price and GST
+	Reprice       *bool                  `json:"reprice"`
+	ItemOverrides []TemplateItemOverride `json:"item_overrides"`
+}
+
 // CreateQuotationTemplate creates a new quotation template in the database
 func CreateQuotationTemplate(c *fiber.Ctx) error {
 	var req TemplateRequest
@@ -118,3 +160,367 @@ func DeleteQuotationTemplate(c *fiber.Ctx) error {
 	}
 	return c.JSON(fiber.Map{"message": "Template deleted successfully"})
 }
+
+// UpdateQuotationTemplate updates a template's name/status and optionally its quotation and items
+func UpdateQuotationTemplate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req UpdateTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var template models.QutationTemplates
+	if err := quotationTemplatesDB.First(&template, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Template not found"})
+	}
+
+	tx := quotationTemplatesDB.Begin()
+
+	if req.TemplateName != nil {
+		name := strings.TrimSpace(*req.TemplateName)
+		if name == "" {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": "Template name is required"})
+		}
+		template.QutationTemplateName = name
+	}
+	if req.TemplateStatus != nil {
+		template.TemplateStatus = *req.TemplateStatus
+	}
+
+	if err := tx.Save(&template).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update template: " + err.Error()})
+	}
+
+	if req.Quotation != nil {
+		// The template quotation keeps its reference number and draft status
+		req.Quotation.QuotationID = 0
+		req.Quotation.QuotationNumber = ""
+		req.Quotation.Status = ""
+		if err := tx.Model(&models.QuotationTable{QuotationID: template.TemplateQuotationID}).
+			Updates(req.Quotation).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to update template quotation: " + err.Error()})
+		}
+	}
+
+	if req.QuotationItems != nil {
+		if err := tx.Where("quotation_id = ?", template.TemplateQuotationID).
+			Delete(&models.QuotationTableItems{}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to replace template items: " + err.Error()})
+		}
+		for i := range req.QuotationItems {
+			req.QuotationItems[i].ID = 0
+			req.QuotationItems[i].QuotationID = template.TemplateQuotationID
+			recalculateQuotationItem(&req.QuotationItems[i])
+		}
+		if len(req.QuotationItems) > 0 {
+			if err := tx.Create(&req.QuotationItems).Error; err != nil {
+				tx.Rollback()
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to replace template items: " + err.Error()})
+			}
+		}
+	}
+
+	// Totals follow the stored items and charges, as on any other quotation
+	if req.Quotation != nil || req.QuotationItems != nil {
+		var quotation models.QuotationTable
+		if err := tx.Preload("QuotationTableItems").First(&quotation, template.TemplateQuotationID).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to load template quotation: " + err.Error()})
+		}
+		recalculateQuotationTotals(&quotation, quotation.QuotationTableItems)
+		if err := resolveQuotationExchangeRate(tx, &quotation); err != nil {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		applyBaseCurrencyTotals(&quotation)
+		if err := tx.Model(&models.QuotationTable{QuotationID: quotation.QuotationID}).Updates(map[string]interface{}{
+			"total_amount":      quotation.TotalAmount,
+			"tax_amount":        quotation.TaxAmount,
+			"roundoff_amount":   quotation.RoundoffAmount,
+			"grand_total":       quotation.GrandTotal,
+			"currency":          quotation.Currency,
+			"exchange_rate":     quotation.ExchangeRate,
+			"base_total_amount": quotation.BaseTotalAmount,
+			"base_tax_amount":   quotation.BaseTaxAmount,
+			"base_grand_total":  quotation.BaseGrandTotal,
+		}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to update template totals: " + err.Error()})
+		}
+	}
+
+	tx.Commit()
+
+	quotationTemplatesDB.
+		Preload("QuotationTable.QuotationTableItems").
+		Preload("QuotationTable.Customer").
+		Preload("QuotationTable.BillingAddress").
+		Preload("QuotationTable.ShippingAddress").
+		First(&template, template.ID)
+
+	return c.JSON(fiber.Map{
+		"message":  "Template updated successfully",
+		"template": template,
+	})
+}
+
+// InstantiateQuotationTemplate creates a new quotation from a template for the given customer.
+// Header and items are deep-copied; product lines are re-priced to current rates and
+// inactive products are skipped.
+func InstantiateQuotationTemplate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req InstantiateTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.CustomerID == 0 || req.BillingAddressID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "customer_id and billing_address_id are required"})
+	}
+	if req.ShippingAddressID == 0 {
+		req.ShippingAddressID = req.BillingAddressID
+	}
+
+	var template models.QutationTemplates
+	if err := quotationTemplatesDB.
+		Preload("QuotationTable.QuotationTableItems").
+		First(&template, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Template not found"})
+	}
+	if strings.EqualFold(template.TemplateStatus, "inactive") {
+		return c.Status(400).JSON(fiber.Map{"error": "Template is inactive"})
+	}
+
+	// Validate customer and that both addresses belong to the customer
+	var customer models.User
+	if err := quotationTemplatesDB.First(&customer, req.CustomerID).Error; err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid customer_id"})
+	}
+	for _, addrID := range []uint{req.BillingAddressID, req.ShippingAddressID} {
+		var addr models.UserAddress
+		if err := quotationTemplatesDB.First(&addr, addrID).Error; err != nil || addr.UserID != req.CustomerID {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Address %d does not belong to the customer", addrID)})
+		}
+	}
+
+	src := template.QuotationTable
+
+	// Deep copy of the header; identity, numbering and audit fields are reset
+	quotation := src
+	quotation.QuotationID = 0
+	quotation.QuotationNumber = ""
+	quotation.QuotationTableItems = nil
+	quotation.Series = nil
+	quotation.CompanyBranch = models.CompanyBranch{}
+	quotation.CompanyBranchBank = nil
+	quotation.Customer = models.User{}
+	quotation.SalesCreditPerson = models.User{}
+	quotation.BillingAddress = models.UserAddress{}
+	quotation.ShippingAddress = models.UserAddress{}
+	quotation.CreatedAt = time.Time{}
+	quotation.UpdatedAt = time.Time{}
+	quotation.Revised = nil
+	quotation.RevisedNo = nil
+	quotation.AttachmentPath = nil
+	quotation.Status = models.Qt_Open
+
+	quotation.CustomerID = req.CustomerID
+	quotation.BillingAddressID = req.BillingAddressID
+	quotation.ShippingAddressID = req.ShippingAddressID
+	quotation.QuotationDate = time.Now()
+
+	if req.SeriesID != nil {
+		quotation.SeriesID = req.SeriesID
+	}
+	if req.CompanyID != nil {
+		quotation.CompanyID = *req.CompanyID
+	}
+	if req.CompanyBranchID != nil {
+		quotation.CompanyBranchID = *req.CompanyBranchID
+	}
+	if req.CompanyBranchBankID != nil {
+		quotation.CompanyBranchBankID = req.CompanyBranchBankID
+	}
+	if req.SalesCreditPersonID != nil {
+		quotation.SalesCreditPersonID = *req.SalesCreditPersonID
+	}
+	if req.CreatedBy != nil {
+		quotation.CreatedBy = *req.CreatedBy
+	}
+	if req.QuotationDate != nil {
+		quotation.QuotationDate = *req.QuotationDate
+	}
+	if req.ValidUntil != nil {
+		quotation.ValidUntil = req.ValidUntil
+	} else if src.ValidUntil != nil {
+		// Keep the template's validity period relative to the new quotation date
+		validity := src.ValidUntil.Sub(src.QuotationDate)
+		if validity > 0 {
+			validUntil := quotation.QuotationDate.Add(validity)
+			quotation.ValidUntil = &validUntil
+		}
+	}
+	if req.ContactPerson != nil {
+		quotation.ContactPerson = req.ContactPerson
+	}
+	if req.References != nil {
+		quotation.References = req.References
+	}
+	if req.Note != nil {
+		quotation.Note = req.Note
+	}
+	if req.Currency != nil {
+		quotation.Currency = req.Currency
+		quotation.ExchangeRate = req.ExchangeRate
+	} else if req.ExchangeRate != nil {
+		quotation.ExchangeRate = req.ExchangeRate
+	} else {
+		// Take the rate for the new quotation date, not the template's
+		quotation.ExchangeRate = nil
+	}
+	if err := resolveQuotationExchangeRate(quotationTemplatesDB, &quotation); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	overrides := make(map[uint]TemplateItemOverride, len(req.ItemOverrides))
+	for _, o := range req.ItemOverrides {
+		overrides[o.ItemID] = o
+	}
+	reprice := req.Reprice == nil || *req.Reprice
+
+	var items []models.QuotationTableItems
+	var skipped []fiber.Map
+	for _, srcItem := range src.QuotationTableItems {
+		override, hasOverride := overrides[srcItem.ID]
+		if hasOverride && override.Remove {
+			continue
+		}
+
+		item := srcItem
+		item.ID = 0
+		item.QuotationID = 0
+		item.Product = nil
+
+		if item.ProductID != nil && !item.IsService {
+			var product models.Product
+			if err := quotationTemplatesDB.Preload("Variants").Preload("Tax").First(&product, *item.ProductID).Error; err != nil {
+				skipped = append(skipped, fiber.Map{"item_id": srcItem.ID, "product_id": *item.ProductID, "reason": "product not found"})
+				continue
+			}
+			if !product.IsActive {
+				skipped = append(skipped, fiber.Map{"item_id": srcItem.ID, "product_id": product.ID, "reason": "product inactive"})
+				continue
+			}
+			if reprice {
+				if rate, ok := currentSalesRate(&product, item.ProductCode); ok {
+					// Sales prices are kept in INR
+					item.Rate = round2(rate / *quotation.ExchangeRate)
+				}
+				if product.GstPercent > 0 {
+					item.Gst = product.GstPercent
+				} else if product.Tax.Percentage > 0 {
+					item.Gst = product.Tax.Percentage
+				}
+			}
+		}
+
+		if hasOverride {
+			if override.Quantity != nil {
+				item.Quantity = *override.Quantity
+			}
+			if override.Rate != nil {
+				item.Rate = *override.Rate
+			}
+			if override.DiscountPercentage != nil {
+				item.DiscountPercentage = *override.DiscountPercentage
+				if item.DiscountPercentage == 0 {
+					item.DiscountAmount = 0
+				}
+			}
+		}
+
+		recalculateQuotationItem(&item)
+		items = append(items, item)
+	}
+
+	if len(items) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "No active items left in template", "skipped_items": skipped})
+	}
+
+	recalculateQuotationTotals(&quotation, items)
+	applyBaseCurrencyTotals(&quotation)
+
+	tx := quotationTemplatesDB.Begin()
+
+	series, err := resolveQuotationSeries(tx, &quotation)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	quotation.SeriesID = &series.ID
+
+	quotationNo, err := nextSeriesNumber(tx, &series, quotation.QuotationDate, quotation.CompanyBranchID, quotation.DocumentType)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	quotation.QuotationNumber = quotationNo
+
+	if quotation.SalesCreditPersonID != 0 {
+		var maxCount uint
+		if err := tx.Model(&models.QuotationTable{}).
+			Where("sales_credit_person_id = ?", quotation.SalesCreditPersonID).
+			Select("COALESCE(MAX(quotation_scp_count), 0)").
+			Scan(&maxCount).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		quotation.QuotationScpCount = maxCount + 1
+	}
+
+	if err := tx.Create(&quotation).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create quotation: " + err.Error()})
+	}
+
+	for i := range items {
+		items[i].QuotationID = quotation.QuotationID
+	}
+	if err := tx.Create(&items).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create quotation items: " + err.Error()})
+	}
+
+	tx.Commit()
+
+	return c.Status(201).JSON(fiber.Map{
+		"quotation":       quotation,
+		"quotation_items": items,
+		"skipped_items":   skipped,
+	})
+}
+
+// currentSalesRate returns the current sales price of a product, preferring the
+// variant whose SKU matches the line's product code, then the first active variant.
+func currentSalesRate(product *models.Product, productCode string) (float64, bool) {
+	code := strings.TrimSpace(productCode)
+	if code != "" {
+		for _, v := range product.Variants {
+			if v.IsActive && strings.EqualFold(v.SKU, code) && v.StdSalesPrice > 0 {
+				return v.StdSalesPrice, true
+			}
+		}
+	}
+	for _, v := range product.Variants {
+		if v.IsActive && v.StdSalesPrice > 0 {
+			return v.StdSalesPrice, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,401 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var reportsDB *gorm.DB
+
+func SetReportsDB(db *gorm.DB) {
+	reportsDB = db
+}
+
+/* ========== QUOTATION REPORT ========== */
+
+type quotationReportRow struct {
+	Key               string   `json:"key"`
+	Label             string   `json:"label"`
+	Count             int64    `json:"count"`
+	GrandTotal        float64  `json:"grand_total"`
+	Confirmed         int64    `json:"confirmed"`
+	ConfirmedValue    float64  `json:"confirmed_value"`
+	Lost              int64    `json:"lost"`
+	ConversionRate    float64  `json:"conversion_rate"`
+	WinRate           float64  `json:"win_rate"`
+	AvgHoursToConfirm *float64 `json:"avg_hours_to_confirm"`
+}
+
+type lostReasonRow struct {
+	RejectionReasonID *uint   `json:"rejection_reason_id"`
+	Title             string  `json:"title"`
+	Count             int64   `json:"count"`
+	GrandTotal        float64 `json:"grand_total"`
+}
+
+// quotationReportGroups maps a group name to its key/label expressions and joins
+var quotationReportGroups = map[string]struct {
+	Key   string
+	Label string
+	Join  string
+}{
+	"status": {Key: "LOWER(q.status)", Label: "LOWER(q.status)"},
+	"sales_credit_person": {
+		Key:   "CAST(q.sales_credit_person_id AS TEXT)",
+		Label: "COALESCE(NULLIF(TRIM(CONCAT(scp.firstname, ' ', scp.lastname)), ''), 'Unassigned')",
+		Join:  "LEFT JOIN users scp ON scp.id = q.sales_credit_person_id",
+	},
+	"branch": {
+		Key:   "CAST(q.company_branch_id AS TEXT)",
+		Label: "COALESCE(b.name, '')",
+		Join:  "LEFT JOIN company_branches b ON b.id = q.company_branch_id",
+	},
+	"customer": {
+		Key:   "CAST(q.customer_id AS TEXT)",
+		Label: "COALESCE(NULLIF(cu.company_name, ''), NULLIF(cu.business_name, ''), TRIM(CONCAT(cu.firstname, ' ', cu.lastname)))",
+		Join:  "LEFT JOIN users cu ON cu.id = q.customer_id",
+	},
+	"month": {Key: "TO_CHAR(q.quotation_date, 'YYYY-MM')", Label: "TO_CHAR(q.quotation_date, 'Mon YYYY')"},
+	"week": {
+		Key:   "TO_CHAR(DATE_TRUNC('week', q.quotation_date), 'IYYY-\"W\"IW')",
+		Label: "TO_CHAR(DATE_TRUNC('week', q.quotation_date), 'DD Mon YYYY')",
+	},
+}
+
+// Values are summed in INR (base_grand_total), as quotations may be in other currencies
+const quotationReportMetrics = `
+	COUNT(*) AS count,
+	COALESCE(SUM(q.base_grand_total), 0) AS grand_total,
+	COUNT(*) FILTER (WHERE LOWER(q.status) = 'confirmed') AS confirmed,
+	COALESCE(SUM(q.base_grand_total) FILTER (WHERE LOWER(q.status) = 'confirmed'), 0) AS confirmed_value,
+	COUNT(*) FILTER (WHERE LOWER(q.status) = 'cancelled') AS lost,
+	AVG(EXTRACT(EPOCH FROM (q.confirmed_at - q.created_at)) / 3600) FILTER (WHERE q.confirmed_at IS NOT NULL) AS avg_hours_to_confirm`
+
+// quotationReportBase applies the report filters on quotation_tables aliased as q.
+// Quotations saved as templates are excluded.
+func quotationReportBase(c *fiber.Ctx) (*gorm.DB, error) {
+	query := reportsDB.Table("quotation_tables q").
+		Where("q.quotation_id NOT IN (SELECT template_quotation_id FROM qutation_templates)")
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return nil, fiber.NewError(400, "from must be YYYY-MM-DD")
+		}
+		query = query.Where("q.quotation_date >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return nil, fiber.NewError(400, "to must be YYYY-MM-DD")
+		}
+		query = query.Where("q.quotation_date < ?", t.AddDate(0, 0, 1))
+	}
+	if v := c.QueryInt("company_id", 0); v != 0 {
+		query = query.Where("q.company_id = ?", v)
+	}
+	if v := c.QueryInt("company_branch_id", 0); v != 0 {
+		query = query.Where("q.company_branch_id = ?", v)
+	}
+	if v := c.QueryInt("sales_credit_person_id", 0); v != 0 {
+		query = query.Where("q.sales_credit_person_id = ?", v)
+	}
+	if v := c.QueryInt("customer_id", 0); v != 0 {
+		query = query.Where("q.customer_id = ?", v)
+	}
+	if v := c.Query("document_type"); v != "" {
+		query = query.Where("q.document_type = ?", v)
+	}
+	return query, nil
+}
+
+// finishQuotationRow derives the rates of an aggregated row
+func finishQuotationRow(r *quotationReportRow) {
+	if r.Count > 0 {
+		r.ConversionRate = round2(float64(r.Confirmed) * 100 / float64(r.Count))
+	}
+	if decided := r.Confirmed + r.Lost; decided > 0 {
+		r.WinRate = round2(float64(r.Confirmed) * 100 / float64(decided))
+	}
+	if r.AvgHoursToConfirm != nil {
+		v := round2(*r.AvgHoursToConfirm)
+		r.AvgHoursToConfirm = &v
+	}
+}
+
+// GetQuotationReport aggregates quotations into a pipeline and win/loss view.
+// Query: from, to (YYYY-MM-DD on quotation_date), company_id, company_branch_id,
+// sales_credit_person_id, customer_id, document_type,
+// group_by (comma separated: status, sales_credit_person, branch, customer, month, week; default all)
+func GetQuotationReport(c *fiber.Ctx) error {
+	groups := []string{"status", "sales_credit_person", "branch", "customer", "month", "week"}
+	if g := c.Query("group_by"); g != "" {
+		groups = nil
+		for _, name := range strings.Split(g, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := quotationReportGroups[name]; !ok {
+				return c.Status(400).JSON(fiber.Map{"error": "Unknown group_by: " + name})
+			}
+			groups = append(groups, name)
+		}
+	}
+
+	base, err := quotationReportBase(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var summary quotationReportRow
+	if err := base.Session(&gorm.Session{}).
+		Select("'all' AS key, 'All quotations' AS label, " + quotationReportMetrics).
+		Scan(&summary).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	finishQuotationRow(&summary)
+
+	resp := fiber.Map{"summary": summary}
+
+	for _, name := range groups {
+		g := quotationReportGroups[name]
+		query := base.Session(&gorm.Session{})
+		if g.Join != "" {
+			query = query.Joins(g.Join)
+		}
+
+		order := "grand_total DESC"
+		if name == "month" || name == "week" {
+			order = "key ASC"
+		}
+
+		var rows []quotationReportRow
+		if err := query.
+			Select(g.Key + " AS key, " + g.Label + " AS label, " + quotationReportMetrics).
+			Group(g.Key + ", " + g.Label).
+			Order(order).
+			Scan(&rows).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		for i := range rows {
+			finishQuotationRow(&rows[i])
+		}
+		resp["by_"+name] = rows
+	}
+
+	// Open pipeline: quotations still awaiting a decision
+	var pipeline quotationReportRow
+	if err := base.Session(&gorm.Session{}).
+		Where("LOWER(q.status) IN ?", []string{string(models.Qt_Draft), strings.ToLower(string(models.Qt_Open)), string(models.Qt_Sent)}).
+		Select("'open' AS key, 'Open pipeline' AS label, " + quotationReportMetrics).
+		Scan(&pipeline).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	resp["open_pipeline"] = pipeline
+
+	var lostReasons []lostReasonRow
+	if err := base.Session(&gorm.Session{}).
+		Joins("LEFT JOIN rejection_reasons rr ON rr.id = q.rejection_reason_id").
+		Where("LOWER(q.status) = ?", string(models.Qt_Cancelled)).
+		Select("q.rejection_reason_id, COALESCE(rr.title, 'Unspecified') AS title, COUNT(*) AS count, COALESCE(SUM(q.base_grand_total), 0) AS grand_total").
+		Group("q.rejection_reason_id, rr.title").
+		Order("count DESC").
+		Limit(c.QueryInt("top", 10)).
+		Scan(&lostReasons).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	resp["top_lost_reasons"] = lostReasons
+
+	return c.JSON(resp)
+}
+
+/* ========== LEAD SOURCE REPORT ========== */
+
+type leadSourceReportRow struct {
+	Source               string   `json:"source"`
+	Month                string   `json:"month,omitempty"`
+	Leads                int64    `json:"leads"`
+	Contacted            int64    `json:"contacted"`
+	Quoted               int64    `json:"quoted"`
+	Converted            int64    `json:"converted"`
+	ConversionRate       float64  `json:"conversion_rate"`
+	AvgHoursToFirstTouch *float64 `json:"avg_hours_to_first_interaction"`
+	ConfirmedQuotations  int64    `json:"confirmed_quotations"`
+	Revenue              float64  `json:"revenue"`
+	RevenuePerLead       float64  `json:"revenue_per_lead"`
+
+	// Sum and count behind the average, so months can be rolled up per source
+	HoursSum   float64 `json:"-"`
+	HoursCount int64   `json:"-"`
+}
+
+const (
+	// Date a lead came in: the enquiry date when imported with one, else when it was created
+	leadReportDate  = "CASE WHEN l.since > '1900-01-01' THEN l.since ELSE l.created_at END"
+	leadReportLabel = "COALESCE(NULLIF(TRIM(l.source), ''), 'Unknown')"
+)
+
+// Per lead: first interaction and its quotations, either opened from the lead or, for a
+// converted lead, raised for its customer without a lead. A customer with several converted
+// leads credits such quotations to the latest one only, so no value is counted twice.
+// Revenue is in INR (base_grand_total).
+const leadSourceReportJoins = `
+	LEFT JOIN (SELECT lead_id, MIN("timestamp") AS first_at FROM lead_interactions GROUP BY lead_id) fi ON fi.lead_id = l.id
+	LEFT JOIN LATERAL (
+		SELECT COUNT(*) AS quotations,
+			COUNT(*) FILTER (WHERE LOWER(q.status) = 'confirmed') AS confirmed,
+			COALESCE(SUM(q.base_grand_total) FILTER (WHERE LOWER(q.status) = 'confirmed'), 0) AS confirmed_value
+		FROM quotation_tables q
+		WHERE (q.lead_id = l.id OR (q.lead_id IS NULL AND l.customer_id IS NOT NULL AND q.customer_id = l.customer_id
+				AND l.id = (SELECT cl.id FROM leads cl WHERE cl.customer_id = l.customer_id
+					ORDER BY cl.converted_at DESC NULLS LAST, cl.id DESC LIMIT 1)))
+			AND q.quotation_id NOT IN (SELECT template_quotation_id FROM qutation_templates)
+	) qv ON true`
+
+const leadSourceReportMetrics = `
+	COUNT(*) AS leads,
+	COUNT(*) FILTER (WHERE fi.first_at IS NOT NULL) AS contacted,
+	COUNT(*) FILTER (WHERE qv.quotations > 0) AS quoted,
+	COUNT(*) FILTER (WHERE l.customer_id IS NOT NULL) AS converted,
+	COALESCE(SUM(EXTRACT(EPOCH FROM (fi.first_at - l.created_at)) / 3600) FILTER (WHERE fi.first_at >= l.created_at), 0) AS hours_sum,
+	COUNT(*) FILTER (WHERE fi.first_at >= l.created_at) AS hours_count,
+	COALESCE(SUM(qv.confirmed), 0) AS confirmed_quotations,
+	COALESCE(SUM(qv.confirmed_value), 0) AS revenue`
+
+// finishLeadSourceRow derives the rates of an aggregated row
+func finishLeadSourceRow(r *leadSourceReportRow) {
+	if r.Leads > 0 {
+		r.ConversionRate = round2(float64(r.Converted) * 100 / float64(r.Leads))
+		r.RevenuePerLead = round2(r.Revenue / float64(r.Leads))
+	}
+	if r.HoursCount > 0 {
+		v := round2(r.HoursSum / float64(r.HoursCount))
+		r.AvgHoursToFirstTouch = &v
+	}
+	r.Revenue = round2(r.Revenue)
+}
+
+// GetLeadSourceReport shows how each lead source performs: leads, how many were contacted,
+// quoted and converted, the average time to the first interaction and the confirmed quotation
+// value they brought, per source and per source and month (of the lead's enquiry date).
+// Query: from, to (YYYY-MM-DD), source, format=csv
+func GetLeadSourceReport(c *fiber.Ctx) error {
+	query := reportsDB.Table("leads l").Joins(leadSourceReportJoins)
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, istLocation)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "from must be YYYY-MM-DD"})
+		}
+		query = query.Where(leadReportDate+" >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, istLocation)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "to must be YYYY-MM-DD"})
+		}
+		query = query.Where(leadReportDate+" < ?", t.AddDate(0, 0, 1))
+	}
+	if source := c.Query("source"); source != "" {
+		query = query.Where("LOWER("+leadReportLabel+") = LOWER(?)", source)
+	}
+
+	month := "TO_CHAR(" + leadReportDate + " AT TIME ZONE 'Asia/Kolkata', 'YYYY-MM')"
+	var monthly []leadSourceReportRow
+	if err := query.
+		Select(leadReportLabel + " AS source, " + month + " AS month, " + leadSourceReportMetrics).
+		Group(leadReportLabel + ", " + month).
+		Order("source ASC, month ASC").
+		Scan(&monthly).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Roll months up per source
+	var sources []leadSourceReportRow
+	index := map[string]int{}
+	for i := range monthly {
+		m := monthly[i]
+		finishLeadSourceRow(&monthly[i])
+
+		at, ok := index[m.Source]
+		if !ok {
+			at = len(sources)
+			index[m.Source] = at
+			sources = append(sources, leadSourceReportRow{Source: m.Source})
+		}
+		s := &sources[at]
+		s.Leads += m.Leads
+		s.Contacted += m.Contacted
+		s.Quoted += m.Quoted
+		s.Converted += m.Converted
+		s.ConfirmedQuotations += m.ConfirmedQuotations
+		s.Revenue += m.Revenue
+		s.HoursSum += m.HoursSum
+		s.HoursCount += m.HoursCount
+	}
+	total := leadSourceReportRow{Source: "All sources"}
+	for i := range sources {
+		s := sources[i]
+		total.Leads += s.Leads
+		total.Contacted += s.Contacted
+		total.Quoted += s.Quoted
+		total.Converted += s.Converted
+		total.ConfirmedQuotations += s.ConfirmedQuotations
+		total.Revenue += s.Revenue
+		total.HoursSum += s.HoursSum
+		total.HoursCount += s.HoursCount
+		finishLeadSourceRow(&sources[i])
+	}
+	finishLeadSourceRow(&total)
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].Revenue > sources[j].Revenue })
+
+	if c.Query("format") == "csv" {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write([]string{"Source", "Month", "Leads", "Contacted", "Quoted", "Converted", "Conversion %",
+			"Avg hours to first interaction", "Confirmed quotations", "Revenue", "Revenue per lead"})
+		line := func(r leadSourceReportRow, month string) {
+			avg := ""
+			if r.AvgHoursToFirstTouch != nil {
+				avg = strconv.FormatFloat(*r.AvgHoursToFirstTouch, 'f', 2, 64)
+			}
+			_ = w.Write([]string{
+				r.Source, month,
+				strconv.FormatInt(r.Leads, 10),
+				strconv.FormatInt(r.Contacted, 10),
+				strconv.FormatInt(r.Quoted, 10),
+				strconv.FormatInt(r.Converted, 10),
+				strconv.FormatFloat(r.ConversionRate, 'f', 2, 64),
+				avg,
+				strconv.FormatInt(r.ConfirmedQuotations, 10),
+				strconv.FormatFloat(r.Revenue, 'f', 2, 64),
+				strconv.FormatFloat(r.RevenuePerLead, 'f', 2, 64),
+			})
+		}
+		for _, r := range monthly {
+			line(r, r.Month)
+		}
+		for _, r := range sources {
+			line(r, "All")
+		}
+		line(total, "All")
+		w.Flush()
+
+		c.Set("Content-Type", "text/csv; charset=utf-8")
+		c.Set("Content-Disposition", "attachment; filename=\"lead-source-report.csv\"")
+		return c.Send(buf.Bytes())
+	}
+
+	return c.JSON(fiber.Map{
+		"summary":   total,
+		"by_source": sources,
+		"monthly":   monthly,
+	})
+}
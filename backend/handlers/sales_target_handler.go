@@ -0,0 +1,404 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var salesTargetDB *gorm.DB
+
+func SetSalesTargetDB(db *gorm.DB) {
+	salesTargetDB = db
+}
+
+/* ========== DTOs ========== */
+
+type CreateSalesTargetRequest struct {
+	Month          string  `json:"month"` // YYYY-MM
+	UserID         *uint   `json:"user_id"`
+	TerritoryID    *uint   `json:"territory_id"`
+	TargetValue    float64 `json:"target_value"`
+	TargetQuantity float64 `json:"target_quantity"`
+	Notes          string  `json:"notes"`
+	CreatedByID    *uint   `json:"created_by_id"`
+}
+
+type UpdateSalesTargetRequest struct {
+	TargetValue    *float64 `json:"target_value"`
+	TargetQuantity *float64 `json:"target_quantity"`
+	Notes          *string  `json:"notes"`
+}
+
+type salesAchievementRow struct {
+	TargetID       uint    `json:"target_id"`
+	Month          string  `json:"month"`
+	UserID         *uint   `json:"user_id,omitempty"`
+	UserName       string  `json:"user_name,omitempty"`
+	TerritoryID    *uint   `json:"territory_id,omitempty"`
+	TerritoryName  string  `json:"territory_name,omitempty"`
+	TargetValue    float64 `json:"target_value"`
+	TargetQuantity float64 `json:"target_quantity"`
+
+	// Confirmed quotations credited to the user and everyone reporting to them
+	AchievedValue    float64 `json:"achieved_value"`
+	AchievedQuantity float64 `json:"achieved_quantity"`
+	Quotations       int     `json:"quotations"`
+
+	// The user's own share of the above
+	OwnValue    float64 `json:"own_value"`
+	OwnQuantity float64 `json:"own_quantity"`
+	TeamSize    int     `json:"team_size"`
+
+	ValuePercent    *float64 `json:"value_percent"`
+	QuantityPercent *float64 `json:"quantity_percent"`
+}
+
+// salesCredit is a confirmed quotation counted against targets
+type salesCredit struct {
+	QuotationID         uint
+	SalesCreditPersonID uint
+	GrandTotal          float64
+	Quantity            float64
+	State               string
+	City                string
+	TerritoryID         *uint `gorm:"-"`
+}
+
+/* ========== HELPERS ========== */
+
+// parseSalesMonth reads YYYY-MM and returns the month's bounds in IST
+func parseSalesMonth(month string) (time.Time, time.Time, error) {
+	t, err := time.ParseInLocation("2006-01", strings.TrimSpace(month), istLocation)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return t, t.AddDate(0, 1, 0), nil
+}
+
+// salesCredits loads the quotations confirmed in [from, to) with their INR grand total, item
+// quantity and billing place, and places each in a territory. Quotations confirmed before confirmed_at
+// was tracked fall back to their quotation date.
+func salesCredits(db *gorm.DB, from, to time.Time) ([]salesCredit, error) {
+	var credits []salesCredit
+	err := db.Table("quotation_tables q").
+		Select(`q.quotation_id, q.sales_credit_person_id, q.base_grand_total AS grand_total,
+			COALESCE((SELECT SUM(i.quantity) FROM quotation_table_items i WHERE i.quotation_id = q.quotation_id), 0) AS quantity,
+			COALESCE(a.state, '') AS state, COALESCE(a.city, '') AS city`).
+		Joins("LEFT JOIN user_addresses a ON a.id = q.billing_address_id").
+		Where("LOWER(q.status) = ?", string(models.Qt_Confirmed)).
+		Where("q.quotation_id NOT IN (SELECT template_quotation_id FROM qutation_templates)").
+		Where("COALESCE(q.confirmed_at, q.quotation_date) >= ? AND COALESCE(q.confirmed_at, q.quotation_date) < ?", from, to).
+		Scan(&credits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	territories, err := loadSalesTerritoryResolver(db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range credits {
+		credits[i].TerritoryID = territories.Territory(credits[i].State, credits[i].City)
+	}
+	return credits, nil
+}
+
+// salesReportingTree maps each manager's user ID to the user IDs reporting directly to them,
+// from the employee hierarchy. Employees who have left stay in, as their sales still count.
+func salesReportingTree(db *gorm.DB) (map[uint][]uint, error) {
+	var links []struct {
+		ManagerUserID  uint
+		EmployeeUserID uint
+	}
+	if err := db.Table("employee_hierarchies AS h").
+		Joins("JOIN employees e ON e.id = h.employee_id").
+		Joins("JOIN employees m ON m.id = h.manager_id").
+		Where("e.user_id <> 0 AND m.user_id <> 0 AND e.user_id <> m.user_id").
+		Select("DISTINCT m.user_id AS manager_user_id, e.user_id AS employee_user_id").
+		Scan(&links).Error; err != nil {
+		return nil, err
+	}
+	tree := map[uint][]uint{}
+	for _, l := range links {
+		tree[l.ManagerUserID] = append(tree[l.ManagerUserID], l.EmployeeUserID)
+	}
+	return tree, nil
+}
+
+// salesTeam is the user and everyone below them in the tree
+func salesTeam(tree map[uint][]uint, userID uint) map[uint]bool {
+	team := map[uint]bool{userID: true}
+	queue := []uint{userID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, report := range tree[id] {
+			if !team[report] {
+				team[report] = true
+				queue = append(queue, report)
+			}
+		}
+	}
+	return team
+}
+
+func salesPercent(achieved, target float64) *float64 {
+	if target <= 0 {
+		return nil
+	}
+	v := round2(achieved * 100 / target)
+	return &v
+}
+
+/* ========== HANDLERS ========== */
+
+// CreateSalesTarget sets a month's target for a user, a territory, or a user within a territory
+func CreateSalesTarget(c *fiber.Ctx) error {
+	var body CreateSalesTargetRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	start, _, err := parseSalesMonth(body.Month)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+	if body.UserID == nil && body.TerritoryID == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "user_id or territory_id is required"})
+	}
+	if body.TargetValue < 0 || body.TargetQuantity < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Targets cannot be negative"})
+	}
+
+	if body.UserID != nil {
+		var user models.User
+		if err := salesTargetDB.Select("id").First(&user, *body.UserID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(400).JSON(fiber.Map{"error": "User not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if body.TerritoryID != nil {
+		var territory models.SalesTerritory
+		if err := salesTargetDB.First(&territory, *body.TerritoryID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(400).JSON(fiber.Map{"error": "Territory not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	target := models.SalesTarget{
+		Month:          start.Format("2006-01"),
+		UserID:         body.UserID,
+		TerritoryID:    body.TerritoryID,
+		TargetValue:    body.TargetValue,
+		TargetQuantity: body.TargetQuantity,
+		Notes:          body.Notes,
+		CreatedByID:    body.CreatedByID,
+	}
+
+	// One target per user/territory/month; NULLs would slip past a unique index
+	dup := salesTargetDB.Model(&models.SalesTarget{}).Where("month = ?", target.Month)
+	if target.UserID != nil {
+		dup = dup.Where("user_id = ?", *target.UserID)
+	} else {
+		dup = dup.Where("user_id IS NULL")
+	}
+	if target.TerritoryID != nil {
+		dup = dup.Where("territory_id = ?", *target.TerritoryID)
+	} else {
+		dup = dup.Where("territory_id IS NULL")
+	}
+	var existing int64
+	if err := dup.Count(&existing).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if existing > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "A target for this month already exists"})
+	}
+
+	if err := salesTargetDB.Create(&target).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(target)
+}
+
+// GetSalesTargets lists targets. Query: month (YYYY-MM), user_id, territory_id
+func GetSalesTargets(c *fiber.Ctx) error {
+	var targets []models.SalesTarget
+
+	query := salesTargetDB.Preload("User").Preload("Territory").Order("month desc, id asc")
+
+	if month := c.Query("month"); month != "" {
+		query = query.Where("month = ?", month)
+	}
+	if userID := c.QueryInt("user_id", 0); userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if territoryID := c.QueryInt("territory_id", 0); territoryID > 0 {
+		query = query.Where("territory_id = ?", territoryID)
+	}
+
+	if err := query.Find(&targets).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(targets)
+}
+
+func GetSalesTarget(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var target models.SalesTarget
+
+	if err := salesTargetDB.Preload("User").Preload("Territory").First(&target, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Target not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(target)
+}
+
+func UpdateSalesTarget(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body UpdateSalesTargetRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var target models.SalesTarget
+	if err := salesTargetDB.First(&target, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Target not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if body.TargetValue != nil {
+		target.TargetValue = *body.TargetValue
+	}
+	if body.TargetQuantity != nil {
+		target.TargetQuantity = *body.TargetQuantity
+	}
+	if body.Notes != nil {
+		target.Notes = *body.Notes
+	}
+	if target.TargetValue < 0 || target.TargetQuantity < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Targets cannot be negative"})
+	}
+
+	if err := salesTargetDB.Omit("User", "Territory").Save(&target).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(target)
+}
+
+func DeleteSalesTarget(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	if err := salesTargetDB.Delete(&models.SalesTarget{}, id).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Target deleted successfully"})
+}
+
+// GetSalesAchievement compares a month's targets with the INR grand total and item quantity of
+// quotations confirmed in that month (IST), credited by sales_credit_person_id. A user target
+// counts the user's own quotations plus those of everyone below them in the employee
+// hierarchy; a territory target counts quotations billed to the territory's states and cities.
+// Query: month (YYYY-MM, default this month), user_id, territory_id
+func GetSalesAchievement(c *fiber.Ctx) error {
+	month := c.Query("month", time.Now().In(istLocation).Format("2006-01"))
+	from, to, err := parseSalesMonth(month)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+	month = from.Format("2006-01")
+
+	query := salesTargetDB.Preload("User").Preload("Territory").Where("month = ?", month).Order("id asc")
+	if userID := c.QueryInt("user_id", 0); userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if territoryID := c.QueryInt("territory_id", 0); territoryID > 0 {
+		query = query.Where("territory_id = ?", territoryID)
+	}
+	var targets []models.SalesTarget
+	if err := query.Find(&targets).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	credits, err := salesCredits(salesTargetDB, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	tree, err := salesReportingTree(salesTargetDB)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rows := make([]salesAchievementRow, 0, len(targets))
+	for _, t := range targets {
+		row := salesAchievementRow{
+			TargetID:       t.ID,
+			Month:          t.Month,
+			UserID:         t.UserID,
+			TerritoryID:    t.TerritoryID,
+			TargetValue:    t.TargetValue,
+			TargetQuantity: t.TargetQuantity,
+		}
+		if t.User != nil {
+			row.UserName = strings.TrimSpace(t.User.Firstname + " " + t.User.Lastname)
+		}
+		if t.Territory != nil {
+			row.TerritoryName = t.Territory.Name
+		}
+
+		var team map[uint]bool
+		if t.UserID != nil {
+			team = salesTeam(tree, *t.UserID)
+			row.TeamSize = len(team)
+		}
+
+		for _, q := range credits {
+			if t.TerritoryID != nil && (q.TerritoryID == nil || *q.TerritoryID != *t.TerritoryID) {
+				continue
+			}
+			if team != nil && !team[q.SalesCreditPersonID] {
+				continue
+			}
+			row.AchievedValue += q.GrandTotal
+			row.AchievedQuantity += q.Quantity
+			row.Quotations++
+			if t.UserID != nil && q.SalesCreditPersonID == *t.UserID {
+				row.OwnValue += q.GrandTotal
+				row.OwnQuantity += q.Quantity
+			}
+		}
+
+		row.AchievedValue = round2(row.AchievedValue)
+		row.AchievedQuantity = round2(row.AchievedQuantity)
+		row.OwnValue = round2(row.OwnValue)
+		row.OwnQuantity = round2(row.OwnQuantity)
+		row.ValuePercent = salesPercent(row.AchievedValue, row.TargetValue)
+		row.QuantityPercent = salesPercent(row.AchievedQuantity, row.TargetQuantity)
+		rows = append(rows, row)
+	}
+
+	return c.JSON(fiber.Map{
+		"month": month,
+		"from":  from,
+		"to":    to,
+		"data":  rows,
+	})
+}
@@ -0,0 +1,336 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var salesTerritoryDB *gorm.DB
+
+func SetSalesTerritoryDB(db *gorm.DB) {
+	salesTerritoryDB = db
+}
+
+/* ========== DTOs ========== */
+
+type salesTerritoryAreaInput struct {
+	State string `json:"state"`
+	City  string `json:"city"`
+}
+
+type CreateSalesTerritoryRequest struct {
+	Name        string                    `json:"name"`
+	Code        string                    `json:"code"`
+	Description string                    `json:"description"`
+	UnitID      *uint                     `json:"unit_id"`
+	Active      *bool                     `json:"active"`
+	Areas       []salesTerritoryAreaInput `json:"areas"`
+}
+
+// Areas, when sent, replace all areas of the territory
+type UpdateSalesTerritoryRequest struct {
+	Name        *string                    `json:"name"`
+	Code        *string                    `json:"code"`
+	Description *string                    `json:"description"`
+	UnitID      *uint                      `json:"unit_id"`
+	Active      *bool                      `json:"active"`
+	Areas       *[]salesTerritoryAreaInput `json:"areas"`
+}
+
+/* ========== HELPERS ========== */
+
+func salesTerritoryAreaKey(state, city string) string {
+	return strings.ToLower(strings.TrimSpace(state)) + "|" + strings.ToLower(strings.TrimSpace(city))
+}
+
+// buildSalesTerritoryAreas trims the areas and rejects blank states and repeats
+func buildSalesTerritoryAreas(input []salesTerritoryAreaInput) ([]models.SalesTerritoryArea, error) {
+	areas := make([]models.SalesTerritoryArea, 0, len(input))
+	seen := map[string]bool{}
+	for _, a := range input {
+		state := strings.TrimSpace(a.State)
+		city := strings.TrimSpace(a.City)
+		if state == "" {
+			return nil, fmt.Errorf("every area needs a state")
+		}
+		key := salesTerritoryAreaKey(state, city)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		areas = append(areas, models.SalesTerritoryArea{State: state, City: city})
+	}
+	return areas, nil
+}
+
+// salesTerritoryAreaConflict names an area already placed in another territory, if any
+func salesTerritoryAreaConflict(db *gorm.DB, territoryID uint, areas []models.SalesTerritoryArea) (string, error) {
+	for _, a := range areas {
+		var other models.SalesTerritoryArea
+		err := db.Where("LOWER(state) = LOWER(?) AND LOWER(city) = LOWER(?) AND territory_id <> ?", a.State, a.City, territoryID).
+			First(&other).Error
+		if err == gorm.ErrRecordNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		place := a.State
+		if a.City != "" {
+			place = a.City + ", " + a.State
+		}
+		return fmt.Sprintf("%s already belongs to territory %d", place, other.TerritoryID), nil
+	}
+	return "", nil
+}
+
+func validateSalesTerritory(db *gorm.DB, t *models.SalesTerritory) error {
+	if strings.TrimSpace(t.Name) == "" {
+		return &httpError{Status: 400, Msg: "name is required"}
+	}
+	if t.UnitID != nil {
+		var unit models.OrganizationUnit
+		if err := db.First(&unit, *t.UnitID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return &httpError{Status: 400, Msg: "organization unit not found"}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// salesTerritoryResolver finds the active territory of a state and city
+type salesTerritoryResolver map[string]uint
+
+func loadSalesTerritoryResolver(db *gorm.DB) (salesTerritoryResolver, error) {
+	var areas []models.SalesTerritoryArea
+	if err := db.Joins("JOIN sales_territories t ON t.id = sales_territory_areas.territory_id AND t.active = true").
+		Find(&areas).Error; err != nil {
+		return nil, err
+	}
+	r := salesTerritoryResolver{}
+	for _, a := range areas {
+		r[salesTerritoryAreaKey(a.State, a.City)] = a.TerritoryID
+	}
+	return r, nil
+}
+
+// Territory returns the territory of the city, else of the whole state
+func (r salesTerritoryResolver) Territory(state, city string) *uint {
+	if strings.TrimSpace(state) == "" {
+		return nil
+	}
+	if city != "" {
+		if id, ok := r[salesTerritoryAreaKey(state, city)]; ok {
+			return &id
+		}
+	}
+	if id, ok := r[salesTerritoryAreaKey(state, "")]; ok {
+		return &id
+	}
+	return nil
+}
+
+/* ========== HANDLERS ========== */
+
+func CreateSalesTerritory(c *fiber.Ctx) error {
+	var body CreateSalesTerritoryRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	areas, err := buildSalesTerritoryAreas(body.Areas)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	territory := models.SalesTerritory{
+		Name:        strings.TrimSpace(body.Name),
+		Code:        strings.TrimSpace(body.Code),
+		Description: body.Description,
+		UnitID:      body.UnitID,
+		Active:      true,
+		Areas:       areas,
+	}
+	if body.Active != nil {
+		territory.Active = *body.Active
+	}
+
+	if err := validateSalesTerritory(salesTerritoryDB, &territory); err != nil {
+		if he, ok := err.(*httpError); ok {
+			return c.Status(he.Status).JSON(fiber.Map{"error": he.Msg})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	conflict, err := salesTerritoryAreaConflict(salesTerritoryDB, 0, areas)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if conflict != "" {
+		return c.Status(409).JSON(fiber.Map{"error": conflict})
+	}
+
+	if err := salesTerritoryDB.Create(&territory).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(territory)
+}
+
+// GetSalesTerritories lists territories with their areas. Query: active=true, unit_id
+func GetSalesTerritories(c *fiber.Ctx) error {
+	var territories []models.SalesTerritory
+
+	query := salesTerritoryDB.Preload("Unit").Preload("Areas", func(db *gorm.DB) *gorm.DB {
+		return db.Order("state asc, city asc")
+	}).Order("name asc")
+
+	if c.Query("active") == "true" {
+		query = query.Where("active = true")
+	}
+	if unitID := c.QueryInt("unit_id", 0); unitID > 0 {
+		query = query.Where("unit_id = ?", unitID)
+	}
+
+	if err := query.Find(&territories).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(territories)
+}
+
+func GetSalesTerritory(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var territory models.SalesTerritory
+
+	if err := salesTerritoryDB.Preload("Unit").Preload("Areas").First(&territory, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Territory not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(territory)
+}
+
+func UpdateSalesTerritory(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body UpdateSalesTerritoryRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var territory models.SalesTerritory
+	if err := salesTerritoryDB.First(&territory, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Territory not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if body.Name != nil {
+		territory.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Code != nil {
+		territory.Code = strings.TrimSpace(*body.Code)
+	}
+	if body.Description != nil {
+		territory.Description = *body.Description
+	}
+	if body.UnitID != nil {
+		if *body.UnitID == 0 {
+			territory.UnitID = nil
+		} else {
+			territory.UnitID = body.UnitID
+		}
+	}
+	if body.Active != nil {
+		territory.Active = *body.Active
+	}
+
+	if err := validateSalesTerritory(salesTerritoryDB, &territory); err != nil {
+		if he, ok := err.(*httpError); ok {
+			return c.Status(he.Status).JSON(fiber.Map{"error": he.Msg})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var areas []models.SalesTerritoryArea
+	if body.Areas != nil {
+		built, err := buildSalesTerritoryAreas(*body.Areas)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		conflict, err := salesTerritoryAreaConflict(salesTerritoryDB, territory.ID, built)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if conflict != "" {
+			return c.Status(409).JSON(fiber.Map{"error": conflict})
+		}
+		areas = built
+	}
+
+	tx := salesTerritoryDB.Begin()
+	if err := tx.Omit("Unit", "Areas").Save(&territory).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.Areas != nil {
+		if err := tx.Where("territory_id = ?", territory.ID).Delete(&models.SalesTerritoryArea{}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		for i := range areas {
+			areas[i].TerritoryID = territory.ID
+		}
+		if len(areas) > 0 {
+			if err := tx.Create(&areas).Error; err != nil {
+				tx.Rollback()
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := salesTerritoryDB.Preload("Unit").Preload("Areas").First(&territory, territory.ID).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(territory)
+}
+
+// DeleteSalesTerritory removes a territory and its areas; targets set on it must go first
+func DeleteSalesTerritory(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var targets int64
+	if err := salesTerritoryDB.Model(&models.SalesTarget{}).Where("territory_id = ?", id).Count(&targets).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if targets > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Territory has %d targets", targets)})
+	}
+
+	tx := salesTerritoryDB.Begin()
+	if err := tx.Where("territory_id = ?", id).Delete(&models.SalesTerritoryArea{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Delete(&models.SalesTerritory{}, id).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Territory deleted successfully"})
+}
@@ -3,6 +3,8 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"erp.local/backend/models"
 
@@ -22,6 +24,10 @@ type CreateSeriesRequest struct {
 	Name             string `json:"name"`
 	Prefix           string `json:"prefix"`
 	Postfix          string `json:"postfix"`
+	Pattern          string `json:"pattern"`
+	ResetPolicy      string `json:"reset_policy"`
+	StartNumber      uint   `json:"start_number"`
+	BranchScoped     bool   `json:"branch_scoped"`
 	Remarks          string `json:"remarks"`
 	CompanyID        *uint  `json:"company_id"`
 	CompanyBranchID  *uint  `json:"company_branch_id"`
@@ -34,6 +40,10 @@ type UpdateSeriesRequest struct {
 	Name             *string `json:"name"`
 	Prefix           *string `json:"prefix"`
 	Postfix          *string `json:"postfix"`
+	Pattern          *string `json:"pattern"`
+	ResetPolicy      *string `json:"reset_policy"`
+	StartNumber      *uint   `json:"start_number"`
+	BranchScoped     *bool   `json:"branch_scoped"`
 	Remarks          *string `json:"remarks"`
 	CompanyID        *uint   `json:"company_id"`
 	CompanyBranchID  *uint   `json:"company_branch_id"`
@@ -41,17 +51,37 @@ type UpdateSeriesRequest struct {
 	IsActive         *bool   `json:"is_active"`
 }
 
+type CloseSeriesYearRequest struct {
+	FinancialYear string `json:"financial_year"`
+	ClosedBy      *uint  `json:"closed_by"`
+	Remarks       string `json:"remarks"`
+}
+
 func CreateSeries(c *fiber.Ctx) error {
 	var body CreateSeriesRequest
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
+	if body.ResetPolicy == "" {
+		body.ResetPolicy = models.SeriesResetYearly
+	}
+	if body.StartNumber == 0 {
+		body.StartNumber = 1
+	}
+	if err := validateSeriesConfig(body.Pattern, body.ResetPolicy, body.BranchScoped); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	series := models.Series{
 		DocumentType:    body.DocumentType,
 		Name:            body.Name,
 		Prefix:          body.Prefix,
 		Postfix:         body.Postfix,
+		Pattern:         body.Pattern,
+		ResetPolicy:     body.ResetPolicy,
+		StartNumber:     body.StartNumber,
+		BranchScoped:    body.BranchScoped,
 		Remarks:         body.Remarks,
 		CompanyID:       body.CompanyID,
 		CompanyBranchID: body.CompanyBranchID,
@@ -149,6 +179,29 @@ func UpdateSeries(c *fiber.Ctx) error {
 	if body.Postfix != nil {
 		updates["postfix"] = *body.Postfix
 	}
+	// Validate the numbering settings as they will be after the update
+	pattern, resetPolicy, branchScoped := series.Pattern, series.ResetPolicy, series.BranchScoped
+	if body.Pattern != nil {
+		pattern = *body.Pattern
+		updates["pattern"] = pattern
+	}
+	if body.ResetPolicy != nil {
+		resetPolicy = *body.ResetPolicy
+		updates["reset_policy"] = resetPolicy
+	}
+	if body.BranchScoped != nil {
+		branchScoped = *body.BranchScoped
+		updates["branch_scoped"] = branchScoped
+	}
+	if err := validateSeriesConfig(pattern, resetPolicy, branchScoped); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.StartNumber != nil {
+		if *body.StartNumber == 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "start_number must be at least 1"})
+		}
+		updates["start_number"] = *body.StartNumber
+	}
 	if body.Remarks != nil {
 		updates["remarks"] = *body.Remarks
 	}
@@ -192,3 +245,116 @@ func DeleteSeries(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"message": "Series deleted successfully"})
 }
+
+// PreviewSeriesNumbers returns the next N numbers of a series without issuing them.
+// Query: count (default 5, max 100), date (YYYY-MM-DD, default today), company_branch_id
+func PreviewSeriesNumbers(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var series models.Series
+	if err := seriesDB.First(&series, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Series not found"})
+	}
+
+	count := c.QueryInt("count", 5)
+	if count < 1 || count > 100 {
+		return c.Status(400).JSON(fiber.Map{"error": "count must be between 1 and 100"})
+	}
+
+	docDate := time.Now()
+	if d := c.Query("date"); d != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", d, istLocation)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+		}
+		docDate = parsed
+	}
+	branchID := uint(c.QueryInt("company_branch_id", 0))
+
+	numbers, err := previewSeriesNumbers(seriesDB, &series, docDate, branchID, count)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"series_id":      series.ID,
+		"financial_year": financialYearOf(docDate.In(istLocation)),
+		"numbers":        numbers,
+	})
+}
+
+// GetSeriesCounters lists the counters and closed financial years of a series
+func GetSeriesCounters(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var series models.Series
+	if err := seriesDB.First(&series, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Series not found"})
+	}
+
+	var counters []models.SeriesCounter
+	seriesDB.Where("series_id = ?", series.ID).
+		Order("financial_year desc, period desc, company_branch_id asc").
+		Find(&counters)
+
+	var closures []models.SeriesYearClosure
+	seriesDB.Where("series_id = ?", series.ID).Order("financial_year desc").Find(&closures)
+
+	return c.JSON(fiber.Map{
+		"series":       series,
+		"counters":     counters,
+		"closed_years": closures,
+	})
+}
+
+// CloseSeriesYear closes a finished financial year for a series so no further numbers are issued into it
+func CloseSeriesYear(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var series models.Series
+	if err := seriesDB.First(&series, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Series not found"})
+	}
+
+	var body CloseSeriesYearRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	body.FinancialYear = strings.TrimSpace(body.FinancialYear)
+
+	end, err := financialYearEnd(body.FinancialYear)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if time.Now().Before(end) {
+		return c.Status(400).JSON(fiber.Map{"error": "Financial year " + body.FinancialYear + " has not ended yet"})
+	}
+
+	var existing int64
+	seriesDB.Model(&models.SeriesYearClosure{}).
+		Where("series_id = ? AND financial_year = ?", series.ID, body.FinancialYear).
+		Count(&existing)
+	if existing > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Financial year " + body.FinancialYear + " is already closed"})
+	}
+
+	closure := models.SeriesYearClosure{
+		SeriesID:      series.ID,
+		FinancialYear: body.FinancialYear,
+		ClosedBy:      body.ClosedBy,
+		Remarks:       body.Remarks,
+	}
+	if err := seriesDB.Create(&closure).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var counters []models.SeriesCounter
+	seriesDB.Where("series_id = ? AND financial_year = ?", series.ID, body.FinancialYear).
+		Order("period asc, company_branch_id asc").
+		Find(&counters)
+
+	return c.Status(201).JSON(fiber.Map{
+		"closure":  closure,
+		"counters": counters,
+	})
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+)
+
+const (
+	defaultTradeIndiaAPIURL = "https://www.tradeindia.com/utils/my_inquiry.html"
+
+	tradeIndiaMaxWindow = 7 * 24 * time.Hour
+	tradeIndiaPageSize  = 100
+	tradeIndiaMaxPages  = 20
+)
+
+type tradeIndiaConnector struct {
+	client    *leadPlatformClient
+	apiURL    string
+	userID    string
+	profileID string
+	key       string
+}
+
+// newTradeIndiaConnector reads userId, profileId and key as saved from the Integrations page
+func newTradeIndiaConnector(integration models.Integration, client *leadPlatformClient) (LeadConnector, error) {
+	c := &tradeIndiaConnector{
+		client:    client,
+		apiURL:    integrationConfigString(integration.Config, "api_url"),
+		userID:    integrationConfigString(integration.Config, "userId", "user_id"),
+		profileID: integrationConfigString(integration.Config, "profileId", "profile_id"),
+		key:       integrationConfigString(integration.Config, "key", "api_key"),
+	}
+	if c.userID == "" || c.profileID == "" || c.key == "" {
+		return nil, errors.New("TradeIndia userId, profileId and key are required")
+	}
+	if c.apiURL == "" {
+		c.apiURL = defaultTradeIndiaAPIURL
+	}
+	return c, nil
+}
+
+// FetchSince pages through the inquiries generated from the cursor date onwards
+func (c *tradeIndiaConnector) FetchSince(cursor string) ([]ExternalLeadRecord, string, error) {
+	now := time.Now().In(istLocation)
+	from := leadSyncWindowStart(cursor, indiaMartQueryTimeLayout, now)
+	to := now
+	if to.Sub(from) > tradeIndiaMaxWindow {
+		to = from.Add(tradeIndiaMaxWindow)
+	}
+
+	next := cursor
+	var records []ExternalLeadRecord
+	for page := 1; page <= tradeIndiaMaxPages; page++ {
+		params := url.Values{}
+		params.Set("userid", c.userID)
+		params.Set("profile_id", c.profileID)
+		params.Set("key", c.key)
+		params.Set("from_date", from.Format("2006-01-02"))
+		params.Set("to_date", to.Format("2006-01-02"))
+		params.Set("limit", strconv.Itoa(tradeIndiaPageSize))
+		params.Set("page_no", strconv.Itoa(page))
+
+		status, body, err := c.client.Get(withQuery(c.apiURL, params))
+		if err != nil {
+			return nil, cursor, err
+		}
+		if status != http.StatusOK {
+			return nil, cursor, fmt.Errorf("TradeIndia API returned status %d: %s", status, string(body))
+		}
+
+		var inquiries []map[string]interface{}
+		if err := json.Unmarshal(body, &inquiries); err != nil {
+			// An empty result comes back as an object with a message
+			var msg map[string]interface{}
+			if json.Unmarshal(body, &msg) == nil {
+				break
+			}
+			return nil, cursor, fmt.Errorf("failed to parse TradeIndia response: %w", err)
+		}
+
+		for _, inq := range inquiries {
+			rec := ExternalLeadRecord{ExternalID: mapString(inq, "rfi_id", "inquiry_id"), Data: inq}
+			received := strings.TrimSpace(mapString(inq, "generated_date") + " " + mapString(inq, "generated_time"))
+			if t, err := time.ParseInLocation(indiaMartQueryTimeLayout, received, istLocation); err == nil {
+				rec.ReceivedAt = t
+				if stamp := t.Format(indiaMartQueryTimeLayout); stamp > next {
+					next = stamp
+				}
+			}
+			records = append(records, rec)
+		}
+
+		if len(inquiries) < tradeIndiaPageSize {
+			break
+		}
+	}
+
+	if next == cursor && to.Before(now) {
+		next = to.Format(indiaMartQueryTimeLayout)
+	}
+
+	return records, next, nil
+}
+
+// MapLead maps a TradeIndia inquiry to a CRM lead
+func (c *tradeIndiaConnector) MapLead(rec ExternalLeadRecord) models.Lead {
+	inq := rec.Data.(map[string]interface{})
+
+	lead := models.Lead{
+		Business:     mapString(inq, "sender_co", "sender_company"),
+		Name:         mapString(inq, "sender_name"),
+		Mobile:       mapString(inq, "sender_mobile", "sender_other_mobiles"),
+		Email:        mapString(inq, "sender_email"),
+		AddressLine1: mapString(inq, "address", "sender_address"),
+		City:         mapString(inq, "sender_city"),
+		State:        mapString(inq, "sender_state"),
+		Country:      mapString(inq, "sender_country"),
+		Source:       "TradeIndia",
+		Requirements: strings.TrimSpace(mapString(inq, "subject") + "\n" + mapString(inq, "message")),
+		ProductName:  mapString(inq, "product_name"),
+		Since:        rec.ReceivedAt,
+	}
+	if lead.Business == "" {
+		lead.Business = lead.Name
+	}
+	return lead
+}
+
+// Ack is a no-op: TradeIndia has no acknowledgement
+func (c *tradeIndiaConnector) Ack(records []ExternalLeadRecord) error {
+	return nil
+}
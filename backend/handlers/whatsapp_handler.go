@@ -0,0 +1,875 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"erp.local/backend/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var whatsAppDB *gorm.DB
+
+func SetWhatsAppDB(db *gorm.DB) {
+	whatsAppDB = db
+}
+
+const whatsAppUploadDir = "uploads/whatsapp"
+
+// Order of delivery states; a late webhook never moves a message backwards
+var whatsAppStatusRank = map[string]int{"queued": 0, "sent": 1, "delivered": 2, "read": 3}
+
+var whatsAppPlaceholder = regexp.MustCompile(`\{\{(\d+)\}\}`)
+
+/* ========== DTOs ========== */
+
+type WhatsappTemplateRequest struct {
+	Name      string   `json:"name"`
+	Language  string   `json:"language"`
+	Category  string   `json:"category"`
+	Body      string   `json:"body"`
+	Variables []string `json:"variables"`
+	Active    *bool    `json:"active"`
+}
+
+// SendWhatsAppRequest is a free text message or a template. Template variables are filled from
+// Variables, then from the lead/quotation (lead_name, business, contact_name, mobile,
+// quotation_number, quotation_date, grand_total, sender_name); Params overrides both.
+type SendWhatsAppRequest struct {
+	To         string            `json:"to"`
+	Text       string            `json:"text"`
+	TemplateID *uint             `json:"template_id"`
+	Variables  map[string]string `json:"variables"`
+	Params     []string          `json:"params"`
+	Caption    string            `json:"caption"`
+	UserID     *uint             `json:"user_id"`
+}
+
+// whatsAppOutgoing is one message to send; Text is the caption when Document is set
+type whatsAppOutgoing struct {
+	To          string
+	Text        string
+	Template    *models.WhatsappTemplate
+	Params      []string
+	Document    *whatsAppDocument
+	MediaPath   string
+	LeadID      *uint
+	QuotationID *uint
+	SentByID    *uint
+}
+
+/* ========== SERVICE ========== */
+
+// whatsAppNumber returns digits with country code, as the Cloud API expects. Ten digit numbers
+// (and 0 prefixed ones) get countryCode, default 91.
+func whatsAppNumber(number, countryCode string) string {
+	digits := nonDigitRe.ReplaceAllString(number, "")
+	digits = strings.TrimPrefix(digits, "00")
+	if countryCode == "" {
+		countryCode = "91"
+	}
+	if len(digits) == 11 && digits[0] == '0' {
+		digits = digits[1:]
+	}
+	if len(digits) == 10 {
+		digits = countryCode + digits
+	}
+	if len(digits) < 8 || len(digits) > 15 {
+		return ""
+	}
+	return digits
+}
+
+// sendWhatsApp sends through the active whatsapp integration and logs the message. Messages
+// about a lead are also logged on it as a whatsapp interaction. Failed sends are kept with
+// their error.
+func sendWhatsApp(db *gorm.DB, out whatsAppOutgoing) (models.WhatsappMessage, error) {
+	var msg models.WhatsappMessage
+
+	integration, err := activeIntegration(db, "whatsapp")
+	if err != nil {
+		return msg, err
+	}
+	if integration == nil {
+		return msg, fmt.Errorf("no active whatsapp integration")
+	}
+	provider, err := newWhatsAppProvider(*integration)
+	if err != nil {
+		return msg, err
+	}
+	to := whatsAppNumber(out.To, integrationConfigString(integration.Config, "country_code"))
+	if to == "" {
+		return msg, fmt.Errorf("invalid whatsapp number %q", out.To)
+	}
+
+	msg = models.WhatsappMessage{
+		IntegrationID: integration.ID,
+		Provider:      integration.Provider,
+		Direction:     "outbound",
+		Number:        to,
+		Type:          "text",
+		Body:          out.Text,
+		Status:        "queued",
+		LeadID:        out.LeadID,
+		QuotationID:   out.QuotationID,
+		SentByID:      out.SentByID,
+	}
+	if out.Template != nil {
+		msg.Type = "template"
+		msg.TemplateID = &out.Template.ID
+		msg.Body = renderWhatsAppTemplate(out.Template.Body, out.Params)
+	} else if out.Document != nil {
+		msg.Type = "document"
+		if out.MediaPath != "" {
+			msg.MediaPath = &out.MediaPath
+		}
+	}
+	if err := db.Create(&msg).Error; err != nil {
+		return msg, err
+	}
+
+	var providerID string
+	var sendErr error
+	switch {
+	case out.Template != nil:
+		providerID, sendErr = provider.SendTemplate(to, *out.Template, out.Params)
+	case out.Document != nil:
+		providerID, sendErr = provider.SendDocument(to, *out.Document, out.Text)
+	default:
+		providerID, sendErr = provider.SendText(to, out.Text)
+	}
+
+	if sendErr != nil {
+		msg.Status = "failed"
+		msg.Error = sendErr.Error()
+	} else {
+		now := time.Now()
+		msg.Status = "sent"
+		msg.ProviderMessageID = providerID
+		msg.SentAt = &now
+		if msg.LeadID != nil {
+			if err := logWhatsAppInteraction(db, &msg); err != nil {
+				log.Printf("whatsapp: failed to log message %d on lead %d: %v", msg.ID, *msg.LeadID, err)
+			}
+		}
+	}
+	if err := db.Save(&msg).Error; err != nil {
+		return msg, err
+	}
+	return msg, sendErr
+}
+
+// logWhatsAppInteraction records a message on its lead. Outbound messages belong to the sender
+// (else the lead's assignee) and count as a response; inbound ones belong to the assignee.
+func logWhatsAppInteraction(db *gorm.DB, msg *models.WhatsappMessage) error {
+	var lead models.Lead
+	if err := db.Select("id", "assigned_to_id").First(&lead, *msg.LeadID).Error; err != nil {
+		return err
+	}
+
+	summary := "WhatsApp from +" + msg.Number
+	assignee := lead.AssignedToID
+	if msg.Direction == "outbound" {
+		summary = "WhatsApp sent to +" + msg.Number
+		if msg.SentByID != nil {
+			assignee = msg.SentByID
+		}
+	}
+	switch msg.Type {
+	case "template":
+		summary += " (template)"
+	case "document":
+		summary += " (document)"
+	}
+	details := msg.Body
+	if msg.MediaPath != nil {
+		details = strings.TrimSpace(details + "\n/" + *msg.MediaPath)
+	}
+
+	interaction := models.LeadInteraction{
+		LeadID:       lead.ID,
+		AssignedToID: assignee,
+		Type:         "whatsapp",
+		Summary:      summary,
+		Details:      details,
+		Timestamp:    time.Now(),
+	}
+	if err := db.Create(&interaction).Error; err != nil {
+		return err
+	}
+	msg.InteractionID = &interaction.ID
+
+	if msg.Direction == "outbound" {
+		if err := syncLeadFirstResponse(db, lead.ID); err != nil {
+			return err
+		}
+	}
+	touchLeadScore(lead.ID)
+	return nil
+}
+
+// whatsAppContextValues are the template variables known from a lead, quotation and sender
+func whatsAppContextValues(db *gorm.DB, lead *models.Lead, quotation *models.QuotationTable, senderID *uint) map[string]string {
+	values := map[string]string{}
+	if lead != nil {
+		values["lead_name"] = lead.Name
+		if values["lead_name"] == "" {
+			values["lead_name"] = lead.Business
+		}
+		values["contact_name"] = lead.Name
+		values["business"] = lead.Business
+		values["mobile"] = lead.Mobile
+	}
+	if quotation != nil {
+		values["quotation_number"] = quotation.QuotationNumber
+		values["quotation_date"] = quotation.QuotationDate.In(istLocation).Format("02 Jan 2006")
+		values["grand_total"] = strconv.FormatFloat(round2(quotation.GrandTotal), 'f', 2, 64)
+	}
+	if senderID != nil {
+		var user models.User
+		if db.Select("id", "firstname", "lastname").First(&user, *senderID).Error == nil {
+			values["sender_name"] = strings.TrimSpace(user.Firstname + " " + user.Lastname)
+		}
+	}
+	return values
+}
+
+// whatsAppTemplateParams fills a template's variables in placeholder order
+func whatsAppTemplateParams(template *models.WhatsappTemplate, req *SendWhatsAppRequest, context map[string]string) ([]string, error) {
+	if len(req.Params) > 0 {
+		return req.Params, nil
+	}
+
+	var names []string
+	if len(template.Variables) > 0 {
+		if err := json.Unmarshal(template.Variables, &names); err != nil {
+			return nil, fmt.Errorf("template %s has invalid variables", template.Name)
+		}
+	}
+
+	params := make([]string, len(names))
+	var missing []string
+	for i, name := range names {
+		v := strings.TrimSpace(req.Variables[name])
+		if v == "" {
+			v = context[name]
+		}
+		if v == "" {
+			missing = append(missing, name)
+		}
+		params[i] = v
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing template variables: %s", strings.Join(missing, ", "))
+	}
+	return params, nil
+}
+
+func loadWhatsappTemplate(db *gorm.DB, id uint) (*models.WhatsappTemplate, error) {
+	var template models.WhatsappTemplate
+	if err := db.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &httpError{Status: 404, Msg: "Template not found"}
+		}
+		return nil, err
+	}
+	if !template.Active {
+		return nil, &httpError{Status: 400, Msg: "Template is not active"}
+	}
+	return &template, nil
+}
+
+func validateWhatsappTemplate(req *WhatsappTemplateRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	highest := 0
+	for _, m := range whatsAppPlaceholder.FindAllStringSubmatch(req.Body, -1) {
+		if n, _ := strconv.Atoi(m[1]); n > highest {
+			highest = n
+		}
+	}
+	if len(req.Variables) != highest {
+		return fmt.Errorf("body has %d placeholders but %d variables are named", highest, len(req.Variables))
+	}
+	for _, v := range req.Variables {
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("variable names must not be empty")
+		}
+	}
+	return nil
+}
+
+func whatsAppError(c *fiber.Ctx, msg models.WhatsappMessage, err error) error {
+	if e, ok := err.(*httpError); ok {
+		return c.Status(e.Status).JSON(fiber.Map{"error": e.Msg})
+	}
+	if msg.ID != 0 {
+		return c.Status(502).JSON(fiber.Map{"error": err.Error(), "message": msg})
+	}
+	return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+}
+
+/* ========== TEMPLATE HANDLERS ========== */
+
+func GetWhatsappTemplates(c *fiber.Ctx) error {
+	var templates []models.WhatsappTemplate
+
+	query := whatsAppDB.Order("name asc")
+	if c.Query("active") == "true" {
+		query = query.Where("active = true")
+	}
+	if err := query.Find(&templates).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(templates)
+}
+
+func CreateWhatsappTemplate(c *fiber.Ctx) error {
+	var req WhatsappTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := validateWhatsappTemplate(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	variables, _ := json.Marshal(req.Variables)
+	template := models.WhatsappTemplate{
+		Name:      req.Name,
+		Language:  req.Language,
+		Category:  req.Category,
+		Body:      req.Body,
+		Variables: variables,
+		Active:    true,
+	}
+	if template.Language == "" {
+		template.Language = "en"
+	}
+	if req.Active != nil {
+		template.Active = *req.Active
+	}
+
+	if err := whatsAppDB.Create(&template).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(template)
+}
+
+func UpdateWhatsappTemplate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var template models.WhatsappTemplate
+	if err := whatsAppDB.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Template not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var req WhatsappTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := validateWhatsappTemplate(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	template.Name = req.Name
+	if req.Language != "" {
+		template.Language = req.Language
+	}
+	template.Category = req.Category
+	template.Body = req.Body
+	template.Variables, _ = json.Marshal(req.Variables)
+	if req.Active != nil {
+		template.Active = *req.Active
+	}
+
+	if err := whatsAppDB.Save(&template).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(template)
+}
+
+func DeleteWhatsappTemplate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	if err := whatsAppDB.Delete(&models.WhatsappTemplate{}, id).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Template deleted successfully"})
+}
+
+/* ========== MESSAGE HANDLERS ========== */
+
+// SendLeadWhatsApp sends a text or template message to a lead (to its mobile unless `to` is given)
+func SendLeadWhatsApp(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req SendWhatsAppRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	var lead models.Lead
+	if err := whatsAppDB.First(&lead, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Lead not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	out := whatsAppOutgoing{To: req.To, Text: strings.TrimSpace(req.Text), LeadID: &lead.ID, SentByID: req.UserID}
+	if out.To == "" {
+		out.To = lead.Mobile
+	}
+
+	if req.TemplateID != nil {
+		template, err := loadWhatsappTemplate(whatsAppDB, *req.TemplateID)
+		if err != nil {
+			return whatsAppError(c, models.WhatsappMessage{}, err)
+		}
+		params, err := whatsAppTemplateParams(template, &req, whatsAppContextValues(whatsAppDB, &lead, nil, req.UserID))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		out.Template = template
+		out.Params = params
+	} else if out.Text == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "text or template_id is required"})
+	}
+
+	msg, err := sendWhatsApp(whatsAppDB, out)
+	if err != nil {
+		return whatsAppError(c, msg, err)
+	}
+
+	return c.Status(201).JSON(msg)
+}
+
+// SendQuotationWhatsApp sends a quotation PDF, either uploaded as `file` (multipart) or the
+// quotation's PDF attachment. With template_id the template goes first: outside WhatsApp's
+// 24 hour service window only a template may open the conversation.
+// Recipient: `to`, else the lead's mobile, else the customer's WhatsApp number.
+func SendQuotationWhatsApp(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req SendWhatsAppRequest
+	if form, err := c.MultipartForm(); err == nil {
+		value := func(key string) string {
+			if v := form.Value[key]; len(v) > 0 {
+				return strings.TrimSpace(v[0])
+			}
+			return ""
+		}
+		req.To = value("to")
+		req.Caption = value("caption")
+		if v, err := strconv.ParseUint(value("template_id"), 10, 64); err == nil && v > 0 {
+			templateID := uint(v)
+			req.TemplateID = &templateID
+		}
+		if v, err := strconv.ParseUint(value("user_id"), 10, 64); err == nil && v > 0 {
+			userID := uint(v)
+			req.UserID = &userID
+		}
+		if raw := value("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "Invalid variables JSON"})
+			}
+		}
+	} else if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+	}
+
+	var quotation models.QuotationTable
+	if err := whatsAppDB.Preload("Customer").First(&quotation, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(404).JSON(fiber.Map{"error": "Quotation not found"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var lead *models.Lead
+	leadQuery := whatsAppDB.Where("customer_id = ?", quotation.CustomerID).Order("updated_at desc")
+	if quotation.LeadID != nil {
+		leadQuery = whatsAppDB.Where("id = ?", *quotation.LeadID)
+	}
+	var found models.Lead
+	if err := leadQuery.First(&found).Error; err == nil {
+		lead = &found
+	} else if err != gorm.ErrRecordNotFound {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	to := req.To
+	if to == "" && lead != nil {
+		to = lead.Mobile
+	}
+	if to == "" {
+		to = userWhatsAppNumber(&quotation.Customer)
+	}
+	if to == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "No WhatsApp number for this quotation; pass `to`"})
+	}
+
+	// The PDF to send
+	var doc whatsAppDocument
+	var mediaPath string
+	if file, err := c.FormFile("file"); err == nil {
+		if !strings.EqualFold(filepath.Ext(file.Filename), ".pdf") {
+			return c.Status(400).JSON(fiber.Map{"error": "file must be a PDF"})
+		}
+		if err := os.MkdirAll(whatsAppUploadDir, 0755); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		mediaPath = filepath.ToSlash(filepath.Join(whatsAppUploadDir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(file.Filename))))
+		if err := c.SaveFile(file, mediaPath); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	} else if quotation.AttachmentPath != nil && strings.EqualFold(filepath.Ext(*quotation.AttachmentPath), ".pdf") {
+		mediaPath = *quotation.AttachmentPath
+	} else {
+		return c.Status(400).JSON(fiber.Map{"error": "Quotation has no PDF attachment; upload one as file"})
+	}
+	data, err := os.ReadFile(mediaPath)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read quotation PDF", "detail": err.Error()})
+	}
+	doc = whatsAppDocument{
+		FileName: strings.NewReplacer("/", "-", `\`, "-").Replace(quotation.QuotationNumber) + ".pdf",
+		MimeType: mime.TypeByExtension(".pdf"),
+		Data:     data,
+	}
+	if doc.MimeType == "" {
+		doc.MimeType = http.DetectContentType(data)
+	}
+
+	var leadID *uint
+	if lead != nil {
+		leadID = &lead.ID
+	}
+	var sent []models.WhatsappMessage
+
+	if req.TemplateID != nil {
+		template, err := loadWhatsappTemplate(whatsAppDB, *req.TemplateID)
+		if err != nil {
+			return whatsAppError(c, models.WhatsappMessage{}, err)
+		}
+		params, err := whatsAppTemplateParams(template, &req, whatsAppContextValues(whatsAppDB, lead, &quotation, req.UserID))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		msg, err := sendWhatsApp(whatsAppDB, whatsAppOutgoing{
+			To: to, Template: template, Params: params,
+			LeadID: leadID, QuotationID: &quotation.QuotationID, SentByID: req.UserID,
+		})
+		if err != nil {
+			return whatsAppError(c, msg, err)
+		}
+		sent = append(sent, msg)
+	}
+
+	caption := req.Caption
+	if caption == "" {
+		caption = "Quotation " + quotation.QuotationNumber
+	}
+	msg, err := sendWhatsApp(whatsAppDB, whatsAppOutgoing{
+		To: to, Text: caption, Document: &doc, MediaPath: mediaPath,
+		LeadID: leadID, QuotationID: &quotation.QuotationID, SentByID: req.UserID,
+	})
+	if err != nil {
+		return whatsAppError(c, msg, err)
+	}
+	sent = append(sent, msg)
+
+	return c.Status(201).JSON(fiber.Map{"messages": sent})
+}
+
+// GetWhatsappMessages lists messages, newest first. Query: lead_id, quotation_id, direction, status, limit
+func GetWhatsappMessages(c *fiber.Ctx) error {
+	query := whatsAppDB.Order("created_at desc")
+
+	if leadID := c.QueryInt("lead_id", 0); leadID > 0 {
+		query = query.Where("lead_id = ?", leadID)
+	}
+	if quotationID := c.QueryInt("quotation_id", 0); quotationID > 0 {
+		query = query.Where("quotation_id = ?", quotationID)
+	}
+	if direction := c.Query("direction"); direction != "" {
+		query = query.Where("direction = ?", direction)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var messages []models.WhatsappMessage
+	if err := query.Limit(c.QueryInt("limit", 100)).Find(&messages).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(messages)
+}
+
+/* ========== WEBHOOKS ========== */
+
+func whatsAppWebhookIntegration(c *fiber.Ctx) (*models.Integration, error) {
+	var integration models.Integration
+	if err := whatsAppDB.Where("type = ?", "whatsapp").First(&integration, c.Params("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &httpError{Status: 404, Msg: "Integration not found"}
+		}
+		return nil, err
+	}
+	return &integration, nil
+}
+
+func whatsAppTimestamp(v interface{}) time.Time {
+	if secs, err := strconv.ParseInt(payloadString(v), 10, 64); err == nil && secs > 0 {
+		return time.Unix(secs, 0)
+	}
+	return time.Now()
+}
+
+// VerifyWhatsAppWebhook answers the Cloud API subscription check with hub.challenge when
+// hub.verify_token matches the integration's verify_token
+func VerifyWhatsAppWebhook(c *fiber.Ctx) error {
+	integration, err := whatsAppWebhookIntegration(c)
+	if err != nil {
+		return whatsAppError(c, models.WhatsappMessage{}, err)
+	}
+
+	token := integrationConfigString(integration.Config, "verify_token")
+	if c.Query("hub.mode") != "subscribe" || token == "" || c.Query("hub.verify_token") != token {
+		return c.Status(403).JSON(fiber.Map{"error": "Verification failed"})
+	}
+	return c.SendString(c.Query("hub.challenge"))
+}
+
+// ReceiveWhatsAppWebhook takes delivery/read statuses and incoming messages. The body is the
+// Cloud API notification ({"entry": [{"changes": [{"value": ...}]}]}); gateways post the value
+// object itself ({"statuses": [...], "messages": [...]}). It is signed with the integration's
+// app_secret or webhook_secret in X-Hub-Signature-256 (or X-Signature).
+func ReceiveWhatsAppWebhook(c *fiber.Ctx) error {
+	integration, err := whatsAppWebhookIntegration(c)
+	if err != nil {
+		return whatsAppError(c, models.WhatsappMessage{}, err)
+	}
+
+	if integration.Provider != "fake" {
+		secret := integrationConfigString(integration.Config, "app_secret", "webhook_secret")
+		if secret == "" {
+			return c.Status(403).JSON(fiber.Map{"error": "Webhook secret is not configured for this integration"})
+		}
+		if !verifyLeadWebhookSignature(secret, c.Body(), leadWebhookSignatureHeader(c)) {
+			return c.Status(401).JSON(fiber.Map{"error": "Invalid signature"})
+		}
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	values := []map[string]interface{}{}
+	if entries, ok := payload["entry"].([]interface{}); ok {
+		for _, e := range entries {
+			entry, _ := e.(map[string]interface{})
+			changes, _ := entry["changes"].([]interface{})
+			for _, ch := range changes {
+				change, _ := ch.(map[string]interface{})
+				if value, ok := change["value"].(map[string]interface{}); ok {
+					values = append(values, value)
+				}
+			}
+		}
+	} else {
+		values = append(values, payload)
+	}
+
+	statuses, received := 0, 0
+	for _, value := range values {
+		list, _ := value["statuses"].([]interface{})
+		for _, s := range list {
+			status, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if updated, err := applyWhatsAppStatus(whatsAppDB, status); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			} else if updated {
+				statuses++
+			}
+		}
+
+		contacts, _ := value["contacts"].([]interface{})
+		list, _ = value["messages"].([]interface{})
+		for _, m := range list {
+			message, ok := m.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if stored, err := receiveWhatsAppMessage(whatsAppDB, integration, message, contacts); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			} else if stored {
+				received++
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{"statuses": statuses, "messages": received})
+}
+
+// applyWhatsAppStatus moves an outbound message to sent, delivered, read or failed
+func applyWhatsAppStatus(db *gorm.DB, status map[string]interface{}) (bool, error) {
+	id := payloadString(status["id"])
+	if id == "" {
+		id = payloadString(status["message_id"])
+	}
+	state := strings.ToLower(payloadString(status["status"]))
+	if id == "" || state == "" {
+		return false, nil
+	}
+
+	var msg models.WhatsappMessage
+	err := db.Where("provider_message_id = ? AND direction = ?", id, "outbound").First(&msg).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	at := whatsAppTimestamp(status["timestamp"])
+	switch {
+	case state == "failed":
+		msg.Status = "failed"
+		msg.Error = "failed"
+		if errs, ok := status["errors"].([]interface{}); ok && len(errs) > 0 {
+			if first, ok := errs[0].(map[string]interface{}); ok {
+				msg.Error = strings.TrimSpace(payloadString(first["title"]) + " " + payloadString(first["message"]))
+			}
+		}
+	case whatsAppStatusRank[state] > whatsAppStatusRank[msg.Status] && msg.Status != "failed":
+		msg.Status = state
+		if state == "read" && msg.ReadAt == nil {
+			msg.ReadAt = &at
+		}
+		if (state == "delivered" || state == "read") && msg.DeliveredAt == nil {
+			msg.DeliveredAt = &at
+		}
+	default:
+		return false, nil
+	}
+
+	return true, db.Save(&msg).Error
+}
+
+// receiveWhatsAppMessage stores an incoming message and logs it on the lead with that mobile
+func receiveWhatsAppMessage(db *gorm.DB, integration *models.Integration, message map[string]interface{}, contacts []interface{}) (bool, error) {
+	id := payloadString(message["id"])
+	from := whatsAppNumber(payloadString(message["from"]), integrationConfigString(integration.Config, "country_code"))
+	if from == "" {
+		return false, nil
+	}
+	if id != "" {
+		var count int64
+		if err := db.Model(&models.WhatsappMessage{}).
+			Where("provider_message_id = ? AND direction = ?", id, "inbound").Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return false, nil
+		}
+	}
+
+	kind := payloadString(message["type"])
+	text := payloadString(payloadValue(message, "text.body"))
+	if text == "" {
+		text = payloadString(message["text"])
+	}
+	for _, path := range []string{"button.text", "interactive.button_reply.title", "interactive.list_reply.title", kind + ".caption"} {
+		if text == "" {
+			text = payloadString(payloadValue(message, path))
+		}
+	}
+	if text == "" && kind != "" {
+		text = "[" + kind + "]"
+	}
+	for _, ct := range contacts {
+		contact, _ := ct.(map[string]interface{})
+		if name := payloadString(payloadValue(contact, "profile.name")); name != "" && whatsAppNumber(payloadString(contact["wa_id"]), "") == from {
+			text = name + ": " + text
+			break
+		}
+	}
+
+	msg := models.WhatsappMessage{
+		IntegrationID:     integration.ID,
+		Provider:          integration.Provider,
+		Direction:         "inbound",
+		Number:            from,
+		Type:              "text",
+		Body:              text,
+		ProviderMessageID: id,
+		Status:            "received",
+	}
+	if kind != "" && kind != "text" {
+		msg.Type = kind
+	}
+	at := whatsAppTimestamp(message["timestamp"])
+	msg.SentAt = &at
+
+	var lead models.Lead
+	err := db.Select("id", "assigned_to_id", "business", "contact").
+		Where(leadMobileKeySQL+" = ?", normalizeMobile(from)).
+		Order("updated_at desc").First(&lead).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return false, err
+	}
+	if err == nil {
+		msg.LeadID = &lead.ID
+	}
+
+	if err := db.Create(&msg).Error; err != nil {
+		return false, err
+	}
+	if msg.LeadID == nil {
+		return true, nil
+	}
+
+	if err := logWhatsAppInteraction(db, &msg); err != nil {
+		return false, err
+	}
+	if err := db.Model(&msg).Update("interaction_id", msg.InteractionID).Error; err != nil {
+		return false, err
+	}
+	if lead.AssignedToID != nil {
+		name := lead.Business
+		if name == "" {
+			name = lead.Name
+		}
+		if err := notifyUser(db, *lead.AssignedToID, "lead_whatsapp", "New WhatsApp message",
+			fmt.Sprintf("Lead #%d %s: %s", lead.ID, name, text), "lead", &lead.ID); err != nil {
+			log.Printf("whatsapp: failed to notify user %d: %v", *lead.AssignedToID, err)
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"erp.local/backend/models"
+)
+
+// WhatsAppProvider sends messages through one WhatsApp integration. Each call returns the
+// provider's message id, which delivery and read webhooks refer to.
+type WhatsAppProvider interface {
+	SendText(to, text string) (string, error)
+	// SendTemplate sends an approved template; params fill its body placeholders in order
+	SendTemplate(to string, template models.WhatsappTemplate, params []string) (string, error)
+	SendDocument(to string, doc whatsAppDocument, caption string) (string, error)
+}
+
+type whatsAppDocument struct {
+	FileName string
+	MimeType string
+	Data     []byte
+}
+
+// Providers by Integration.Provider; anything else with an api_url is treated as a gateway
+var whatsAppProviders = map[string]func(integration models.Integration) (WhatsAppProvider, error){
+	"cloud_api": newWhatsAppCloudProvider,
+	"meta":      newWhatsAppCloudProvider,
+	"gateway":   newWhatsAppGatewayProvider,
+	"custom":    newWhatsAppGatewayProvider,
+	"fake":      newWhatsAppFakeProvider,
+}
+
+func newWhatsAppProvider(integration models.Integration) (WhatsAppProvider, error) {
+	if build, ok := whatsAppProviders[integration.Provider]; ok {
+		return build(integration)
+	}
+	if integrationConfigString(integration.Config, "api_url", "url") != "" {
+		return newWhatsAppGatewayProvider(integration)
+	}
+	return nil, fmt.Errorf("whatsapp provider %q is not supported", integration.Provider)
+}
+
+var whatsAppHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// renderWhatsAppTemplate fills {{1}}, {{2}}... in a template body
+func renderWhatsAppTemplate(body string, params []string) string {
+	for i, p := range params {
+		body = strings.ReplaceAll(body, fmt.Sprintf("{{%d}}", i+1), p)
+	}
+	return body
+}
+
+/* ========== CLOUD API ========== */
+
+// WhatsApp Cloud API (config: phone_number_id, access_token, optional api_version and
+// graph_url). Documents are uploaded as media first, so no public link is needed.
+type whatsAppCloudProvider struct {
+	baseURL string
+	token   string
+}
+
+func newWhatsAppCloudProvider(integration models.Integration) (WhatsAppProvider, error) {
+	phoneID := integrationConfigString(integration.Config, "phone_number_id")
+	token := integrationConfigString(integration.Config, "access_token", "token")
+	if phoneID == "" || token == "" {
+		return nil, fmt.Errorf("whatsapp integration %d needs phone_number_id and access_token", integration.ID)
+	}
+	graph := strings.TrimRight(integrationConfigString(integration.Config, "graph_url"), "/")
+	if graph == "" {
+		graph = "https://graph.facebook.com"
+	}
+	version := integrationConfigString(integration.Config, "api_version")
+	if version == "" {
+		version = "v21.0"
+	}
+	return &whatsAppCloudProvider{baseURL: graph + "/" + version + "/" + phoneID, token: token}, nil
+}
+
+func (p *whatsAppCloudProvider) do(path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, p.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+p.token)
+
+	resp, err := whatsAppHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+				Code    int    `json:"code"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("whatsapp cloud api error %d: %s", apiErr.Error.Code, apiErr.Error.Message)
+		}
+		return fmt.Errorf("whatsapp cloud api returned %d", resp.StatusCode)
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func (p *whatsAppCloudProvider) send(to, kind string, content interface{}) (string, error) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                to,
+		"type":              kind,
+		kind:                content,
+	})
+	var out struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	if err := p.do("/messages", "application/json", bytes.NewReader(payload), &out); err != nil {
+		return "", err
+	}
+	if len(out.Messages) == 0 {
+		return "", fmt.Errorf("whatsapp cloud api returned no message id")
+	}
+	return out.Messages[0].ID, nil
+}
+
+func (p *whatsAppCloudProvider) SendText(to, text string) (string, error) {
+	return p.send(to, "text", map[string]interface{}{"body": text, "preview_url": false})
+}
+
+func (p *whatsAppCloudProvider) SendTemplate(to string, template models.WhatsappTemplate, params []string) (string, error) {
+	content := map[string]interface{}{
+		"name":     template.Name,
+		"language": map[string]string{"code": template.Language},
+	}
+	if len(params) > 0 {
+		parameters := make([]map[string]string, len(params))
+		for i, v := range params {
+			parameters[i] = map[string]string{"type": "text", "text": v}
+		}
+		content["components"] = []map[string]interface{}{{"type": "body", "parameters": parameters}}
+	}
+	return p.send(to, "template", content)
+}
+
+func (p *whatsAppCloudProvider) SendDocument(to string, doc whatsAppDocument, caption string) (string, error) {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	form.WriteField("messaging_product", "whatsapp")
+	form.WriteField("type", doc.MimeType)
+	part, err := form.CreatePart(map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="file"; filename=%q`, doc.FileName)},
+		"Content-Type":        {doc.MimeType},
+	})
+	if err != nil {
+		return "", err
+	}
+	part.Write(doc.Data)
+	form.Close()
+
+	var media struct {
+		ID string `json:"id"`
+	}
+	if err := p.do("/media", form.FormDataContentType(), &buf, &media); err != nil {
+		return "", err
+	}
+
+	content := map[string]string{"id": media.ID, "filename": doc.FileName}
+	if caption != "" {
+		content["caption"] = caption
+	}
+	return p.send(to, "document", content)
+}
+
+/* ========== HTTP GATEWAY ========== */
+
+// Generic HTTP gateway (config: api_url, token). The gateway receives JSON
+// {"to", "message"} plus "template"/"language"/"params" for templates and
+// "document": {"filename", "mime_type", "data" (base64)} for files, and may answer with
+// {"id"} or {"message_id"}.
+type whatsAppGatewayProvider struct {
+	apiURL string
+	token  string
+}
+
+func newWhatsAppGatewayProvider(integration models.Integration) (WhatsAppProvider, error) {
+	apiURL := integrationConfigString(integration.Config, "api_url", "url")
+	if apiURL == "" {
+		return nil, fmt.Errorf("whatsapp integration %d has no api_url", integration.ID)
+	}
+	return &whatsAppGatewayProvider{
+		apiURL: apiURL,
+		token:  integrationConfigString(integration.Config, "token", "api_key"),
+	}, nil
+}
+
+func (p *whatsAppGatewayProvider) post(payload map[string]interface{}) (string, error) {
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequest(http.MethodPost, p.apiURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := whatsAppHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("whatsapp gateway returned %d", resp.StatusCode)
+	}
+
+	var out map[string]interface{}
+	raw, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(raw, &out) != nil {
+		return "", nil
+	}
+	return mapString(out, "id", "message_id"), nil
+}
+
+func (p *whatsAppGatewayProvider) SendText(to, text string) (string, error) {
+	return p.post(map[string]interface{}{"to": to, "message": text})
+}
+
+func (p *whatsAppGatewayProvider) SendTemplate(to string, template models.WhatsappTemplate, params []string) (string, error) {
+	return p.post(map[string]interface{}{
+		"to":       to,
+		"message":  renderWhatsAppTemplate(template.Body, params),
+		"template": template.Name,
+		"language": template.Language,
+		"params":   params,
+	})
+}
+
+func (p *whatsAppGatewayProvider) SendDocument(to string, doc whatsAppDocument, caption string) (string, error) {
+	return p.post(map[string]interface{}{
+		"to":      to,
+		"message": caption,
+		"document": map[string]string{
+			"filename":  doc.FileName,
+			"mime_type": doc.MimeType,
+			"data":      base64.StdEncoding.EncodeToString(doc.Data),
+		},
+	})
+}
+
+/* ========== LOCAL FAKE ========== */
+
+// The fake provider only logs, for development and demos. Status webhooks can be replayed by
+// hand against the ids it returns.
+type whatsAppFakeProvider struct {
+	integrationID uint
+}
+
+var whatsAppFakeSeq int64
+
+func newWhatsAppFakeProvider(integration models.Integration) (WhatsAppProvider, error) {
+	return &whatsAppFakeProvider{integrationID: integration.ID}, nil
+}
+
+func (p *whatsAppFakeProvider) id() string {
+	return fmt.Sprintf("fake-%d-%d", time.Now().Unix(), atomic.AddInt64(&whatsAppFakeSeq, 1))
+}
+
+func (p *whatsAppFakeProvider) SendText(to, text string) (string, error) {
+	id := p.id()
+	log.Printf("whatsapp fake %d: %s -> %s: %s", p.integrationID, id, to, text)
+	return id, nil
+}
+
+func (p *whatsAppFakeProvider) SendTemplate(to string, template models.WhatsappTemplate, params []string) (string, error) {
+	id := p.id()
+	log.Printf("whatsapp fake %d: %s -> %s: template %s: %s", p.integrationID, id, to, template.Name, renderWhatsAppTemplate(template.Body, params))
+	return id, nil
+}
+
+func (p *whatsAppFakeProvider) SendDocument(to string, doc whatsAppDocument, caption string) (string, error) {
+	id := p.id()
+	log.Printf("whatsapp fake %d: %s -> %s: document %s (%d bytes) %s", p.integrationID, id, to, doc.FileName, len(doc.Data), caption)
+	return id, nil
+}
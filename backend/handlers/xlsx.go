@@ -0,0 +1,333 @@
+package handler
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Minimal XLSX (Office Open XML spreadsheet) support: enough to read the first worksheet of an
+// uploaded workbook as rows of text, and to stream out a single-sheet workbook.
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readZipXML(files map[string]*zip.File, name string, v interface{}) (bool, error) {
+	f, ok := files[name]
+	if !ok {
+		return false, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return true, err
+	}
+	defer rc.Close()
+	return true, xml.NewDecoder(rc).Decode(v)
+}
+
+// xlsxColumnIndex turns a cell reference like "AB12" into its zero based column (27)
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1
+}
+
+// readXLSXRows returns the cells of the workbook's first worksheet. Row i of the result is
+// spreadsheet row i+1; missing rows and cells come back empty.
+func readXLSXRows(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid xlsx file: %v", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	if ok, err := readZipXML(files, "xl/workbook.xml", &workbook); ok && err == nil && len(workbook.Sheets) > 0 {
+		if ok, err := readZipXML(files, "xl/_rels/workbook.xml.rels", &rels); ok && err == nil {
+			for _, rel := range rels.Items {
+				if rel.ID != workbook.Sheets[0].RID {
+					continue
+				}
+				if strings.HasPrefix(rel.Target, "/") {
+					sheetPath = strings.TrimPrefix(rel.Target, "/")
+				} else {
+					sheetPath = path.Join("xl", rel.Target)
+				}
+				break
+			}
+		}
+	}
+
+	var shared xlsxSharedStrings
+	if _, err := readZipXML(files, "xl/sharedStrings.xml", &shared); err != nil {
+		return nil, fmt.Errorf("xlsx shared strings: %v", err)
+	}
+
+	var sheet xlsxWorksheet
+	ok, err := readZipXML(files, sheetPath, &sheet)
+	if !ok {
+		return nil, fmt.Errorf("xlsx file has no worksheet")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("xlsx worksheet: %v", err)
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		index := len(rows)
+		if row.R > 0 {
+			index = row.R - 1
+		}
+		for len(rows) <= index {
+			rows = append(rows, nil)
+		}
+
+		var cells []string
+		for _, cell := range row.Cells {
+			col := len(cells)
+			if cell.Ref != "" {
+				col = xlsxColumnIndex(cell.Ref)
+			}
+			if col < 0 {
+				continue
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				if n, err := strconv.Atoi(cell.Value); err == nil && n >= 0 && n < len(shared.Items) {
+					value = shared.Items[n].String()
+				}
+			case "inlineStr":
+				value = cell.Inline.String()
+			case "b":
+				if value == "1" {
+					value = "TRUE"
+				} else {
+					value = "FALSE"
+				}
+			case "", "n":
+				// Numbers may be stored in exponent form; spell them out (mobile numbers, amounts)
+				if strings.ContainsAny(value, "eE") {
+					if f, err := strconv.ParseFloat(value, 64); err == nil {
+						value = strconv.FormatFloat(f, 'f', -1, 64)
+					}
+				}
+			}
+			cells[col] = value
+		}
+		rows[index] = cells
+	}
+	return rows, nil
+}
+
+/* ========== WRITER ========== */
+
+// Excel rejects cells longer than this
+const xlsxMaxCellText = 32767
+
+// escapeSpreadsheetFormula stops a spreadsheet from running CSV text as a formula by prefixing
+// text that starts with a formula character with a quote. XLSX inline strings are never
+// evaluated, so the XLSX writer leaves text as it is.
+func escapeSpreadsheetFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// xlsxColumnName is the inverse of xlsxColumnIndex: 27 → "AB"
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxStreamWriter writes a single-sheet workbook row by row. Strings are stored inline, so
+// no shared string table has to be held in memory.
+type xlsxStreamWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+func newXLSXStreamWriter(w io.Writer, sheetName string) (*xlsxStreamWriter, error) {
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheetName))
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + name.String() + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+			`</Relationships>`},
+		// Style 1 is bold, for the header row
+		{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+			`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// The worksheet goes last so it can stay open while rows are written
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+	return &xlsxStreamWriter{zw: zw, sheet: sheet}, nil
+}
+
+func (x *xlsxStreamWriter) writeRow(cells []interface{}, style string) error {
+	x.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.row)
+	for i, cell := range cells {
+		ref := xlsxColumnName(i) + strconv.Itoa(x.row)
+		var number string
+		switch v := cell.(type) {
+		case int:
+			number = strconv.Itoa(v)
+		case uint:
+			number = strconv.FormatUint(uint64(v), 10)
+		case float64:
+			number = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		if number != "" {
+			fmt.Fprintf(&b, `<c r="%s"%s><v>%s</v></c>`, ref, style, number)
+			continue
+		}
+
+		text := fmt.Sprint(cell)
+		if cell == nil || text == "" {
+			continue
+		}
+		if len(text) > xlsxMaxCellText {
+			text = truncateRunes(text, xlsxMaxCellText)
+		}
+		fmt.Fprintf(&b, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">`, ref, style)
+		xml.EscapeText(&b, []byte(text))
+		b.WriteString(`</t></is></c>`)
+	}
+	b.WriteString(`</row>`)
+	_, err := io.WriteString(x.sheet, b.String())
+	return err
+}
+
+// WriteHeader writes a bold row
+func (x *xlsxStreamWriter) WriteHeader(cells []string) error {
+	row := make([]interface{}, len(cells))
+	for i, c := range cells {
+		row[i] = c
+	}
+	return x.writeRow(row, ` s="1"`)
+}
+
+// WriteRow writes one row; ints, uints and float64s become numbers, everything else text
+func (x *xlsxStreamWriter) WriteRow(cells []interface{}) error {
+	return x.writeRow(cells, "")
+}
+
+// Close finishes the worksheet and the zip archive
+func (x *xlsxStreamWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
@@ -62,6 +62,8 @@ func main() {
 	handler.SetSeriesDB(initializers.DB)
 	handler.SetPrinterHeaderDB(initializers.DB)
 	handler.SetIntegrationDB(initializers.DB)
+	handler.SetLeadSyncDB(initializers.DB)
+	handler.SetLeadWebhookDB(initializers.DB)
 	handler.SetQuotationTemplatesDB(initializers.DB)
 
 	handler.SetDepartmentDB(initializers.DB)
@@ -75,8 +77,31 @@ func main() {
 	handler.SetCRMTagDB(initializers.DB)
 	handler.SetLeadSourceDB(initializers.DB)
 	handler.SetRejectionReasonDB(initializers.DB)
+	handler.SetLeadStageDB(initializers.DB)
+	handler.SetLeadAssignmentDB(initializers.DB)
+	handler.SetNotificationDB(initializers.DB)
+	handler.SetAuditLogDB(initializers.DB)
+	handler.SetLeadScoreDB(initializers.DB)
+	handler.SetLeadSLADB(initializers.DB)
+	handler.SetCalendarFeedDB(initializers.DB)
+	handler.SetEmailInboxDB(initializers.DB)
+	handler.SetWhatsAppDB(initializers.DB)
+	handler.SetSalesTerritoryDB(initializers.DB)
+	handler.SetSalesTargetDB(initializers.DB)
 	handler.SetServiceItemDB(initializers.DB)
 
+	handler.SetCurrencyDB(initializers.DB)
+
+	// Reports
+	handler.SetReportsDB(initializers.DB)
+
+	// Background jobs: lead pulls, inbox reads, nightly lead scoring, follow-up reminders and response SLAs
+	handler.StartLeadSyncScheduler()
+	handler.StartEmailInboxScheduler()
+	handler.StartLeadScoreScheduler()
+	handler.StartFollowUpReminderScheduler()
+	handler.StartLeadSLAScheduler()
+
 	// set up fiber
 	app := fiber.New()
 
@@ -270,10 +295,30 @@ func main() {
 	api.Post("/quotation-templates", handler.CreateQuotationTemplate)
 	api.Get("/quotation-templates", handler.GetAllQuotationTemplates)
 	api.Get("/quotation-templates/:id", handler.GetQuotationTemplateByID)
+	api.Put("/quotation-templates/:id", handler.UpdateQuotationTemplate)
+	api.Post("/quotation-templates/:id/instantiate", handler.InstantiateQuotationTemplate)
 	api.Delete("/quotation-templates/:id", handler.DeleteQuotationTemplate)
 
 	app.Get("/api/quotations/max-scp-count/:sales_credit_person_id", handler.GetMaxQuotationScpCount)
 
+	// Reports
+	api.Get("/reports/quotations", handler.GetQuotationReport)
+	api.Get("/reports/lead-sources", handler.GetLeadSourceReport)
+
+	// Currencies & exchange rates
+	api.Get("/currencies", handler.GetCurrencies)
+	api.Get("/currencies/:id", handler.GetCurrency)
+	api.Post("/currencies", handler.CreateCurrency)
+	api.Put("/currencies/:id", handler.UpdateCurrency)
+	api.Delete("/currencies/:id", handler.DeleteCurrency)
+
+	api.Get("/exchange-rates", handler.GetExchangeRates)
+	api.Get("/exchange-rates/latest", handler.GetLatestExchangeRate)
+	api.Post("/exchange-rates", handler.CreateExchangeRate)
+	api.Post("/exchange-rates/import", handler.ImportExchangeRates)
+	api.Put("/exchange-rates/:id", handler.UpdateExchangeRate)
+	api.Delete("/exchange-rates/:id", handler.DeleteExchangeRate)
+
 	//HsnCode
 
 	api.Get("/hsncode", handler.GetAllHsnCode)
@@ -294,9 +339,26 @@ func main() {
 
 	//leads
 	api.Get("/leads", handler.GetAllLeads)
+	api.Get("/leads/export", handler.ExportLeads)
 	api.Get("/leads/:id", handler.GetLeadByID)
 	api.Post("/leads", handler.CreateLead)
 	api.Post("/leads/import", handler.ImportLeads)
+	api.Post("/leads/import/file", handler.ImportLeadsFile)
+	api.Post("/leads/bulk", handler.BulkUpdateLeads)
+	api.Get("/lead-imports", handler.GetLeadImports)
+	api.Get("/lead-imports/:id", handler.GetLeadImport)
+	api.Get("/lead-imports/:id/errors", handler.DownloadLeadImportErrors)
+	api.Post("/leads/duplicates/check", handler.CheckLeadDuplicates)
+	api.Post("/leads/merge", handler.MergeLeads)
+	api.Get("/leads/:id/duplicates", handler.GetLeadDuplicates)
+	api.Post("/leads/:id/convert", handler.ConvertLead)
+	api.Put("/leads/:id/stage", handler.ChangeLeadStageHandler)
+	api.Get("/leads/:id/stage-history", handler.GetLeadStageHistory)
+	api.Post("/leads/:id/auto-assign", handler.AutoAssignLead)
+	api.Get("/leads/:id/assignments", handler.GetLeadAssignments)
+	api.Get("/leads/:id/score", handler.GetLeadScore)
+	api.Get("/leads/:id/tags", handler.GetLeadTags)
+	api.Put("/leads/:id/tags", handler.SetLeadTags)
 	api.Put("/leads/:id", handler.UpdateLead)
 	api.Delete("/leads/:id", handler.DeleteLead)
 
@@ -313,10 +375,18 @@ func main() {
 	// Lead Followups
 	api.Post("/lead-followups", handler.CreateLeadFollowUp)
 	api.Get("/lead-followups", handler.GetLeadFollowUps)
+	api.Get("/lead-followups/agenda", handler.GetFollowUpAgenda)
+	api.Get("/lead-sla/at-risk", handler.GetLeadSLAAtRisk)
 	api.Get("/lead-followups/:id", handler.GetLeadFollowUp)
 	api.Put("/lead-followups/:id", handler.UpdateLeadFollowUp)
 	api.Delete("/lead-followups/:id", handler.DeleteLeadFollowUp)
 
+	// Calendar feeds (the .ics URL is public; its token is the credential)
+	api.Get("/calendar-feeds/:user_id", handler.GetCalendarFeedToken)
+	api.Post("/calendar-feeds/:user_id/token", handler.RotateCalendarFeedToken)
+	api.Delete("/calendar-feeds/:user_id", handler.RevokeCalendarFeedToken)
+	api.Get("/calendar/:token", handler.GetCalendarFeed)
+
 	// Lead Timeline
 	api.Get("/lead/:id/timeline", handler.GetLeadTimeline)
 
@@ -325,8 +395,41 @@ func main() {
 	api.Get("/lead-sources/:id", handler.GetLeadSource)
 	api.Post("/lead-sources", handler.CreateLeadSource)
 	api.Put("/lead-sources/:id", handler.UpdateLeadSource)
+	api.Post("/lead-sources/:id/webhook-secret", handler.RotateLeadSourceSecret)
 	api.Delete("/lead-sources/:id", handler.DeleteLeadSource)
 
+	// Inbound lead webhooks
+	api.Post("/webhooks/leads/:source", handler.ReceiveLeadWebhook)
+	api.Get("/lead-webhook-rejections", handler.GetLeadWebhookRejections)
+
+	// Lead Stages
+	api.Get("/lead-stages", handler.GetLeadStages)
+	api.Get("/lead-stages/:id", handler.GetLeadStage)
+	api.Post("/lead-stages", handler.CreateLeadStage)
+	api.Put("/lead-stages/:id", handler.UpdateLeadStage)
+	api.Delete("/lead-stages/:id", handler.DeleteLeadStage)
+
+	// Lead Assignment Rules
+	api.Get("/lead-assignment-rules", handler.GetLeadAssignmentRules)
+	api.Get("/lead-assignment-rules/:id", handler.GetLeadAssignmentRule)
+	api.Post("/lead-assignment-rules", handler.CreateLeadAssignmentRule)
+	api.Put("/lead-assignment-rules/:id", handler.UpdateLeadAssignmentRule)
+	api.Delete("/lead-assignment-rules/:id", handler.DeleteLeadAssignmentRule)
+
+	// Lead Scoring Rules
+	api.Get("/lead-scoring-rules", handler.GetLeadScoringRules)
+	api.Get("/lead-scoring-rules/:id", handler.GetLeadScoringRule)
+	api.Post("/lead-scoring-rules", handler.CreateLeadScoringRule)
+	api.Put("/lead-scoring-rules/:id", handler.UpdateLeadScoringRule)
+	api.Delete("/lead-scoring-rules/:id", handler.DeleteLeadScoringRule)
+	api.Post("/lead-scoring/recompute", handler.RecomputeLeadScores)
+
+	// Notifications
+	api.Get("/notifications", handler.GetNotifications)
+	api.Put("/notifications/read-all", handler.MarkAllNotificationsRead)
+	api.Put("/notifications/:id/read", handler.MarkNotificationRead)
+	api.Get("/audit-logs", handler.GetAuditLogs)
+
 	// Rejection Reasons
 	api.Post("/rejection-reasons", handler.CreateRejectionReason)
 	api.Get("/rejection-reasons", handler.GetRejectionReasons)
@@ -357,6 +460,42 @@ func main() {
 	api.Get("/integrations/:id", handler.GetIntegration)
 	api.Put("/integrations/:id", handler.UpdateIntegration)
 	api.Delete("/integrations/:id", handler.DeleteIntegration)
+	api.Post("/integrations/:id/sync", handler.SyncIntegrationLeads)
+	api.Get("/integrations/:id/sync-state", handler.GetLeadSyncState)
+	api.Get("/lead-sync-runs", handler.GetLeadSyncRuns)
+	api.Post("/integrations/:id/email-sync", handler.SyncEmailInbox)
+	api.Get("/integrations/:id/email-sync-state", handler.GetEmailSyncState)
+
+	// Inbound email triage
+	api.Get("/inbound-emails", handler.GetInboundEmails)
+	api.Get("/inbound-emails/:id", handler.GetInboundEmail)
+	api.Get("/inbound-emails/:id/attachments/:n", handler.GetInboundEmailAttachment)
+	api.Post("/inbound-emails/:id/assign", handler.AssignInboundEmail)
+	api.Post("/inbound-emails/:id/ignore", handler.IgnoreInboundEmail)
+
+	// WhatsApp
+	api.Get("/whatsapp-templates", handler.GetWhatsappTemplates)
+	api.Post("/whatsapp-templates", handler.CreateWhatsappTemplate)
+	api.Put("/whatsapp-templates/:id", handler.UpdateWhatsappTemplate)
+	api.Delete("/whatsapp-templates/:id", handler.DeleteWhatsappTemplate)
+	api.Get("/whatsapp-messages", handler.GetWhatsappMessages)
+	api.Post("/leads/:id/whatsapp", handler.SendLeadWhatsApp)
+	api.Post("/quotations/:id/whatsapp", handler.SendQuotationWhatsApp)
+	api.Get("/webhooks/whatsapp/:id", handler.VerifyWhatsAppWebhook)
+	api.Post("/webhooks/whatsapp/:id", handler.ReceiveWhatsAppWebhook)
+
+	// Sales territories & targets
+	api.Get("/sales-territories", handler.GetSalesTerritories)
+	api.Get("/sales-territories/:id", handler.GetSalesTerritory)
+	api.Post("/sales-territories", handler.CreateSalesTerritory)
+	api.Put("/sales-territories/:id", handler.UpdateSalesTerritory)
+	api.Delete("/sales-territories/:id", handler.DeleteSalesTerritory)
+	api.Get("/sales-targets", handler.GetSalesTargets)
+	api.Get("/sales-targets/achievement", handler.GetSalesAchievement)
+	api.Get("/sales-targets/:id", handler.GetSalesTarget)
+	api.Post("/sales-targets", handler.CreateSalesTarget)
+	api.Put("/sales-targets/:id", handler.UpdateSalesTarget)
+	api.Delete("/sales-targets/:id", handler.DeleteSalesTarget)
 
 	// menu
 	api.Get("/loadMenus", handler.GetAllMenus)
@@ -480,6 +619,9 @@ func main() {
 	api.Post("/series", handler.CreateSeries)
 	api.Put("/series/:id", handler.UpdateSeries)
 	api.Delete("/series/:id", handler.DeleteSeries)
+	api.Get("/series/:id/preview", handler.PreviewSeriesNumbers)
+	api.Get("/series/:id/counters", handler.GetSeriesCounters)
+	api.Post("/series/:id/close-year", handler.CloseSeriesYear)
 
 	// Log route registration status so startup logs show if login endpoints were registered
 	fmt.Printf("Route registration: /login=%v, /api/login=%v\n", routeStatus.Login, routeStatus.APILogin)
@@ -311,6 +311,11 @@ func main() {
 		//30/9/2025
 		&models.TandC{},
 		&models.Series{},
+		&models.SeriesCounter{},
+		&models.SeriesYearClosure{},
+		&models.IssuedDocumentNumber{},
+		&models.Currency{},
+		&models.ExchangeRate{},
 		&models.PrinterHeader{},
 
 		&models.QuotationTable{},
@@ -329,6 +334,27 @@ func main() {
 		&models.EmployeeHierarchy{},
 		&models.EmployeeOrganizationUnit{},
 		&models.Integration{},
+		&models.LeadSyncState{},
+		&models.LeadSyncRun{},
+		&models.LeadWebhookRejection{},
+		&models.LeadMergeLog{},
+		&models.LeadStage{},
+		&models.LeadStageHistory{},
+		&models.LeadAssignmentRule{},
+		&models.LeadAssignmentLog{},
+		&models.Notification{},
+		&models.LeadScoringRule{},
+		&models.FollowUpReminderLog{},
+		&models.LeadImport{},
+		&models.AuditLog{},
+		&models.CalendarFeedToken{},
+		&models.InboundEmail{},
+		&models.EmailSyncState{},
+		&models.WhatsappTemplate{},
+		&models.WhatsappMessage{},
+		&models.SalesTerritory{},
+		&models.SalesTerritoryArea{},
+		&models.SalesTarget{},
 
 		// CRM Configuration
 		&models.CRMTag{},
@@ -383,6 +409,97 @@ func main() {
 		}
 	}
 
+	// Backfill confirmation time for quotations confirmed before confirmed_at existed
+	initializers.DB.Exec(`UPDATE quotation_tables SET confirmed_at = updated_at WHERE LOWER(status) = 'confirmed' AND confirmed_at IS NULL`)
+
+	// Expression indexes behind lead duplicate detection (normalised mobile and email)
+	initializers.DB.Exec(`CREATE INDEX IF NOT EXISTS idx_leads_mobile_key ON leads (RIGHT(regexp_replace(mobile, '\D', '', 'g'), 10))`)
+	initializers.DB.Exec(`CREATE INDEX IF NOT EXISTS idx_leads_email_key ON leads (LOWER(TRIM(email)))`)
+
+	// Seed the base currency and backfill INR totals for existing quotations
+	initializers.DB.Exec(`INSERT INTO currencies (code, name, symbol, decimal_places, is_base, active, created_at, updated_at)
+		VALUES ('INR', 'Indian Rupee', '₹', 2, true, true, NOW(), NOW()) ON CONFLICT (code) DO NOTHING`)
+	initializers.DB.Exec(`UPDATE quotation_tables SET
+		base_total_amount = ROUND((total_amount * COALESCE(NULLIF(exchange_rate, 0), 1))::numeric, 2),
+		base_tax_amount = ROUND((tax_amount * COALESCE(NULLIF(exchange_rate, 0), 1))::numeric, 2),
+		base_grand_total = ROUND((grand_total * COALESCE(NULLIF(exchange_rate, 0), 1))::numeric, 2)
+		WHERE base_grand_total = 0 AND grand_total <> 0`)
+
+	// Quotations are numbered from a series; seed one when no active quotation series exists yet
+	initializers.DB.Exec(`INSERT INTO series (name, prefix, postfix, remarks, document_type, pattern, reset_policy, start_number, branch_scoped, is_active)
+		SELECT 'Quotation', 'QT', '', 'Default quotation series', 'Quotation', '', 'yearly', 1, false, true
+		WHERE NOT EXISTS (SELECT 1 FROM series WHERE is_active = true AND document_type ILIKE 'Quotation')`)
+
+	// Seed the lead pipeline and point existing leads at their stage
+	initializers.DB.Exec(`INSERT INTO lead_stages (code, name, sort_order, probability, is_won, is_lost, active, created_at, updated_at) VALUES
+		('unqualified', 'Unqualified', 10, 5, false, false, true, NOW(), NOW()),
+		('discussion', 'Discussion', 20, 20, false, false, true, NOW(), NOW()),
+		('appointment', 'Appointment', 30, 35, false, false, true, NOW(), NOW()),
+		('demo', 'Demo', 40, 50, false, false, true, NOW(), NOW()),
+		('proposal', 'Proposal', 50, 70, false, false, true, NOW(), NOW()),
+		('decided', 'Decided', 60, 100, true, false, true, NOW(), NOW()),
+		('inactive', 'Inactive', 70, 0, false, true, true, NOW(), NOW())
+		ON CONFLICT (code) DO NOTHING`)
+	initializers.DB.Exec(`UPDATE leads SET stage_id = s.id, stage = s.name FROM lead_stages s
+		WHERE leads.stage_id IS NULL AND (LOWER(TRIM(leads.stage)) = LOWER(s.code) OR LOWER(TRIM(leads.stage)) = LOWER(s.name))`)
+	initializers.DB.Exec(`UPDATE leads SET stage_id = s.id, stage = s.name FROM lead_stages s
+		WHERE leads.stage_id IS NULL AND leads.customer_id IS NOT NULL AND s.code = 'decided'`)
+	initializers.DB.Exec(`UPDATE leads SET stage_id = s.id, stage = s.name FROM lead_stages s
+		WHERE leads.stage_id IS NULL AND LOWER(TRIM(leads.stage)) IN ('', 'new', 'raw lead') AND s.code = 'unqualified'`)
+	initializers.DB.Exec(`INSERT INTO lead_stage_histories (lead_id, to_stage_id, to_stage, from_stage, remarks, changed_at)
+		SELECT l.id, l.stage_id, l.stage, '', '', COALESCE(l.stage_changed_at, l.created_at) FROM leads l
+		WHERE l.stage_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM lead_stage_histories h WHERE h.lead_id = l.id)`)
+
+	// Default lead scoring rules, only when none are configured yet
+	initializers.DB.Exec(`INSERT INTO lead_scoring_rules (name, factor, value, threshold, weight, active, created_at, updated_at)
+		SELECT v.name, v.factor, '', v.threshold, v.weight, true, NOW(), NOW() FROM (VALUES
+			('Potential above 1 lakh', 'potential', 100000, 20),
+			('GSTIN available', 'gstin', 0, 10),
+			('Email available', 'email', 0, 5),
+			('Talked in the last 7 days', 'last_talk', 7, 15),
+			('3 or more interactions', 'interactions', 3, 15),
+			('Quotation sent', 'quotation_sent', 1, 20),
+			('Quotation confirmed', 'quotation_confirmed', 1, 15)
+		) AS v(name, factor, threshold, weight)
+		WHERE NOT EXISTS (SELECT 1 FROM lead_scoring_rules)`)
+
+	// Follow-ups created before statuses were set are pending; keep leads' next talk on the earliest one
+	initializers.DB.Exec(`UPDATE lead_follow_ups SET status = 'pending' WHERE status IS NULL OR status = ''`)
+	initializers.DB.Exec(`UPDATE leads SET next_talk = f.next FROM (
+		SELECT lead_id, MIN(follow_up_on) AS next FROM lead_follow_ups WHERE status = 'pending' GROUP BY lead_id
+	) f WHERE leads.id = f.lead_id AND leads.next_talk IS DISTINCT FROM f.next`)
+
+	// Normalize free text lead tags into crm_tags and link them; codes follow crmTagCode in the handlers
+	initializers.DB.Exec(`INSERT INTO crm_tags (code, title, active, created_at, updated_at)
+		SELECT DISTINCT ON (t.code) t.code, t.title, true, NOW(), NOW() FROM (
+			SELECT LEFT(regexp_replace(regexp_replace(LOWER(TRIM(p)), '\s+', '-', 'g'), '[^a-z0-9-]', '', 'g'), 50) AS code,
+				LEFT(TRIM(p), 100) AS title
+			FROM leads, regexp_split_to_table(leads.tags, '[,;|]') AS p
+			WHERE leads.tags IS NOT NULL AND TRIM(p) <> ''
+		) t
+		WHERE t.code <> '' AND NOT EXISTS (SELECT 1 FROM crm_tags c WHERE LOWER(c.title) = LOWER(t.title))
+		ORDER BY t.code, t.title
+		ON CONFLICT (code) DO NOTHING`)
+	initializers.DB.Exec(`INSERT INTO lead_crm_tags (lead_id, crm_tag_id)
+		SELECT DISTINCT leads.id, c.id
+		FROM leads, regexp_split_to_table(leads.tags, '[,;|]') AS p, crm_tags c
+		WHERE leads.tags IS NOT NULL AND TRIM(p) <> '' AND (LOWER(c.title) = LOWER(LEFT(TRIM(p), 100))
+			OR c.code = LEFT(regexp_replace(regexp_replace(LOWER(TRIM(p)), '\s+', '-', 'g'), '[^a-z0-9-]', '', 'g'), 50))
+		ON CONFLICT DO NOTHING`)
+
+	// First-response SLA: first interaction of each lead, due times from the source's SLA and
+	// breaches that already happened (flagged without notifying)
+	initializers.DB.Exec(`UPDATE leads SET first_response_at = fi.first_at FROM (
+		SELECT lead_id, MIN("timestamp") AS first_at FROM lead_interactions GROUP BY lead_id
+	) fi WHERE leads.id = fi.lead_id AND leads.first_response_at IS NULL`)
+	initializers.DB.Exec(`UPDATE leads SET sla_due_at = leads.created_at + make_interval(mins => s.response_sla_minutes)
+		FROM lead_sources s
+		WHERE leads.sla_due_at IS NULL AND s.active = true AND s.response_sla_minutes > 0
+			AND (LOWER(TRIM(leads.source)) IN (LOWER(s.name), LOWER(s.code)) OR LOWER(leads.external_source) = LOWER(s.code))`)
+	initializers.DB.Exec(`UPDATE leads SET sla_breached = true, sla_breached_at = sla_due_at
+		WHERE sla_due_at IS NOT NULL AND sla_breached = false
+			AND ((first_response_at IS NULL AND sla_due_at < NOW()) OR first_response_at > sla_due_at)`)
+
 	// Post-migration cleanup: drop typo column if it still exists
 	var typoStillExists bool
 	initializers.DB.Raw(`
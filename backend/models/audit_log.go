@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// AuditLog records an action taken on business data, e.g. a bulk change to leads or an export
+type AuditLog struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	UserID     *uint          `gorm:"index" json:"user_id,omitempty"`
+	Action     string         `gorm:"size:50;index" json:"action"` // e.g. lead.bulk_reassign, lead.export
+	EntityType string         `gorm:"size:50;index" json:"entity_type"`
+	EntityID   *uint          `gorm:"index" json:"entity_id,omitempty"`
+	Details    datatypes.JSON `json:"details,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
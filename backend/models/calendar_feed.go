@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// CalendarFeedToken is the secret in a user's iCalendar subscription URL; rotating it
+// revokes the old URL
+type CalendarFeedToken struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"uniqueIndex;not null" json:"user_id"`
+	Token  string `gorm:"size:64;uniqueIndex;not null" json:"token"`
+
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
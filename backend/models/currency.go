@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// BaseCurrency is the currency all documents are also stored in
+const BaseCurrency = "INR"
+
+type Currency struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	Code          string `gorm:"size:3;uniqueIndex;not null" json:"code"` // ISO 4217, e.g. USD
+	Name          string `gorm:"size:100;not null" json:"name"`
+	Symbol        string `gorm:"size:10" json:"symbol"`
+	DecimalPlaces int    `gorm:"default:2" json:"decimal_places"`
+	IsBase        bool   `gorm:"default:false" json:"is_base"`
+	Active        bool   `gorm:"default:true" json:"active"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ExchangeRate is the value of one unit of a currency in INR on a given date
+type ExchangeRate struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CurrencyCode string    `gorm:"size:3;not null;uniqueIndex:idx_exchange_rate_day" json:"currency_code"`
+	RateDate     time.Time `gorm:"type:date;not null;uniqueIndex:idx_exchange_rate_day" json:"rate_date"`
+	Rate         float64   `gorm:"not null" json:"rate"`
+	Source       string    `gorm:"size:20" json:"source"` // manual | csv
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
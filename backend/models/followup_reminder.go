@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// FollowUpReminderLog records each reminder or escalation sent for a follow-up, per channel
+type FollowUpReminderLog struct {
+	ID         uint `gorm:"primaryKey" json:"id"`
+	FollowUpID uint `gorm:"index;not null" json:"followup_id"`
+	LeadID     uint `gorm:"index" json:"lead_id"`
+	UserID     uint `gorm:"index" json:"user_id"`
+
+	Kind    string `gorm:"size:20" json:"kind"`    // reminder, escalation
+	Channel string `gorm:"size:20" json:"channel"` // in_app, email, whatsapp
+	Status  string `gorm:"size:20" json:"status"`  // sent, failed
+	Error   string `gorm:"type:text" json:"error,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// InboundEmail is a message pulled from the IMAP inbox of an email integration. Matched mail
+// is logged on the lead as an interaction; the rest waits in the triage queue.
+type InboundEmail struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	IntegrationID uint   `gorm:"uniqueIndex:idx_inbound_email_uid;not null" json:"integration_id"`
+	UIDValidity   uint32 `gorm:"uniqueIndex:idx_inbound_email_uid" json:"uid_validity"`
+	UID           uint32 `gorm:"uniqueIndex:idx_inbound_email_uid" json:"uid"`
+	MessageID     string `gorm:"size:255;index" json:"message_id"`
+
+	FromAddress string    `gorm:"size:255;index" json:"from_address"`
+	FromName    string    `gorm:"size:255" json:"from_name"`
+	To          string    `gorm:"type:text" json:"to"`
+	Subject     string    `gorm:"type:text" json:"subject"`
+	Body        string    `gorm:"type:text" json:"body"`
+	ReceivedAt  time.Time `gorm:"index" json:"received_at"`
+
+	// [{"file_name": ..., "path": ..., "content_type": ..., "size": ...}]
+	Attachments datatypes.JSON `json:"attachments,omitempty"`
+
+	Status    string `gorm:"size:20;index" json:"status"`         // matched | unmatched | assigned | ignored
+	MatchedBy string `gorm:"size:20" json:"matched_by,omitempty"` // sender | quotation | manual
+
+	LeadID        *uint `gorm:"index" json:"lead_id,omitempty"`
+	CustomerID    *uint `gorm:"index" json:"customer_id,omitempty"`
+	QuotationID   *uint `gorm:"index" json:"quotation_id,omitempty"`
+	InteractionID *uint `gorm:"index" json:"interaction_id,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// EmailSyncState remembers how far an email integration's mailbox has been read
+type EmailSyncState struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	IntegrationID uint   `gorm:"uniqueIndex;not null" json:"integration_id"`
+	Mailbox       string `gorm:"size:100" json:"mailbox"`
+
+	// IMAP UIDs are only comparable while UIDVALIDITY stays the same
+	UIDValidity uint32 `json:"uid_validity"`
+	LastUID     uint32 `json:"last_uid"`
+
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastStatus string     `gorm:"size:20" json:"last_status"`
+	LastError  string     `gorm:"type:text" json:"last_error"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
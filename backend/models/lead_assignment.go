@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// LeadAssignmentRule picks an assignee for new leads. Every non-empty criterion must match
+// the lead (case-insensitive); a rule without criteria catches all leads. Matching leads are
+// distributed round-robin over the rule's team (UnitID) or its explicit user list.
+type LeadAssignmentRule struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Name     string `gorm:"size:100;not null" json:"name"`
+	Priority int    `gorm:"default:0" json:"priority"` // lower runs first
+	Active   bool   `gorm:"default:true" json:"active"`
+
+	// Criteria
+	State    string `gorm:"size:100" json:"state"`
+	City     string `gorm:"size:100" json:"city"`
+	Source   string `gorm:"size:100" json:"source"`
+	Category string `gorm:"size:100" json:"category"`
+
+	// Assignee pool: members of an organization unit, or a JSON array of user IDs
+	UnitID      *uint             `json:"unit_id,omitempty"`
+	Unit        *OrganizationUnit `gorm:"foreignKey:UnitID" json:"unit,omitempty"`
+	AssigneeIDs datatypes.JSON    `json:"assignee_ids,omitempty"`
+
+	// Users already holding this many open leads are skipped; 0 means no cap
+	MaxOpenLeads int `gorm:"default:0" json:"max_open_leads"`
+
+	// Round-robin cursor
+	LastAssignedUserID *uint `json:"last_assigned_user_id,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// LeadAssignmentLog records every change of a lead's assignee
+type LeadAssignmentLog struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	LeadID uint `gorm:"index;not null" json:"lead_id"`
+
+	RuleID           *uint  `json:"rule_id,omitempty"`
+	FromAssignedToID *uint  `json:"from_assigned_to_id,omitempty"`
+	AssignedToID     *uint  `gorm:"index" json:"assigned_to_id,omitempty"`
+	Method           string `gorm:"size:20" json:"method"` // rule, manual, merge
+	Reason           string `gorm:"type:text" json:"reason"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
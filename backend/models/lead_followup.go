@@ -17,6 +17,10 @@ type LeadFollowUp struct {
 	FollowUpOn time.Time `json:"followup_on"`
 	Status     string    `json:"status"` // pending, done, skipped, cancelled
 
+	// Set by the reminder scheduler so each notice goes out once
+	ReminderSentAt *time.Time `json:"reminder_sent_at,omitempty"`
+	EscalatedAt    *time.Time `json:"escalated_at,omitempty"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
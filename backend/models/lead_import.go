@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// LeadImport records one spreadsheet upload, validated (dry run) or committed, with the rows
+// that failed so an error report can be downloaded afterwards
+type LeadImport struct {
+	ID       uint       `gorm:"primaryKey" json:"id"`
+	FileName string     `gorm:"size:255" json:"file_name"`
+	SourceID *uint      `gorm:"index" json:"source_id,omitempty"`
+	Source   LeadSource `gorm:"foreignKey:SourceID" json:"source,omitempty"`
+
+	Mode    string `gorm:"size:20" json:"mode"` // insert, skip, update
+	DryRun  bool   `json:"dry_run"`
+	Status  string `gorm:"size:20" json:"status"` // validated, committed, rejected, rolled_back
+	Message string `gorm:"type:text" json:"message,omitempty"`
+
+	TotalRows int `json:"total_rows"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+
+	Mapping datatypes.JSON `json:"mapping,omitempty"` // lead field -> column header actually used
+	Headers datatypes.JSON `json:"headers,omitempty"`
+	Errors  datatypes.JSON `json:"errors,omitempty"` // [{row, values, errors}]
+
+	CreatedByID *uint     `gorm:"index" json:"created_by_id,omitempty"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
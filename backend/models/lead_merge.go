@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// LeadMergeLog records a duplicate lead folded into a surviving lead
+type LeadMergeLog struct {
+	ID         uint `gorm:"primaryKey" json:"id"`
+	SurvivorID uint `gorm:"index;not null" json:"survivor_id"`
+	MergedID   uint `gorm:"not null" json:"merged_id"`
+
+	// Snapshot of the merged lead as it was before deletion
+	MergedLead datatypes.JSON `json:"merged_lead"`
+
+	Interactions int   `json:"interactions"`
+	FollowUps    int   `json:"followups"`
+	MergedBy     *uint `json:"merged_by,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Inputs a lead scoring rule can look at
+const (
+	LeadScoreSource             = "source"              // Value: source name
+	LeadScorePotential          = "potential"           // Threshold: minimum potential (INR)
+	LeadScoreGSTIN              = "gstin"               // GSTIN present
+	LeadScoreEmail              = "email"               // email present
+	LeadScoreLastTalk           = "last_talk"           // Threshold: last talk within N days
+	LeadScoreInteractions       = "interactions"        // Threshold: minimum interaction count
+	LeadScoreQuotationSent      = "quotation_sent"      // Threshold: minimum sent or confirmed quotations
+	LeadScoreQuotationConfirmed = "quotation_confirmed" // Threshold: minimum confirmed quotations
+)
+
+// LeadScoringRule adds Weight to a lead's score when its factor holds for the lead
+type LeadScoringRule struct {
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	Name      string  `gorm:"size:100;not null" json:"name"`
+	Factor    string  `gorm:"size:30;not null" json:"factor"`
+	Value     string  `gorm:"size:100" json:"value"`
+	Threshold float64 `gorm:"default:0" json:"threshold"`
+	Weight    float64 `gorm:"default:0" json:"weight"`
+	Active    bool    `gorm:"default:true" json:"active"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
 
 type LeadSource struct {
 	ID          uint   `gorm:"primaryKey" json:"id"`
@@ -9,6 +13,18 @@ type LeadSource struct {
 	Description string `gorm:"type:text" json:"description"`
 	Active      bool   `gorm:"default:true" json:"active"`
 
+	// Inbound webhook: HMAC-SHA256 signing secret and lead field -> payload path map. The secret
+	// is never listed; it is shown once when set on create or rotated.
+	WebhookSecret    string         `gorm:"size:128" json:"-"`
+	HasWebhookSecret bool           `gorm:"-" json:"has_webhook_secret"`
+	FieldMap         datatypes.JSON `json:"field_map,omitempty"`
+
+	// First-response SLA: minutes allowed from a lead coming in to its first interaction (0 = none)
+	ResponseSLAMinutes int `gorm:"default:0" json:"response_sla_minutes"`
+
+	// Spreadsheet import: lead field -> column header map used for files from this source
+	ImportMap datatypes.JSON `json:"import_map,omitempty"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
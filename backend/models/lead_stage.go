@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// LeadStage is a step of the lead pipeline
+type LeadStage struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	Code        string  `gorm:"size:50;uniqueIndex" json:"code"`
+	Name        string  `gorm:"size:100;not null" json:"name"`
+	Description string  `gorm:"type:text" json:"description"`
+	SortOrder   int     `gorm:"default:0" json:"sort_order"`
+	Probability float64 `gorm:"default:0" json:"probability"` // win probability %
+	IsWon       bool    `gorm:"default:false" json:"is_won"`
+	IsLost      bool    `gorm:"default:false" json:"is_lost"`
+	Active      bool    `gorm:"default:true" json:"active"`
+
+	// Codes of the stages a lead may move to from this one; empty allows any open stage
+	AllowedNext datatypes.JSON `json:"allowed_next,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// LeadStageHistory records every stage change of a lead
+type LeadStageHistory struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	LeadID uint `gorm:"index;not null" json:"lead_id"`
+
+	FromStageID *uint  `json:"from_stage_id,omitempty"`
+	FromStage   string `gorm:"size:100" json:"from_stage"`
+	ToStageID   *uint  `gorm:"index" json:"to_stage_id,omitempty"`
+	ToStage     string `gorm:"size:100" json:"to_stage"`
+
+	RejectionReasonID *uint            `json:"rejection_reason_id,omitempty"`
+	RejectionReason   *RejectionReason `gorm:"foreignKey:RejectionReasonID" json:"rejection_reason,omitempty"`
+	Remarks           string           `gorm:"type:text" json:"remarks"`
+
+	ChangedByID *uint     `json:"changed_by_id,omitempty"`
+	ChangedAt   time.Time `gorm:"index" json:"changed_at"`
+}
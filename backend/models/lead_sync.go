@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// LeadSyncState keeps the incremental cursor of a lead platform integration
+type LeadSyncState struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	IntegrationID uint   `gorm:"uniqueIndex;not null" json:"integration_id"`
+	Provider      string `gorm:"size:50" json:"provider"`
+
+	// Last seen record time as reported by the provider (IndiaMART QUERY_TIME)
+	Cursor     string     `gorm:"size:50" json:"cursor"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastStatus string     `gorm:"size:20" json:"last_status"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// LeadSyncRun records the result of one pull from a lead platform
+type LeadSyncRun struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	IntegrationID uint   `gorm:"index;not null" json:"integration_id"`
+	Provider      string `gorm:"size:50" json:"provider"`
+	Trigger       string `gorm:"size:20" json:"trigger"` // schedule | manual
+
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Status     string     `gorm:"size:20" json:"status"` // running | success | failed
+
+	CursorFrom string `gorm:"size:50" json:"cursor_from"`
+	CursorTo   string `gorm:"size:50" json:"cursor_to"`
+
+	Fetched int    `json:"fetched"`
+	Created int    `json:"created"`
+	Updated int    `json:"updated"`
+	Failed  int    `json:"failed"`
+	Error   string `gorm:"type:text" json:"error"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LeadWebhookRejection keeps an inbound lead payload that was refused, for inspection
+type LeadWebhookRejection struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Source    string `gorm:"size:50;index" json:"source"`
+	Reason    string `gorm:"size:255" json:"reason"`
+	Signature string `gorm:"size:255" json:"signature"`
+	RemoteIP  string `gorm:"size:64" json:"remote_ip"`
+	Payload   string `gorm:"type:text" json:"payload"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
@@ -27,7 +27,7 @@ type Lead struct {
 	Website       string    `json:"website"`
 	Requirements  string    `json:"requirements"`
 	Notes         string    `json:"notes"`
-	Tags          string    `json:"tags"`
+	Tags          string    `json:"tags"` // titles of CRMTags, kept in step with the relation
 	LastTalk      time.Time `json:"lastTalk"`
 	NextTalk      time.Time `json:"nextTalk"`
 	TransferredOn time.Time `json:"transferredOn"`
@@ -44,6 +44,32 @@ type Lead struct {
 	AssignedToName string `json:"assignedToName"`
 	ProductName    string `json:"productName"`
 
+	// Identity of the lead on the platform it was pulled from (e.g. IndiaMART UNIQUE_QUERY_ID)
+	ExternalSource *string `gorm:"size:50;uniqueIndex:idx_lead_external" json:"external_source,omitempty"`
+	ExternalID     *string `gorm:"size:100;uniqueIndex:idx_lead_external" json:"external_id,omitempty"`
+
+	// Pipeline stage; changes go through the stage transition rules
+	StageID           *uint      `gorm:"index" json:"stage_id,omitempty"`
+	StageChangedAt    *time.Time `json:"stage_changed_at,omitempty"`
+	RejectionReasonID *uint      `gorm:"index" json:"rejection_reason_id,omitempty"`
+
+	CRMTags []CRMTag `gorm:"many2many:lead_crm_tags" json:"crm_tags,omitempty"`
+
+	// Weighted score from the lead scoring rules
+	Score    float64    `gorm:"default:0;index" json:"score"`
+	ScoredAt *time.Time `json:"scored_at,omitempty"`
+
+	// First-response SLA of the lead's source: when the first interaction was due, when it
+	// happened and whether (and since when) the SLA is breached
+	FirstResponseAt *time.Time `json:"first_response_at,omitempty"`
+	SLADueAt        *time.Time `gorm:"index" json:"sla_due_at,omitempty"`
+	SLABreached     bool       `gorm:"default:false;index" json:"sla_breached"`
+	SLABreachedAt   *time.Time `json:"sla_breached_at,omitempty"`
+
+	// Set when the lead is converted into a customer
+	CustomerID  *uint      `gorm:"index" json:"customer_id,omitempty"`
+	ConvertedAt *time.Time `json:"converted_at,omitempty"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
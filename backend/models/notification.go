@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Notification is an in-app message shown to a user
+type Notification struct {
+	ID     uint `gorm:"primaryKey" json:"id"`
+	UserID uint `gorm:"index;not null" json:"user_id"`
+
+	Type    string `gorm:"size:50;index" json:"type"` // e.g. lead_assigned, followup_due
+	Title   string `gorm:"size:200" json:"title"`
+	Message string `gorm:"type:text" json:"message"`
+
+	// What the notification is about, e.g. lead 42
+	EntityType string `gorm:"size:50" json:"entity_type,omitempty"`
+	EntityID   *uint  `json:"entity_id,omitempty"`
+
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+}
@@ -40,6 +40,9 @@ type QuotationTable struct {
 	CustomerID uint `gorm:"not null" json:"customer_id"`
 	Customer   User `gorm:"foreignKey:CustomerID" json:"customer"`
 
+	// Lead the quotation was opened from, if any
+	LeadID *uint `gorm:"index" json:"lead_id,omitempty"`
+
 	SalesCreditPersonID uint `json:"sales_credit_person_id"`
 	SalesCreditPerson   User `gorm:"foreignKey:SalesCreditPersonID" json:"sales_credit_person"`
 
@@ -54,9 +57,22 @@ type QuotationTable struct {
 	RoundoffAmount float64  `gorm:"not null" json:"roundoff_amount"`
 	GrandTotal     float64  `gorm:"not null" json:"grand_total"`
 
+	// Amounts converted to INR at ExchangeRate (equal to the above for INR quotations)
+	BaseTotalAmount float64 `gorm:"default:0" json:"base_total_amount"`
+	BaseTaxAmount   float64 `gorm:"default:0" json:"base_tax_amount"`
+	BaseGrandTotal  float64 `gorm:"default:0" json:"base_grand_total"`
+
 	// ?? Status
 	Status QuotationStatuses `gorm:"type:varchar(20);not null" json:"status"`
 
+	// Set the first time the quotation is confirmed
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+
+	// Why a cancelled quotation was lost
+	RejectionReasonID *uint            `gorm:"index" json:"rejection_reason_id,omitempty"`
+	RejectionReason   *RejectionReason `gorm:"foreignKey:RejectionReasonID" json:"rejection_reason,omitempty"`
+	LostRemarks       *string          `gorm:"type:text" json:"lost_remarks,omitempty"`
+
 	// ?? Audit
 	CreatedBy uint      `json:"created_by"`
 	CreatedAt time.Time `json:"created_at"`
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// SalesTerritory is a sales region made of states and cities, covered by an organization unit
+type SalesTerritory struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Code        string `gorm:"size:50" json:"code"`
+	Description string `gorm:"type:text" json:"description"`
+
+	UnitID *uint             `gorm:"index" json:"unit_id,omitempty"`
+	Unit   *OrganizationUnit `gorm:"foreignKey:UnitID" json:"unit,omitempty"`
+
+	Active bool `gorm:"default:true" json:"active"`
+
+	Areas []SalesTerritoryArea `gorm:"foreignKey:TerritoryID;constraint:OnDelete:CASCADE" json:"areas"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// SalesTerritoryArea places a state, or a single city of it, in a territory. A city area wins
+// over the area of its whole state, so a state can be split between territories.
+type SalesTerritoryArea struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	TerritoryID uint   `gorm:"index;not null" json:"territory_id"`
+	State       string `gorm:"size:100;uniqueIndex:idx_sales_territory_area;not null" json:"state"`
+	City        string `gorm:"size:100;uniqueIndex:idx_sales_territory_area" json:"city"` // empty for the whole state
+}
+
+// SalesTarget is the value and quantity a user, a territory, or a user within a territory is
+// expected to close in a month
+type SalesTarget struct {
+	ID    uint   `gorm:"primaryKey" json:"id"`
+	Month string `gorm:"size:7;index;not null" json:"month"` // YYYY-MM
+
+	UserID      *uint           `gorm:"index" json:"user_id,omitempty"`
+	User        *User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	TerritoryID *uint           `gorm:"index" json:"territory_id,omitempty"`
+	Territory   *SalesTerritory `gorm:"foreignKey:TerritoryID" json:"territory,omitempty"`
+
+	TargetValue    float64 `gorm:"default:0" json:"target_value"`
+	TargetQuantity float64 `gorm:"default:0" json:"target_quantity"`
+	Notes          string  `gorm:"type:text" json:"notes"`
+
+	CreatedByID *uint `json:"created_by_id,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
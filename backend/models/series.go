@@ -2,6 +2,13 @@ package models
 
 import "gorm.io/datatypes"
 
+// Series reset policies
+const (
+	SeriesResetNever   = "never"
+	SeriesResetYearly  = "yearly"
+	SeriesResetMonthly = "monthly"
+)
+
 type Series struct {
 	ID uint `gorm:"primaryKey" json:"id"`
 
@@ -17,6 +24,16 @@ type Series struct {
 	// document type (e.g. Invoice, Quotation)
 	DocumentType string `gorm:"size:100" json:"document_type,omitempty"`
 
+	// Numbering pattern, e.g. {prefix}/{FY}/{seq:05}{postfix}; empty uses the default pattern
+	Pattern string `gorm:"size:100" json:"pattern"`
+
+	// When the sequence restarts: never, yearly (on April 1) or monthly
+	ResetPolicy string `gorm:"size:20;not null;default:yearly" json:"reset_policy"`
+	// First number issued after every reset
+	StartNumber uint `gorm:"not null;default:1" json:"start_number"`
+	// Keep a separate counter per branch (the pattern must then contain {branch})
+	BranchScoped bool `gorm:"default:false" json:"branch_scoped"`
+
 	// Optional scope controls (recommended for ERP)
 	CompanyID        *uint          `json:"company_id,omitempty"`
 	CompanyBranchID  *uint          `json:"company_branch_id,omitempty"`
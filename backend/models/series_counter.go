@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// SeriesCounter holds the last number issued for a series within one numbering period.
+// Rows are locked with SELECT ... FOR UPDATE while a document number is drawn.
+type SeriesCounter struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	SeriesID uint   `gorm:"not null;uniqueIndex:idx_series_counter_key" json:"series_id"`
+	Series   Series `gorm:"foreignKey:SeriesID;constraint:OnDelete:CASCADE" json:"-"`
+
+	// Branch the counter belongs to for branch scoped series, 0 when shared by all branches
+	CompanyBranchID uint `gorm:"not null;default:0;uniqueIndex:idx_series_counter_key" json:"company_branch_id"`
+
+	// Financial year label, e.g. 2025-26 (empty for series that never reset)
+	FinancialYear string `gorm:"size:10;not null;uniqueIndex:idx_series_counter_key" json:"financial_year"`
+	// Month label, e.g. 2025-04 (empty unless the series resets monthly)
+	Period string `gorm:"size:7;not null;default:'';uniqueIndex:idx_series_counter_key" json:"period"`
+
+	LastNumber uint `gorm:"not null;default:0" json:"last_number"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// SeriesYearClosure marks a financial year as closed for a series; no numbers are issued into it afterwards
+type SeriesYearClosure struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	SeriesID uint   `gorm:"not null;uniqueIndex:idx_series_year_closure" json:"series_id"`
+	Series   Series `gorm:"foreignKey:SeriesID;constraint:OnDelete:CASCADE" json:"-"`
+
+	FinancialYear string `gorm:"size:10;not null;uniqueIndex:idx_series_year_closure" json:"financial_year"`
+
+	ClosedBy *uint     `json:"closed_by,omitempty"`
+	Remarks  string    `gorm:"type:text" json:"remarks"`
+	ClosedAt time.Time `gorm:"autoCreateTime" json:"closed_at"`
+}
+
+// IssuedDocumentNumber registers every number issued under a GSTIN. The unique index
+// guarantees a document number is used only once per financial year per GSTIN, as GST requires.
+type IssuedDocumentNumber struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	GSTIN          string `gorm:"size:20;not null;uniqueIndex:idx_issued_doc_number" json:"gstin"`
+	FinancialYear  string `gorm:"size:10;not null;uniqueIndex:idx_issued_doc_number" json:"financial_year"`
+	DocumentNumber string `gorm:"size:100;not null;uniqueIndex:idx_issued_doc_number" json:"document_number"`
+
+	SeriesID        uint   `gorm:"index" json:"series_id"`
+	CompanyBranchID uint   `json:"company_branch_id"`
+	DocumentType    string `gorm:"size:100" json:"document_type"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// WhatsappTemplate mirrors a message template approved on the WhatsApp Business account. Body
+// holds the approved text with {{1}}, {{2}}... placeholders, filled in order from Variables.
+type WhatsappTemplate struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Name     string `gorm:"size:100;uniqueIndex:idx_whatsapp_template_name;not null" json:"name"` // name as approved by Meta
+	Language string `gorm:"size:10;uniqueIndex:idx_whatsapp_template_name;default:en" json:"language"`
+	Category string `gorm:"size:30" json:"category"` // utility | marketing | authentication
+	Body     string `gorm:"type:text" json:"body"`
+
+	// ["lead_name", "quotation_number", ...] — one variable name per placeholder
+	Variables datatypes.JSON `json:"variables"`
+
+	Active bool `gorm:"default:true" json:"active"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// WhatsappMessage is one message sent or received through a WhatsApp integration
+type WhatsappMessage struct {
+	ID            uint   `gorm:"primaryKey" json:"id"`
+	IntegrationID uint   `gorm:"index" json:"integration_id"`
+	Provider      string `gorm:"size:50" json:"provider"`
+	Direction     string `gorm:"size:10;index" json:"direction"` // outbound | inbound
+	Number        string `gorm:"size:20;index" json:"number"`    // the other party, digits with country code
+
+	Type       string  `gorm:"size:20" json:"type"` // text | template | document
+	TemplateID *uint   `json:"template_id,omitempty"`
+	Body       string  `gorm:"type:text" json:"body"`
+	MediaPath  *string `gorm:"type:text" json:"media_path,omitempty"`
+
+	// wamid from the Cloud API or the gateway's id; status webhooks refer to it
+	ProviderMessageID string `gorm:"size:128;index" json:"provider_message_id"`
+	Status            string `gorm:"size:20;index" json:"status"` // queued | sent | delivered | read | failed | received
+	Error             string `gorm:"type:text" json:"error,omitempty"`
+
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+
+	LeadID        *uint `gorm:"index" json:"lead_id,omitempty"`
+	QuotationID   *uint `gorm:"index" json:"quotation_id,omitempty"`
+	InteractionID *uint `gorm:"index" json:"interaction_id,omitempty"`
+	SentByID      *uint `json:"sent_by_id,omitempty"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
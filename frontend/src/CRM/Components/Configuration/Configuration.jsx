@@ -1,9 +1,10 @@
 import React, { useState } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
-import { FaArrowLeft, FaUsers, FaTag, FaBox, FaCity, FaPlus, FaTimesCircle, FaThumbsDown } from 'react-icons/fa';
+import { FaArrowLeft, FaUsers, FaTag, FaBox, FaCity, FaPlus, FaTimesCircle, FaThumbsDown, FaStream } from 'react-icons/fa';
 import PrintHeader from '../../../Admin Master/page/PrintHeader/PrintHeader';
 import Sources from './Sources/Sources';
 import Tags from './Tags/Tags';
+import Stages from './Stages/Stages';
 import RejectionReasons from './RejectionReasons/RejectionReasons';
 import './configuration.scss';
 
@@ -12,6 +13,7 @@ const Configuration = () => {
   const { type } = useParams();
   const [showSources, setShowSources] = useState(false);
   const [showTags, setShowTags] = useState(false);
+  const [showStages, setShowStages] = useState(false);
   const [showRejectionReasons, setShowRejectionReasons] = useState(false);
 
   // Configuration cards data
@@ -30,6 +32,13 @@ const Configuration = () => {
       icon: FaTag,
       color: 'tags-card'
     },
+    {
+      id: 'stages',
+      title: 'Stages',
+      description: 'Define the pipeline stages, their win probability and allowed moves.',
+      icon: FaStream,
+      color: 'sources-card'
+    },
     {
       id: 'rejection-reasons',
       title: 'Rejection Reasons',
@@ -70,6 +79,10 @@ const Configuration = () => {
       setShowTags(true);
       return;
     }
+    if (cardId === 'stages') {
+      setShowStages(true);
+      return;
+    }
     if (cardId === 'rejection-reasons') {
       setShowRejectionReasons(true);
       return;
@@ -118,9 +131,10 @@ const Configuration = () => {
         </div>
       </div>
 
-      {/* Sources / Tags / Rejection Reasons Modals */}
+      {/* Sources / Tags / Stages / Rejection Reasons Modals */}
       <Sources isOpen={showSources} onClose={() => setShowSources(false)} />
       <Tags isOpen={showTags} onClose={() => setShowTags(false)} />
+      <Stages isOpen={showStages} onClose={() => setShowStages(false)} />
       <RejectionReasons isOpen={showRejectionReasons} onClose={() => setShowRejectionReasons(false)} />
   {/* Print Header page/modal when route is /configuration/header */}
   {type === 'header' && (
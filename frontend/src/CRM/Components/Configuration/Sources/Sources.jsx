@@ -11,7 +11,7 @@ const Sources = ({ isOpen, onClose }) => {
   const [loading, setLoading] = useState(false);
 
   const [showEditModal, setShowEditModal] = useState(false);
-  const [editingSource, setEditingSource] = useState({ id: null, name: '', code: '', description: '' });
+  const [editingSource, setEditingSource] = useState({ id: null, name: '', code: '', description: '', response_sla_minutes: 0 });
 
   const genCode = (name) => name.toLowerCase().trim().replace(/\s+/g, '-').replace(/[^a-z0-9\-]/g, '').slice(0, 50);
 
@@ -66,14 +66,16 @@ const Sources = ({ isOpen, onClose }) => {
     }
   };
 
-  const openEdit = (s) => { setEditingSource({ id: s.id, name: s.name, code: s.code || genCode(s.name), description: s.description || '' }); setShowEditModal(true); };
+  const openEdit = (s) => { setEditingSource({ id: s.id, name: s.name, code: s.code || genCode(s.name), description: s.description || '', response_sla_minutes: s.response_sla_minutes || 0 }); setShowEditModal(true); };
 
   const handleUpdateSource = async () => {
     const { id, name, code } = editingSource;
     if (!name.trim()) { alert('Name is required'); return; }
+    const slaMinutes = parseInt(editingSource.response_sla_minutes, 10) || 0;
+    if (slaMinutes < 0) { alert('Response SLA cannot be negative'); return; }
     setLoading(true);
     try {
-      const payload = { name, code };
+      const payload = { name, code, response_sla_minutes: slaMinutes };
       const res = await fetch(`${apiBase}/lead-sources/${id}`, { method: 'PUT', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(payload) });
       if (!res.ok) {
         const err = await res.json().catch(() => ({}));
@@ -112,6 +114,7 @@ const Sources = ({ isOpen, onClose }) => {
               <div className="tandc-item" key={source.id}>
                 <div className="tandc-name">
                   {source.name}
+                  {source.response_sla_minutes > 0 && <span className="muted"> · respond within {source.response_sla_minutes} min</span>}
                 </div>
                 <div className="item-actions">
                   <button className="icon-button edit" onClick={() => openEdit(source)} title="Edit source">
@@ -166,6 +169,10 @@ const Sources = ({ isOpen, onClose }) => {
                 <label htmlFor="edit-source-name">Source</label>
                 <input id="edit-source-name" type="text" placeholder="Enter source name" value={editingSource.name} onChange={(e) => setEditingSource(prev => ({ ...prev, name: e.target.value }))} autoFocus />
               </div>
+              <div className="form-row">
+                <label htmlFor="edit-source-sla">First response SLA (minutes, 0 = none)</label>
+                <input id="edit-source-sla" type="number" min="0" value={editingSource.response_sla_minutes} onChange={(e) => setEditingSource(prev => ({ ...prev, response_sla_minutes: e.target.value }))} />
+              </div>
             </div>
 
             <div className="tandc-dialog-footer">
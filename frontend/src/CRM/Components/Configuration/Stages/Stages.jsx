@@ -0,0 +1,176 @@
+import React, { useState, useEffect } from 'react';
+import { FaEdit, FaTrash } from 'react-icons/fa';
+import '../Sources/sources.scss';
+
+const apiBase = '/api';
+
+const emptyStage = { id: null, name: '', code: '', sort_order: 0, probability: 0, outcome: 'open' };
+
+const Stages = ({ isOpen, onClose }) => {
+  const [stages, setStages] = useState([]);
+  const [loading, setLoading] = useState(false);
+  const [showForm, setShowForm] = useState(false);
+  const [editingStage, setEditingStage] = useState(emptyStage);
+
+  const genCode = (name) => name.toLowerCase().trim().replace(/\s+/g, '-').replace(/[^a-z0-9\-]/g, '').slice(0, 50);
+
+  const fetchStages = async () => {
+    setLoading(true);
+    try {
+      const res = await fetch(`${apiBase}/lead-stages`);
+      if (!res.ok) throw new Error('Failed to fetch');
+      const data = await res.json();
+      setStages(data || []);
+    } catch (err) {
+      console.error('Failed to load stages', err);
+      alert('Failed to load lead stages');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  useEffect(() => {
+    if (isOpen) fetchStages();
+  }, [isOpen]);
+
+  const openAdd = () => {
+    const nextOrder = stages.reduce((max, s) => Math.max(max, s.sort_order || 0), 0) + 10;
+    setEditingStage({ ...emptyStage, sort_order: nextOrder });
+    setShowForm(true);
+  };
+
+  const openEdit = (s) => {
+    setEditingStage({
+      id: s.id,
+      name: s.name,
+      code: s.code || genCode(s.name),
+      sort_order: s.sort_order || 0,
+      probability: s.probability || 0,
+      outcome: s.is_won ? 'won' : s.is_lost ? 'lost' : 'open'
+    });
+    setShowForm(true);
+  };
+
+  const handleSaveStage = async () => {
+    const { id, name, code, sort_order, probability, outcome } = editingStage;
+    if (!name.trim()) { alert('Name is required'); return; }
+    setLoading(true);
+    try {
+      const payload = {
+        name,
+        code: code || genCode(name),
+        sort_order: Number(sort_order) || 0,
+        probability: Number(probability) || 0,
+        is_won: outcome === 'won',
+        is_lost: outcome === 'lost'
+      };
+      const res = await fetch(id ? `${apiBase}/lead-stages/${id}` : `${apiBase}/lead-stages`, { method: id ? 'PUT' : 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(payload) });
+      if (!res.ok) {
+        const err = await res.json().catch(() => ({}));
+        throw new Error(err.error || 'Save failed');
+      }
+      await fetchStages();
+      setShowForm(false);
+    } catch (error) {
+      console.error('Error saving stage:', error);
+      alert('Failed to save stage: ' + error.message);
+    } finally { setLoading(false); }
+  };
+
+  const handleDeleteStage = async (id) => {
+    if (!window.confirm('Are you sure you want to delete this stage?')) return;
+    try {
+      const res = await fetch(`${apiBase}/lead-stages/${id}`, { method: 'DELETE' });
+      if (!res.ok) {
+        const err = await res.json().catch(() => ({}));
+        throw new Error(err.error || 'Delete failed');
+      }
+      setStages(prev => prev.filter(s => s.id !== id));
+    } catch (error) {
+      console.error('Error deleting stage:', error);
+      alert('Failed to delete stage: ' + error.message);
+    }
+  };
+
+  if (!isOpen) return null;
+
+  return (
+    <div className="tandc-overlay" onClick={onClose}>
+      <div className="tandc-dialog" onClick={(e) => e.stopPropagation()}>
+        <div className="tandc-dialog-header">
+          <div className="title">Lead Stages</div>
+          <div className="actions">
+            <button className="btn-add small" onClick={openAdd}>+ Add</button>
+            <button className="close" onClick={onClose}>✕</button>
+          </div>
+        </div>
+
+        <div className="tandc-dialog-body">
+          {loading && stages.length === 0 ? (
+            <div className="muted">Loading...</div>
+          ) : stages.length === 0 ? (
+            <div className="muted">No stages found. Add one.</div>
+          ) : (
+            stages.map((stage) => (
+              <div className="tandc-item" key={stage.id}>
+                <div className="tandc-name">
+                  {stage.name} <span className="muted">({stage.probability || 0}%{stage.is_won ? ', won' : ''}{stage.is_lost ? ', lost' : ''}{stage.active === false ? ', inactive' : ''})</span>
+                </div>
+                <div className="item-actions">
+                  <button className="icon-button edit" onClick={() => openEdit(stage)} title="Edit stage">
+                    <FaEdit />
+                  </button>
+                  <button className="icon-button delete" onClick={() => handleDeleteStage(stage.id)} title="Delete stage">
+                    <FaTrash />
+                  </button>
+                </div>
+              </div>
+            ))
+          )}
+        </div>
+      </div>
+
+      {showForm && (
+        <div className="tandc-overlay" onClick={() => setShowForm(false)}>
+          <div className="tandc-dialog small" onClick={(e) => e.stopPropagation()}>
+            <div className="tandc-dialog-header">
+              <div className="title">{editingStage.id ? 'Edit Lead Stage' : 'Add Lead Stage'}</div>
+              <div className="actions">
+                <button className="close" onClick={() => setShowForm(false)}>✕</button>
+              </div>
+            </div>
+
+            <div className="tandc-dialog-body">
+              <div className="form-row">
+                <label htmlFor="stage-name">Stage</label>
+                <input id="stage-name" type="text" placeholder="Enter stage name" value={editingStage.name} onChange={(e) => setEditingStage(prev => ({ ...prev, name: e.target.value }))} autoFocus />
+              </div>
+              <div className="form-row">
+                <label htmlFor="stage-order">Order</label>
+                <input id="stage-order" type="number" value={editingStage.sort_order} onChange={(e) => setEditingStage(prev => ({ ...prev, sort_order: e.target.value }))} />
+              </div>
+              <div className="form-row">
+                <label htmlFor="stage-probability">Probability (%)</label>
+                <input id="stage-probability" type="number" min="0" max="100" value={editingStage.probability} onChange={(e) => setEditingStage(prev => ({ ...prev, probability: e.target.value }))} />
+              </div>
+              <div className="form-row">
+                <label htmlFor="stage-outcome">Outcome</label>
+                <select id="stage-outcome" value={editingStage.outcome} onChange={(e) => setEditingStage(prev => ({ ...prev, outcome: e.target.value }))}>
+                  <option value="open">Open</option>
+                  <option value="won">Won</option>
+                  <option value="lost">Lost</option>
+                </select>
+              </div>
+            </div>
+
+            <div className="tandc-dialog-footer">
+              <button className="btn-primary save" onClick={handleSaveStage} disabled={loading || !editingStage.name.trim()}>{loading ? 'Saving...' : 'Done'}</button>
+            </div>
+          </div>
+        </div>
+      )}
+    </div>
+  );
+};
+
+export default Stages;
@@ -27,15 +27,16 @@ const LeadDetails = ({ isOpen, lead, onClose, onEdit, onStatusUpdate }) => {
       if (data.type === 'stage') {
         payload.stage = data.newStage;
       } else if (data.type === 'reject') {
-        payload.stage = 'Inactive';
-        payload.rejectionReason = data.reason;
+        payload.stage = data.newStage || 'Inactive';
+        payload.rejection_reason_id = data.reasonId;
+        payload.remarks = data.reason;
       }
 
       // Optimistically update the UI immediately
       const prevStage = localStage;
       setLocalStage(payload.stage);
 
-      const res = await fetch(`${BASE_URL}/api/leads/${lead.id}`, {
+      const res = await fetch(`${BASE_URL}/api/leads/${lead.id}/stage`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(payload),
@@ -18,7 +18,9 @@ const UpdateStatusModal = ({ isOpen, onClose, currentStage, onStatusChange }) =>
   // Which action is selected by radio: 'change' or 'reject'
   const [selectedAction, setSelectedAction] = useState('change');
 
-  const stages = ['Discussion', 'Appointment', 'Demo', 'Proposal', 'Decided', 'Inactive'];
+  // Pipeline stages come from the Lead Stages master; lost stages are reached via Reject
+  const [stages, setStages] = useState(['Discussion', 'Appointment', 'Demo', 'Proposal', 'Decided']);
+  const [lostStage, setLostStage] = useState('Inactive');
   const apiBase = '/api';
   const genCode = (title) => title.toLowerCase().trim().replace(/\s+/g, '-').replace(/[^a-z0-9-]/g, '').slice(0, 50);
   const normalizeReason = (reason) => {
@@ -61,7 +63,25 @@ const UpdateStatusModal = ({ isOpen, onClose, currentStage, onStatusChange }) =>
       }
     };
 
+    const fetchStages = async () => {
+      try {
+        const res = await fetch(`${apiBase}/lead-stages?active=true`);
+        if (!res.ok) {
+          throw new Error('Failed to fetch');
+        }
+        const data = await res.json();
+        if (Array.isArray(data) && data.length > 0) {
+          setStages(data.filter(s => !s.is_lost).map(s => s.name));
+          const lost = data.find(s => s.is_lost);
+          if (lost) setLostStage(lost.name);
+        }
+      } catch (err) {
+        console.error('Failed to fetch lead stages:', err);
+      }
+    };
+
     fetchReasons();
+    fetchStages();
   }, [isOpen, currentStage]);
 
   if (!isOpen) return null;
@@ -99,14 +119,16 @@ const UpdateStatusModal = ({ isOpen, onClose, currentStage, onStatusChange }) =>
     }
 
     const prev = localCurrentStage;
-    // Optimistically mark as Inactive (reject)
-    setLocalCurrentStage('Inactive');
+    // Optimistically mark as lost (reject)
+    setLocalCurrentStage(lostStage);
     setIsUpdating(true);
 
     try {
       await onStatusChange({
         type: 'reject',
-        reason: rejectReason
+        newStage: lostStage,
+        reason: rejectReason,
+        reasonId: rejectReasonId ? Number(rejectReasonId) : null
       });
       setRejectReason('');
       setRejectReasonId('');
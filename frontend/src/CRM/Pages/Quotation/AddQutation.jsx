@@ -1443,6 +1443,15 @@ const handleTandCClose = () => setOpenTandCModal(false);
     }
 
     const grandTotalVal = Number(q.grand_total || (taxableAmount + totalTax));
+
+    // Foreign currency quotations print INR equivalents at the quotation's exchange rate
+    const pdfCurrency = String(q.currency || 'INR').toUpperCase();
+    const isForeign = pdfCurrency !== 'INR';
+    const cur = isForeign ? pdfCurrency : '₹';
+    const pdfRate = Number(q.exchange_rate) || 1;
+    const inrTaxable = Number(q.base_total_amount) || taxableAmount * pdfRate;
+    const inrTax = Number(q.base_tax_amount) || totalTax * pdfRate;
+    const inrGrandTotal = Number(q.base_grand_total) || grandTotalVal * pdfRate;
     
     const extraChargesArr = Array.isArray(q.extra_charges || extrcharges) ? (q.extra_charges || extrcharges) : [];
     const discountsArr = Array.isArray(q.discounts || additiondiscounts) ? (q.discounts || additiondiscounts) : [];
@@ -1599,12 +1608,12 @@ const handleTandCClose = () => setOpenTandCModal(false);
               <th>HSN / SAC</th>
               <th>Qty</th>
               <th>Unit</th>
-              <th>Rate (₹)</th>
+              <th>Rate (${cur})</th>
               <th>Discount %</th>
-              <th>Discount (₹)</th>
-              <th>Taxable (₹)</th>
+              <th>Discount (${cur})</th>
+              <th>Taxable (${cur})</th>
               <th>GST %</th>
-              <th>Amount (₹)</th>
+              <th>Amount (${cur})</th>
             </tr>
           </thead>
           <tbody>
@@ -1615,35 +1624,41 @@ const handleTandCClose = () => setOpenTandCModal(false);
         <div class="summary">
           <table>
             <tr class="amount-words">
-              <td colspan="2"><strong>Total Amount in Words:</strong> Rupees ${numberToWords(grandTotalVal)} only</td>
+              <td colspan="2"><strong>Total Amount in Words:</strong> ${isForeign ? pdfCurrency : 'Rupees'} ${numberToWords(grandTotalVal)} only</td>
             </tr>
-            <tr><td>Total Amount before Tax</td><td>₹ ${taxableAmount.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
+            <tr><td>Total Amount before Tax</td><td>${cur} ${taxableAmount.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
             
-            ${igst > 0 ? `<tr><td>iGST</td><td>₹ ${igst.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>` : ''}
-            ${cgst > 0 ? `<tr><td>CGST</td><td>₹ ${cgst.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>` : ''}
-            ${sgst > 0 ? `<tr><td>SGST</td><td>₹ ${sgst.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>` : ''}
+            ${igst > 0 ? `<tr><td>iGST</td><td>${cur} ${igst.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>` : ''}
+            ${cgst > 0 ? `<tr><td>CGST</td><td>${cur} ${cgst.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>` : ''}
+            ${sgst > 0 ? `<tr><td>SGST</td><td>${cur} ${sgst.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>` : ''}
             
-            <tr><td>Total Tax Amount</td><td>₹ ${totalTax.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
+            <tr><td>Total Tax Amount</td><td>${cur} ${totalTax.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
             
-            <tr style="border-top: 1px solid #000;"><td>Total</td><td>₹ ${(taxableAmount + totalTax).toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
+            <tr style="border-top: 1px solid #000;"><td>Total</td><td>${cur} ${(taxableAmount + totalTax).toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
 
             ${extraChargesArr.map(c => `
               <tr>
-                <td>${c.title} (${c.type === 'percent' ? `${c.value}%` : `₹${c.value}`})</td>
-                <td>₹ ${(c.type === 'percent' ? ((taxableAmount + totalTax) * c.value / 100) : Number(c.value)).toLocaleString('en-IN', {minimumFractionDigits: 2})}</td>
+                <td>${c.title} (${c.type === 'percent' ? `${c.value}%` : `${cur}${c.value}`})</td>
+                <td>${cur} ${(c.type === 'percent' ? ((taxableAmount + totalTax) * c.value / 100) : Number(c.value)).toLocaleString('en-IN', {minimumFractionDigits: 2})}</td>
               </tr>
             `).join('')}
 
             ${discountsArr.map(d => `
               <tr>
-                <td>${d.title} (${d.type === 'percent' ? `${d.value}%` : `₹${d.value}`})</td>
-                <td>- ₹ ${(d.type === 'percent' ? ((taxableAmount + totalTax) * d.value / 100) : Number(d.value)).toLocaleString('en-IN', {minimumFractionDigits: 2})}</td>
+                <td>${d.title} (${d.type === 'percent' ? `${d.value}%` : `${cur}${d.value}`})</td>
+                <td>- ${cur} ${(d.type === 'percent' ? ((taxableAmount + totalTax) * d.value / 100) : Number(d.value)).toLocaleString('en-IN', {minimumFractionDigits: 2})}</td>
               </tr>
             `).join('')}
 
-            ${q.roundoff_amount ? `<tr><td>Round off</td><td>₹ ${q.roundoff_amount.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>` : ''}
+            ${q.roundoff_amount ? `<tr><td>Round off</td><td>${cur} ${q.roundoff_amount.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>` : ''}
 
-            <tr class="grand-total"><td>Grand Total</td><td>₹ ${grandTotalVal.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
+            <tr class="grand-total"><td>Grand Total</td><td>${cur} ${grandTotalVal.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
+            ${isForeign ? `
+              <tr><td>Exchange Rate</td><td>1 ${pdfCurrency} = ₹ ${pdfRate.toLocaleString('en-IN', {minimumFractionDigits: 2, maximumFractionDigits: 4})}</td></tr>
+              <tr><td>Total Amount before Tax (INR)</td><td>₹ ${inrTaxable.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
+              <tr><td>Total Tax Amount (INR)</td><td>₹ ${inrTax.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
+              <tr class="grand-total"><td>Grand Total (INR)</td><td>₹ ${inrGrandTotal.toLocaleString('en-IN', {minimumFractionDigits: 2})}</td></tr>
+            ` : ''}
           </table>
         </div>
 